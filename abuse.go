@@ -0,0 +1,235 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Reasons a client is banned
+const (
+	banRepeatedPayload = "repeated_payload"
+	banOversizedValues = "oversized_values"
+	banPathEnumeration = "path_enumeration"
+)
+
+// Ban is a client temporarily refused for abusive traffic
+type Ban struct {
+	Actor     string    `json:"actor"`
+	Reason    string    `json:"reason"`
+	BannedAt  time.Time `json:"banned_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// BansResponse represents the response for GET /admin/bans
+type BansResponse struct {
+	Bans  []Ban `json:"bans"`
+	Count int   `json:"count"`
+}
+
+// abuseCounters tracks one client's traffic within the current window
+type abuseCounters struct {
+	windowStart time.Time
+	lastPayload [sha256.Size]byte
+	repeats     int
+	oversized   int
+	notFound    int
+}
+
+// abuse holds the counters and bans of every client by actor
+var abuse = struct {
+	sync.Mutex
+	counters  map[string]*abuseCounters
+	bans      map[string]Ban
+	lastPrune time.Time
+}{counters: make(map[string]*abuseCounters), bans: make(map[string]Ban)}
+
+// abuseGuard refuses banned clients and bans those whose traffic within
+// ABUSE_WINDOW looks abusive: the same write body sent over and over,
+// repeated oversized writes, or many GETs of paths that do not exist.
+// Traffic is counted against the client's IP address as well as its API
+// key, since keys are not validated and a client could send a new one with
+// every request. Admin routes and health checks are never guarded.
+func abuseGuard(c *fiber.Ctx) error {
+	path := c.Path()
+	if strings.HasPrefix(path, "/admin") || path == "/healthz" || path == "/readyz" {
+		return c.Next()
+	}
+
+	actors := abuseActors(c)
+	now := time.Now()
+
+	abuse.Lock()
+	pruneAbuseLocked(now)
+	for _, actor := range actors {
+		if ban, banned := abuse.bans[actor]; banned && now.Before(ban.ExpiresAt) {
+			abuse.Unlock()
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(ban.ExpiresAt.Sub(now).Seconds())+1))
+			return fiber.NewError(fiber.StatusForbidden, "Temporarily banned for abusive traffic ("+ban.Reason+")")
+		}
+	}
+	counters := make([]*abuseCounters, len(actors))
+	for i, actor := range actors {
+		counters[i] = abuse.counters[actor]
+		if counters[i] == nil || now.Sub(counters[i].windowStart) >= config.AbuseWindow {
+			counters[i] = &abuseCounters{windowStart: now}
+			abuse.counters[actor] = counters[i]
+		}
+	}
+
+	if isAbuseCheckedWrite(c) {
+		if len(c.Body()) > config.AbuseMaxBodyBytes {
+			for i, actor := range actors {
+				counters[i].oversized++
+				if counters[i].oversized >= config.AbuseOversizedLimit {
+					banLocked(actor, banOversizedValues, now)
+				}
+			}
+			abuse.Unlock()
+			return fiber.NewError(fiber.StatusRequestEntityTooLarge, fmt.Sprintf("Request body exceeds %d bytes", config.AbuseMaxBodyBytes))
+		}
+
+		payload := sha256.Sum256(c.Body())
+		banned := false
+		for i, actor := range actors {
+			if payload == counters[i].lastPayload {
+				counters[i].repeats++
+			} else {
+				counters[i].lastPayload, counters[i].repeats = payload, 1
+			}
+			if counters[i].repeats > config.AbuseRepeatLimit {
+				banLocked(actor, banRepeatedPayload, now)
+				banned = true
+			}
+		}
+		if banned {
+			abuse.Unlock()
+			return fiber.NewError(fiber.StatusForbidden, "Temporarily banned for abusive traffic ("+banRepeatedPayload+")")
+		}
+	}
+	abuse.Unlock()
+
+	err := c.Next()
+
+	if c.Method() == fiber.MethodGet && responseStatus(c, err) == fiber.StatusNotFound {
+		abuse.Lock()
+		for i, actor := range actors {
+			counters[i].notFound++
+			if counters[i].notFound > config.AbuseNotFoundLimit {
+				banLocked(actor, banPathEnumeration, now)
+			}
+		}
+		abuse.Unlock()
+	}
+
+	return err
+}
+
+// abuseActors returns who a request is counted against: its client IP
+// address, and the fingerprint of its API key when it sends one
+func abuseActors(c *fiber.Ctx) []string {
+	ip := "ip:" + c.IP()
+	if actor := requestActor(c); actor != ip {
+		return []string{actor, ip}
+	}
+	return []string{ip}
+}
+
+// isAbuseCheckedWrite reports whether a request is a write whose body is
+// checked. Import chunks are large by design.
+func isAbuseCheckedWrite(c *fiber.Ctx) bool {
+	switch c.Method() {
+	case fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch:
+		return !strings.HasPrefix(c.Path(), "/imports")
+	}
+	return false
+}
+
+// responseStatus returns the status a request is answered with, including
+// errors not yet rendered by the error handler
+func responseStatus(c *fiber.Ctx, err error) int {
+	if e, ok := err.(*fiber.Error); ok {
+		return e.Code
+	}
+	if err != nil {
+		return fiber.StatusInternalServerError
+	}
+	return c.Response().StatusCode()
+}
+
+// banLocked bans an actor for ABUSE_BAN_DURATION. Caller must hold abuse.
+func banLocked(actor, reason string, now time.Time) {
+	abuse.bans[actor] = Ban{
+		Actor:     actor,
+		Reason:    reason,
+		BannedAt:  now.UTC(),
+		ExpiresAt: now.Add(config.AbuseBanDuration).UTC(),
+	}
+	delete(abuse.counters, actor)
+}
+
+// pruneAbuseLocked drops expired bans and finished windows, at most once a
+// window. Caller must hold abuse.
+func pruneAbuseLocked(now time.Time) {
+	if now.Sub(abuse.lastPrune) < config.AbuseWindow {
+		return
+	}
+	abuse.lastPrune = now
+
+	for actor, ban := range abuse.bans {
+		if !now.Before(ban.ExpiresAt) {
+			delete(abuse.bans, actor)
+		}
+	}
+	for actor, counters := range abuse.counters {
+		if now.Sub(counters.windowStart) >= config.AbuseWindow {
+			delete(abuse.counters, actor)
+		}
+	}
+}
+
+// getBans handles GET /admin/bans, listing current bans soonest to expire
+// first
+func getBans(c *fiber.Ctx) error {
+	now := time.Now()
+
+	abuse.Lock()
+	response := BansResponse{Bans: make([]Ban, 0, len(abuse.bans))}
+	for _, ban := range abuse.bans {
+		if now.Before(ban.ExpiresAt) {
+			response.Bans = append(response.Bans, ban)
+		}
+	}
+	abuse.Unlock()
+
+	sort.Slice(response.Bans, func(i, j int) bool {
+		return response.Bans[i].ExpiresAt.Before(response.Bans[j].ExpiresAt)
+	})
+	response.Count = len(response.Bans)
+
+	return c.JSON(response)
+}
+
+// deleteBan handles DELETE /admin/bans/:actor, lifting a ban early
+func deleteBan(c *fiber.Ctx) error {
+	abuse.Lock()
+	defer abuse.Unlock()
+
+	actor, err := url.PathUnescape(c.Params("actor"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid actor")
+	}
+	if _, banned := abuse.bans[actor]; !banned {
+		return fiber.NewError(fiber.StatusNotFound, "Actor is not banned")
+	}
+	delete(abuse.bans, actor)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
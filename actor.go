@@ -0,0 +1,16 @@
+package main
+
+import "github.com/gofiber/fiber/v2"
+
+// headerAPIKey identifies the calling client
+const headerAPIKey = "X-API-Key"
+
+// requestActor identifies who made a request: a fingerprint of the client's
+// API key when sent, otherwise its IP address. Keys are never recorded
+// as-is since actors show up on the public change feed.
+func requestActor(c *fiber.Ctx) string {
+	if key := c.Get(headerAPIKey); key != "" {
+		return "key:" + computeSHA256(key)[:16]
+	}
+	return "ip:" + c.IP()
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"crypto/subtle"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// adminAuth requires the configured ADMIN_TOKEN as a bearer token, or an
+// HMAC-signed request when ADMIN_SIGNING_SECRET is set. Admin routes are
+// open when neither is configured, except in demo mode where they are
+// closed.
+func adminAuth(c *fiber.Ctx) error {
+	if config.AdminToken == "" && config.AdminSigningSecret == "" {
+		if config.DemoMode {
+			return fiber.NewError(fiber.StatusForbidden, "Admin routes are disabled in demo mode without ADMIN_TOKEN or ADMIN_SIGNING_SECRET")
+		}
+		return c.Next()
+	}
+
+	if isSignedRequest(c) {
+		if err := verifySignedRequest(c); err != nil {
+			return err
+		}
+		return c.Next()
+	}
+
+	expected := "Bearer " + config.AdminToken
+	if config.AdminToken == "" || subtle.ConstantTimeCompare([]byte(c.Get(fiber.HeaderAuthorization)), []byte(expected)) != 1 {
+		return fiber.NewError(fiber.StatusUnauthorized, "Invalid admin token")
+	}
+
+	return c.Next()
+}
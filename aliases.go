@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Limits on the aliases of one string
+const (
+	maxAliases      = 16
+	maxAliasLength  = 64
+	aliasCharacters = "abcdefghijklmnopqrstuvwxyz0123456789._~-"
+)
+
+// SetAliasesRequest represents the request body for PUT /strings/:id/aliases
+type SetAliasesRequest struct {
+	Aliases []string `json:"aliases"`
+}
+
+// aliasMu is held while aliases are checked for uniqueness and stored, so
+// two strings cannot claim the same alias
+var aliasMu sync.Mutex
+
+// setAliases handles PUT /strings/:id/aliases, replacing the aliases of the
+// string with that ID; an empty list removes them. An alias belongs to one
+// string at a time, soft-deleted strings included.
+func setAliases(c *fiber.Ctx) error {
+	var req SetAliasesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if req.Aliases == nil {
+		return fiber.NewError(fiber.StatusBadRequest, "'aliases' is required")
+	}
+
+	aliases, err := normalizeAliases(req.Aliases)
+	if err != nil {
+		return err
+	}
+
+	found, err := findByID(c, c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	aliasMu.Lock()
+	defer aliasMu.Unlock()
+
+	for _, alias := range aliases {
+		if owner, taken := aliasOwner(alias); taken && owner != found.Value {
+			return fiber.NewError(fiber.StatusConflict, fmt.Sprintf("Alias %q is used by another string", alias))
+		}
+	}
+
+	shard := shardFor(found.Value)
+	shard.Lock()
+	current := shard.liveRecordLocked(found.Value)
+	if current == nil {
+		shard.Unlock()
+		return fiber.NewError(fiber.StatusNotFound, "String does not exist in the system")
+	}
+	if current.Pinned {
+		shard.Unlock()
+		return errPinned
+	}
+	if err := checkIfMatch(c, current); err != nil {
+		shard.Unlock()
+		return err
+	}
+
+	updated := *current
+	updated.Aliases = aliases
+	updated.UpdatedAt = time.Now().UTC()
+	shard.putLocked(&updated)
+	shard.Unlock()
+
+	publishEvent(Event{
+		Type:   eventStringUpdated,
+		ID:     updated.ID,
+		Value:  updated.Value,
+		Actor:  requestActor(c),
+		before: current,
+		after:  &updated,
+	})
+
+	return sendRecord(c, &updated)
+}
+
+// getStringByAlias handles GET /strings/alias/:name, answering like
+// GET /strings/id/:id. Aliases are case-insensitive.
+func getStringByAlias(c *fiber.Ctx) error {
+	alias := strings.ToLower(c.Params("name"))
+
+	for _, shard := range shards {
+		shard.RLock()
+		if value, ok := shard.aliases[alias]; ok {
+			data := shard.liveRecordLocked(value)
+			if data != nil {
+				shard.touchLocked(value)
+			}
+			shard.RUnlock()
+			if data == nil {
+				break
+			}
+			return sendRecord(c, data)
+		}
+		shard.RUnlock()
+	}
+
+	return fiber.NewError(fiber.StatusNotFound, "No string with this alias")
+}
+
+// normalizeAliases trims and lowercases aliases, dropping repeats, and
+// checks them against the limits
+func normalizeAliases(aliases []string) ([]string, error) {
+	if len(aliases) > maxAliases {
+		return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("A string can have at most %d aliases", maxAliases))
+	}
+
+	var normalized []string
+	seen := make(map[string]bool, len(aliases))
+	for _, alias := range aliases {
+		alias = strings.ToLower(strings.TrimSpace(alias))
+		if alias == "" || len(alias) > maxAliasLength {
+			return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Aliases must be 1 to %d characters", maxAliasLength))
+		}
+		if strings.ContainsFunc(alias, func(r rune) bool { return !strings.ContainsRune(aliasCharacters, r) }) {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Aliases may only contain letters, digits, '.', '_', '~' and '-'")
+		}
+		if !seen[alias] {
+			seen[alias] = true
+			normalized = append(normalized, alias)
+		}
+	}
+	return normalized, nil
+}
+
+// aliasOwner returns the value of the live or soft-deleted string with an
+// alias, and whether there is one
+func aliasOwner(alias string) (string, bool) {
+	for _, shard := range shards {
+		shard.RLock()
+		value, ok := shard.aliases[alias]
+		if !ok {
+			for _, data := range shard.deleted {
+				if data.hasAlias(alias) {
+					value, ok = data.Value, true
+					break
+				}
+			}
+		}
+		shard.RUnlock()
+		if ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// indexAliasesLocked files a record under its aliases. Caller must hold
+// the shard lock.
+func (s *storeShard) indexAliasesLocked(data *StringData) {
+	for _, alias := range data.Aliases {
+		s.aliases[alias] = data.Value
+	}
+}
+
+// hasAlias reports whether a string carries an alias
+func (data *StringData) hasAlias(alias string) bool {
+	for _, a := range data.Aliases {
+		if a == alias {
+			return true
+		}
+	}
+	return false
+}
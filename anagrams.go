@@ -0,0 +1,153 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AnagramsResponse represents the response for GET /strings/:id/anagrams
+type AnagramsResponse struct {
+	ID        string       `json:"id"`
+	Signature string       `json:"anagram_signature"`
+	Data      []StringData `json:"data"`
+	Count     int          `json:"count"`
+}
+
+// AnagramMember is one string of an anagram group
+type AnagramMember struct {
+	ID    string `json:"id"`
+	Value string `json:"value"`
+}
+
+// AnagramGroup is a set of stored strings that are anagrams of each other
+type AnagramGroup struct {
+	Signature string          `json:"anagram_signature"`
+	Strings   []AnagramMember `json:"strings"`
+	Size      int             `json:"size"`
+}
+
+// AnagramGroupsResponse represents the response for GET /anagram-groups
+type AnagramGroupsResponse struct {
+	Groups []AnagramGroup `json:"groups"`
+	Count  int            `json:"count"`
+	Total  int            `json:"total"`
+	Limit  int            `json:"limit"`
+	Offset int            `json:"offset"`
+}
+
+// anagramCandidate reports whether a record takes part in anagram lookups.
+// Encrypted and binary values are indexed by their encoded form, so they
+// are left out.
+func anagramCandidate(data *StringData, now time.Time) bool {
+	return data != nil && data.Encoding == "" && !data.expired(now)
+}
+
+// getAnagrams handles GET /strings/:id/anagrams, listing the other stored
+// strings with the same anagram signature as the string with that ID
+func getAnagrams(c *fiber.Ctx) error {
+	data, err := findByID(c, c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	response := AnagramsResponse{ID: data.ID, Data: []StringData{}}
+	if data.Encoding != "" || normalizeValue(data.Value) == "" {
+		return c.JSON(response)
+	}
+	response.Signature = anagramSignature(data.Value)
+
+	now := time.Now()
+	for _, shard := range shards {
+		shard.RLock()
+		for value := range shard.anagrams[response.Signature] {
+			if existing := shard.records[value]; value != data.Value && anagramCandidate(existing, now) {
+				response.Data = append(response.Data, *existing)
+			}
+		}
+		shard.RUnlock()
+	}
+
+	sort.Slice(response.Data, func(i, j int) bool { return response.Data[i].Value < response.Data[j].Value })
+	response.Count = len(response.Data)
+	return c.JSON(response)
+}
+
+// getAnagramGroups handles GET /anagram-groups, listing the sets of stored
+// strings that are anagrams of each other, largest first. ?min_size= (at
+// least 2, the default) drops smaller groups; ?limit= and ?offset= page
+// through the groups.
+func getAnagramGroups(c *fiber.Ctx) error {
+	minSize, err := queryInt(c, "min_size", 2, 2)
+	if err != nil {
+		return err
+	}
+	limit, err := queryInt(c, "limit", config.PageSize, 1)
+	if err != nil {
+		return err
+	}
+	if config.MaxResults > 0 && (limit <= 0 || limit > config.MaxResults) {
+		limit = config.MaxResults
+	}
+	offset, err := queryInt(c, "offset", 0, 0)
+	if err != nil {
+		return err
+	}
+
+	// Anagrams can be stored in different shards, so group across all of them
+	now := time.Now()
+	members := make(map[string][]AnagramMember)
+	for _, shard := range shards {
+		shard.RLock()
+		for signature, values := range shard.anagrams {
+			for value := range values {
+				if data := shard.records[value]; anagramCandidate(data, now) {
+					members[signature] = append(members[signature], AnagramMember{ID: data.ID, Value: value})
+				}
+			}
+		}
+		shard.RUnlock()
+	}
+
+	var groups []AnagramGroup
+	for signature, group := range members {
+		if len(group) < minSize {
+			continue
+		}
+		sort.Slice(group, func(i, j int) bool { return group[i].Value < group[j].Value })
+		groups = append(groups, AnagramGroup{Signature: signature, Strings: group, Size: len(group)})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Size != groups[j].Size {
+			return groups[i].Size > groups[j].Size
+		}
+		return groups[i].Signature < groups[j].Signature
+	})
+
+	response := AnagramGroupsResponse{Groups: []AnagramGroup{}, Total: len(groups), Limit: limit, Offset: offset}
+	if offset < len(groups) {
+		end := len(groups)
+		if limit > 0 && offset+limit < end {
+			end = offset + limit
+		}
+		response.Groups = groups[offset:end]
+	}
+	response.Count = len(response.Groups)
+	return c.JSON(response)
+}
+
+// queryInt reads an integer query parameter of at least floor, falling
+// back to def when it is absent
+func queryInt(c *fiber.Ctx, name string, def, floor int) (int, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return def, nil
+	}
+	val, err := strconv.Atoi(raw)
+	if err != nil || val < floor {
+		return 0, fiber.NewError(fiber.StatusBadRequest, name+" must be an integer of at least "+strconv.Itoa(floor))
+	}
+	return val, nil
+}
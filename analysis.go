@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Palindrome modes control which characters take part in the palindrome check
+const (
+	palindromeAlphanumeric = "alphanumeric"
+	palindromeUnicode      = "unicode"
+	palindromeStrict       = "strict"
+	palindromeLettersOnly  = "letters_only"
+)
+
+// palindromeModes maps each mode to its check
+var palindromeModes = map[string]func(s string) bool{
+	// ASCII letters and digits only, case-insensitive, as before the
+	// unicode mode became the default
+	palindromeAlphanumeric: func(s string) bool {
+		var cleaned []rune
+		for _, r := range s {
+			if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+				cleaned = append(cleaned, unicode.ToLower(r))
+			}
+		}
+		return runesPalindrome(cleaned)
+	},
+	// letters and digits of any script, under Unicode case folding
+	palindromeUnicode: isPalindrome,
+	// every character counts, case-sensitive
+	palindromeStrict: func(s string) bool {
+		return runesPalindrome([]rune(s))
+	},
+	// letters of any script, under Unicode case folding; digits are ignored
+	palindromeLettersOnly: func(s string) bool {
+		var cleaned []rune
+		for _, r := range s {
+			if unicode.IsLetter(r) {
+				cleaned = append(cleaned, foldRune(r))
+			}
+		}
+		return runesPalindrome(cleaned)
+	},
+}
+
+// runesPalindrome reports whether runes read the same in both directions
+func runesPalindrome(runes []rune) bool {
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		if runes[i] != runes[j] {
+			return false
+		}
+	}
+	return true
+}
+
+// AnalysisConfig selects which analyzers run and how words and palindromes
+// are recognised. A service-wide config applies to new strings unless their
+// collection was created with its own.
+type AnalysisConfig struct {
+	EnabledAnalyzers  []string `json:"enabled_analyzers"`
+	DisabledAnalyzers []string `json:"disabled_analyzers"`
+	Tokenizer         string   `json:"tokenizer"`
+	PalindromeMode    string   `json:"palindrome_mode"`
+}
+
+// analysisProfile is a validated AnalysisConfig ready to analyze strings
+type analysisProfile struct {
+	config     AnalysisConfig
+	enabled    map[string]bool
+	tokenizer  Tokenizer
+	palindrome func(s string) bool
+}
+
+// defaultProfile is applied to strings created outside any collection
+var defaultProfile atomic.Pointer[analysisProfile]
+
+// defaultAnalysisConfig builds the service-wide config from the environment
+func defaultAnalysisConfig() AnalysisConfig {
+	var enabled []string
+	for _, name := range strings.Split(config.OptionalAnalyzers, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			enabled = append(enabled, name)
+		}
+	}
+
+	return AnalysisConfig{
+		EnabledAnalyzers: enabled,
+		Tokenizer:        config.Tokenizer,
+		PalindromeMode:   palindromeUnicode,
+	}
+}
+
+// newAnalysisProfile validates cfg and resolves its analyzers and tokenizer.
+// Analyzers are on by default unless optional; required analyzers cannot be
+// disabled since record IDs and lookups depend on them.
+func newAnalysisProfile(cfg AnalysisConfig) (*analysisProfile, error) {
+	if cfg.Tokenizer == "" {
+		cfg.Tokenizer = "whitespace"
+	}
+	if cfg.PalindromeMode == "" {
+		cfg.PalindromeMode = palindromeUnicode
+	}
+
+	profile := &analysisProfile{
+		config:  cfg,
+		enabled: make(map[string]bool),
+	}
+	for _, a := range analyzers {
+		profile.enabled[a.Name] = !a.Optional
+	}
+
+	for _, name := range cfg.EnabledAnalyzers {
+		if _, ok := findAnalyzer(name); !ok {
+			return nil, fmt.Errorf("unknown analyzer %q", name)
+		}
+		profile.enabled[name] = true
+	}
+	for _, name := range cfg.DisabledAnalyzers {
+		a, ok := findAnalyzer(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown analyzer %q", name)
+		}
+		if a.Required {
+			return nil, fmt.Errorf("analyzer %q cannot be disabled", name)
+		}
+		profile.enabled[name] = false
+	}
+
+	tokenizer, err := tokenizerByName(cfg.Tokenizer)
+	if err != nil {
+		return nil, err
+	}
+	profile.tokenizer = tokenizer
+
+	palindrome, ok := palindromeModes[cfg.PalindromeMode]
+	if !ok {
+		return nil, fmt.Errorf("unknown palindrome mode %q", cfg.PalindromeMode)
+	}
+	profile.palindrome = palindrome
+
+	return profile, nil
+}
+
+// withPalindromeMode returns a copy of the profile checking palindromes
+// under another mode, for a request overriding the configured one
+func (p *analysisProfile) withPalindromeMode(mode string) (*analysisProfile, error) {
+	palindrome, ok := palindromeModes[mode]
+	if !ok {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "palindrome_mode must be one of "+strings.Join(palindromeModeNames(), ", "))
+	}
+	profile := *p
+	profile.config.PalindromeMode = mode
+	profile.palindrome = palindrome
+	return &profile, nil
+}
+
+// palindromeModeNames lists the palindrome modes in alphabetical order
+func palindromeModeNames() []string {
+	modes := make([]string, 0, len(palindromeModes))
+	for mode := range palindromeModes {
+		modes = append(modes, mode)
+	}
+	sort.Strings(modes)
+	return modes
+}
+
+// runs reports whether an analyzer should run for a record with the given encoding
+func (p *analysisProfile) runs(a analyzer, encoding string) bool {
+	if a.BinaryOnly && encoding != encodingBase64 {
+		return false
+	}
+	return p.enabled[a.Name]
+}
+
+// AnalysisConfigResponse is the effective analysis config with every analyzer's state
+type AnalysisConfigResponse struct {
+	AnalysisConfig
+	Analyzers       map[string]bool `json:"analyzers"`
+	PalindromeModes []string        `json:"palindrome_modes"`
+}
+
+// analysisConfigResponse describes a profile for the admin endpoints
+func analysisConfigResponse(profile *analysisProfile) AnalysisConfigResponse {
+	return AnalysisConfigResponse{
+		AnalysisConfig:  profile.config,
+		Analyzers:       profile.enabled,
+		PalindromeModes: palindromeModeNames(),
+	}
+}
+
+// getAnalysisConfig handles GET /admin/analysis-config
+func getAnalysisConfig(c *fiber.Ctx) error {
+	return c.JSON(analysisConfigResponse(defaultProfile.Load()))
+}
+
+// updateAnalysisConfig handles PUT /admin/analysis-config. The new config
+// applies to strings created afterwards; existing records keep the
+// properties they were analyzed with.
+func updateAnalysisConfig(c *fiber.Ctx) error {
+	var cfg AnalysisConfig
+	if err := c.BodyParser(&cfg); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	profile, err := newAnalysisProfile(cfg)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, err.Error())
+	}
+	defaultProfile.Store(profile)
+
+	return c.JSON(analysisConfigResponse(profile))
+}
@@ -0,0 +1,221 @@
+package main
+
+import "context"
+
+// analyzer computes a group of related properties
+type analyzer struct {
+	Name       string
+	Version    int
+	Optional   bool
+	Required   bool
+	BinaryOnly bool
+	Properties []propertySpec
+	apply      func(ctx context.Context, value string, properties *StringProperties, profile *analysisProfile)
+}
+
+// propertySpec describes one property an analyzer produces and the query
+// parameters that filter on it
+type propertySpec struct {
+	Name    string
+	Type    string
+	Filters []string
+}
+
+// analyzers lists every analyzer in the order they run. Optional analyzers
+// only run when switched on by the analysis config, required ones can never
+// be switched off, and binary-only analyzers only run for value_base64 records.
+var analyzers = []analyzer{
+	{
+		Name: "length", Version: 2,
+		Properties: []propertySpec{
+			{"length", "integer", []string{"min_length", "max_length"}},
+			{"byte_length", "integer", []string{"min_length", "max_length", "length_unit"}},
+			{"rune_length", "integer", []string{"min_length", "max_length", "length_unit"}},
+			{"grapheme_length", "integer", []string{"min_length", "max_length", "length_unit"}},
+		},
+		apply: analyzeLength,
+	},
+	{
+		// SHA-256 is only computed when it is the ID algorithm, so choosing a
+		// faster HASH_ALGORITHM does not pay for both
+		Name: "hash", Version: 1, Required: true,
+		Properties: []propertySpec{{"sha256_hash", "string", nil}},
+		apply: func(_ context.Context, value string, p *StringProperties, _ *analysisProfile) {
+			if config.HashAlgorithm == defaultHashAlgorithm {
+				p.SHA256Hash = computeSHA256(value)
+			}
+		},
+	},
+	{
+		Name: "palindrome", Version: 2,
+		Properties: []propertySpec{
+			{"is_palindrome", "boolean", []string{"is_palindrome"}},
+			{"palindrome_mode", "string", nil},
+		},
+		apply: func(_ context.Context, value string, p *StringProperties, profile *analysisProfile) {
+			p.IsPalindrome = profile.palindrome(value)
+			p.PalindromeMode = profile.config.PalindromeMode
+		},
+	},
+	{
+		Name: "characters", Version: 1,
+		Properties: []propertySpec{
+			{"unique_characters", "integer", nil},
+			{"character_frequency_map", "object", []string{"contains_character"}},
+		},
+		apply: func(_ context.Context, value string, p *StringProperties, _ *analysisProfile) {
+			p.UniqueCharacters = countUniqueCharacters(value)
+			p.CharacterFrequencyMap = getCharacterFrequency(value)
+		},
+	},
+	{
+		Name: "anagram", Version: 1,
+		Properties: []propertySpec{{"anagram_signature", "string", nil}},
+		apply: func(_ context.Context, value string, p *StringProperties, _ *analysisProfile) {
+			p.AnagramSignature = anagramSignature(value)
+		},
+	},
+	{
+		Name: "character_classes", Version: 1,
+		Properties: []propertySpec{
+			{"vowel_count", "integer", []string{"min_vowel_count", "max_vowel_count"}},
+			{"consonant_count", "integer", []string{"min_consonant_count", "max_consonant_count"}},
+			{"uppercase_count", "integer", []string{"min_uppercase_count", "max_uppercase_count"}},
+			{"lowercase_count", "integer", []string{"min_lowercase_count", "max_lowercase_count"}},
+			{"digit_count", "integer", []string{"min_digit_count", "max_digit_count"}},
+		},
+		apply: analyzeCharacterClasses,
+	},
+	{
+		Name: "scripts", Version: 1,
+		Properties: []propertySpec{
+			{"scripts", "array", []string{"script"}},
+			{"mixed_script", "boolean", []string{"mixed_script"}},
+			{"is_rtl", "boolean", []string{"is_rtl"}},
+		},
+		apply: analyzeScripts,
+	},
+	{
+		Name: "words", Version: 2,
+		Properties: []propertySpec{
+			{"word_count", "integer", []string{"word_count"}},
+			{"tokenizer", "string", nil},
+			{"longest_word", "string", nil},
+			{"longest_word_length", "integer", []string{"min_longest_word_length", "max_longest_word_length"}},
+			{"shortest_word", "string", nil},
+			{"shortest_word_length", "integer", []string{"min_shortest_word_length", "max_shortest_word_length"}},
+			{"average_word_length", "number", []string{"min_average_word_length", "max_average_word_length"}},
+		},
+		apply: analyzeWords,
+	},
+	{
+		Name: "structure", Version: 1,
+		Properties: []propertySpec{
+			{"sentence_count", "integer", []string{"min_sentence_count", "max_sentence_count"}},
+			{"line_count", "integer", []string{"min_line_count", "max_line_count"}},
+		},
+		apply: analyzeStructure,
+	},
+	{
+		Name: "language", Version: 5,
+		Properties: []propertySpec{
+			{"language_pack", "string", []string{"contains_word"}},
+			{"detected_language", "string", []string{"language"}},
+			{"language_confidence", "number", []string{"min_language_confidence"}},
+			{"stopword_count", "integer", nil},
+			{"syllable_count", "integer", nil},
+		},
+		apply: analyzeLanguage,
+	},
+	{
+		Name: "readability", Version: 2,
+		Properties: []propertySpec{
+			{"reading_ease", "number", []string{"min_reading_ease"}},
+			{"grade_level", "number", []string{"max_grade_level"}},
+		},
+		apply: analyzeReadability,
+	},
+	{
+		Name: "rot13", Version: 1,
+		Properties: []propertySpec{
+			{"is_rot13", "boolean", nil},
+			{"rot13_decoded", "string", nil},
+		},
+		apply: analyzeROT13,
+	},
+	{
+		Name: "entities", Version: 1,
+		Properties: []propertySpec{{"entities", "object", []string{"has_date", "has_time", "has_number", "has_currency"}}},
+		apply: func(_ context.Context, value string, p *StringProperties, _ *analysisProfile) {
+			p.Entities = extractEntities(value)
+		},
+	},
+	{
+		Name: "address", Version: 1,
+		Properties: []propertySpec{
+			{"url", "object", []string{"host", "tld"}},
+			{"email", "object", []string{"host", "tld"}},
+		},
+		apply: analyzeAddress,
+	},
+	{
+		Name: "bytes", Version: 1, BinaryOnly: true,
+		Properties: []propertySpec{{"bytes", "object", nil}},
+		apply: func(_ context.Context, value string, p *StringProperties, _ *analysisProfile) {
+			p.Bytes = analyzeBytes(value)
+		},
+	},
+	{
+		Name: "morse", Version: 1, Optional: true,
+		Properties: []propertySpec{{"morse", "string", nil}},
+		apply: func(_ context.Context, value string, p *StringProperties, _ *analysisProfile) {
+			p.Morse = toMorse(value)
+		},
+	},
+	{
+		Name: "nato", Version: 1, Optional: true,
+		Properties: []propertySpec{{"nato_phonetic", "string", nil}},
+		apply: func(_ context.Context, value string, p *StringProperties, _ *analysisProfile) {
+			p.NATOPhonetic = toNATO(value)
+		},
+	},
+	{
+		Name: "sentiment", Version: 1, Optional: true,
+		Properties: []propertySpec{{"sentiment", "object", []string{"sentiment", "min_sentiment_confidence"}}},
+		apply:      analyzeSentiment,
+	},
+	{
+		Name: "derived", Version: 1,
+		Properties: []propertySpec{{"derived", "object", nil}},
+		apply:      analyzeDerived,
+	},
+}
+
+// findAnalyzer looks up an analyzer by name
+func findAnalyzer(name string) (analyzer, bool) {
+	for _, a := range analyzers {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return analyzer{}, false
+}
+
+// analyzeString computes all properties of a string using the given
+// analysis profile, giving up early if ctx is done. Analyzers get ctx too
+// so those calling out to a service stop with the request.
+func analyzeString(ctx context.Context, value, encoding string, profile *analysisProfile) (StringProperties, error) {
+	var properties StringProperties
+
+	for _, a := range analyzers {
+		if !profile.runs(a, encoding) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return StringProperties{}, err
+		}
+		a.apply(ctx, value, &properties, profile)
+	}
+
+	return properties, nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Restore conflict strategies for values that are already stored
+const (
+	restoreSkip      = "skip"
+	restoreOverwrite = "overwrite"
+	restoreFail      = "fail"
+)
+
+// RestoreResponse represents the response for POST /admin/restore
+type RestoreResponse struct {
+	Restored    int `json:"restored"`
+	Skipped     int `json:"skipped"`
+	Overwritten int `json:"overwritten"`
+}
+
+// BackupCollection is the backup line introducing a collection; its strings,
+// with their collection field set, follow it
+type BackupCollection struct {
+	Definition *Collection `json:"collection_definition"`
+}
+
+// backupStrings handles POST /admin/backup, streaming every stored string,
+// and every collection with its strings, as NDJSON, gzip-compressed with
+// ?format=gzip
+func backupStrings(c *fiber.Ctx) error {
+	format := c.Query("format", "ndjson")
+	if format != "ndjson" && format != "gzip" {
+		return fiber.NewError(fiber.StatusBadRequest, "format must be ndjson or gzip")
+	}
+
+	records, cols := allRecords(), snapshotCollections()
+
+	filename, contentType := backupFilename(time.Now(), format == "gzip"), "application/x-ndjson"
+	if format == "gzip" {
+		contentType = "application/gzip"
+	}
+	c.Attachment(filename)
+	c.Set(fiber.HeaderContentType, contentType)
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := encodeBackup(w, records, cols, format == "gzip"); err != nil {
+			log.Printf("streaming backup: %v", err)
+		}
+	})
+
+	return nil
+}
+
+// backupFilename names a backup taken at t; names sort by time
+func backupFilename(t time.Time, compressed bool) string {
+	name := "strings-" + t.UTC().Format("20060102T150405Z") + ".ndjson"
+	if compressed {
+		name += ".gz"
+	}
+	return name
+}
+
+// encodeBackup writes records and collections to w as NDJSON,
+// gzip-compressed if asked
+func encodeBackup(w io.Writer, records []*StringData, cols []CollectionSnapshot, compressed bool) error {
+	if compressed {
+		gz := gzip.NewWriter(w)
+		if err := encodeBackup(gz, records, cols, false); err != nil {
+			gz.Close()
+			return err
+		}
+		return gz.Close()
+	}
+
+	encoder := json.NewEncoder(w)
+	for _, data := range records {
+		if err := encoder.Encode(data); err != nil {
+			return err
+		}
+	}
+	for _, col := range cols {
+		definition := Collection{Name: col.Name, CreatedAt: col.CreatedAt, Count: len(col.Strings), Analysis: col.Analysis}
+		if err := encoder.Encode(BackupCollection{Definition: &definition}); err != nil {
+			return err
+		}
+		for _, data := range col.Strings {
+			if err := encoder.Encode(data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// restoreStrings handles POST /admin/restore, loading a backup produced by
+// /admin/backup. Gzip bodies are detected automatically. Collections missing
+// are created; strings in a collection only conflict with the same value in
+// that collection. With ?on_conflict=fail nothing is restored if any value
+// already exists.
+func restoreStrings(c *fiber.Ctx) error {
+	onConflict := c.Query("on_conflict", restoreSkip)
+	switch onConflict {
+	case restoreSkip, restoreOverwrite, restoreFail:
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "on_conflict must be one of skip, overwrite, fail")
+	}
+
+	records, cols, err := decodeBackup(c.Body())
+	if err != nil {
+		return err
+	}
+
+	lockAllShards()
+	defer unlockAllShards()
+	collections.Lock()
+	defer collections.Unlock()
+
+	if onConflict == restoreFail {
+		for _, data := range records {
+			if _, exists := shardFor(data.Value).records[data.Value]; exists {
+				return fiber.NewError(fiber.StatusConflict, fmt.Sprintf("String %q already exists; nothing restored", displayValue(data.Value)))
+			}
+		}
+		if name, value, exists := collectionConflictLocked(cols); exists {
+			return fiber.NewError(fiber.StatusConflict, fmt.Sprintf("String %q already exists in collection %s; nothing restored", displayValue(value), name))
+		}
+	}
+
+	var response RestoreResponse
+	for _, data := range records {
+		shard := shardFor(data.Value)
+		if _, exists := shard.records[data.Value]; exists {
+			if onConflict == restoreSkip {
+				response.Skipped++
+				continue
+			}
+			response.Overwritten++
+		} else {
+			response.Restored++
+		}
+		shard.putLocked(data)
+	}
+	restoreBackupCollectionsLocked(cols, onConflict == restoreSkip, &response)
+
+	return c.JSON(response)
+}
+
+// decodeBackup parses an NDJSON backup, gunzipping it first if needed, into
+// the main store's strings and the collections. Strings of a collection the
+// backup does not define start a new one.
+func decodeBackup(body []byte) ([]*StringData, []CollectionSnapshot, error) {
+	var reader io.Reader = bytes.NewReader(body)
+	if len(body) >= 2 && body[0] == 0x1f && body[1] == 0x8b {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, nil, fiber.NewError(fiber.StatusBadRequest, "Invalid gzip backup")
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	var records []*StringData
+	var cols []CollectionSnapshot
+	colIndex := make(map[string]int)
+	decoder := json.NewDecoder(reader)
+	for line := 1; ; line++ {
+		var raw json.RawMessage
+		err := decoder.Decode(&raw)
+		if err == io.EOF {
+			break
+		}
+		var header BackupCollection
+		if err == nil {
+			err = json.Unmarshal(raw, &header)
+		}
+		if err != nil {
+			return nil, nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Invalid backup record %d: %s", line, err.Error()))
+		}
+
+		if definition := header.Definition; definition != nil {
+			if !collectionNamePattern.MatchString(definition.Name) {
+				return nil, nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Backup record %d defines a collection with an invalid name", line))
+			}
+			if _, defined := colIndex[definition.Name]; !defined {
+				colIndex[definition.Name] = len(cols)
+				cols = append(cols, CollectionSnapshot{Name: definition.Name, CreatedAt: definition.CreatedAt})
+			}
+			cols[colIndex[definition.Name]].Analysis = definition.Analysis
+			continue
+		}
+
+		var data StringData
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return nil, nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Invalid backup record %d: %s", line, err.Error()))
+		}
+		if data.Value == "" || data.ID == "" {
+			return nil, nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Backup record %d is missing its value or id", line))
+		}
+		// Usage is counted by the running service, never restored
+		data.Usage = nil
+
+		if data.Collection == "" {
+			records = append(records, &data)
+			continue
+		}
+		if !collectionNamePattern.MatchString(data.Collection) {
+			return nil, nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Backup record %d is in a collection with an invalid name", line))
+		}
+		if _, defined := colIndex[data.Collection]; !defined {
+			colIndex[data.Collection] = len(cols)
+			cols = append(cols, CollectionSnapshot{Name: data.Collection, CreatedAt: data.CreatedAt})
+		}
+		col := &cols[colIndex[data.Collection]]
+		col.Strings = append(col.Strings, &data)
+	}
+
+	return records, cols, nil
+}
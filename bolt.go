@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// bbolt bucket layout. Records are keyed by the SHA-256 of their value, as
+// in Redis, since bbolt refuses keys over 32 KiB.
+//
+//	records: sha256(value)     -> JSON record
+//	hashes:  sha256_hash (hex) -> value, a secondary index by content hash
+//	hits:    sha256(value)     -> big-endian uint64 count of cold loads
+var (
+	boltRecordsBucket = []byte("records")
+	boltHashesBucket  = []byte("hashes")
+	boltHitsBucket    = []byte("hits")
+	// boltStringsBucket keyed records by value in files written before
+	// records were keyed by hash; it is migrated when the file is opened
+	boltStringsBucket = []byte("strings")
+)
+
+// boltKey returns the key of a value's record
+func boltKey(value string) []byte {
+	return []byte(computeSHA256(value))
+}
+
+// boltBackend persists strings to a single embedded database file
+type boltBackend struct {
+	db *bolt.DB
+}
+
+// newBoltBackend opens or creates the database file at path
+func newBoltBackend(path string) (*boltBackend, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltRecordsBucket, boltHashesBucket, boltHitsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		if err := migrateBoltStrings(tx); err != nil {
+			return err
+		}
+		return migrateBoltBinaryKeys(tx)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &boltBackend{db: db}, nil
+}
+
+// migrateBoltStrings moves records keyed by value into the records bucket
+func migrateBoltStrings(tx *bolt.Tx) error {
+	old := tx.Bucket(boltStringsBucket)
+	if old == nil {
+		return nil
+	}
+
+	records := tx.Bucket(boltRecordsBucket)
+	err := old.ForEach(func(value, raw []byte) error {
+		return records.Put(boltKey(string(value)), raw)
+	})
+	if err != nil {
+		return err
+	}
+	return tx.DeleteBucket(boltStringsBucket)
+}
+
+// migrateBoltBinaryKeys rekeys binary records written before their values
+// had binaryKeyPrefix, moving their hit counts and hash index entries along
+func migrateBoltBinaryKeys(tx *bolt.Tx) error {
+	records := tx.Bucket(boltRecordsBucket)
+
+	var legacy []*StringData
+	err := records.ForEach(func(key, raw []byte) error {
+		var data StringData
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return err
+		}
+		if data.Encoding == encodingBase64 && !bytes.Equal(key, boltKey(data.Value)) {
+			legacy = append(legacy, &data)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	hitsBucket, hashesBucket := tx.Bucket(boltHitsBucket), tx.Bucket(boltHashesBucket)
+	for _, data := range legacy {
+		oldKey, newKey := boltKey(displayValue(data.Value)), boltKey(data.Value)
+		raw := append([]byte(nil), records.Get(oldKey)...)
+		if err := records.Put(newKey, raw); err != nil {
+			return err
+		}
+		if err := records.Delete(oldKey); err != nil {
+			return err
+		}
+		if count := hitsBucket.Get(oldKey); count != nil {
+			if err := hitsBucket.Put(newKey, append([]byte(nil), count...)); err != nil {
+				return err
+			}
+			if err := hitsBucket.Delete(oldKey); err != nil {
+				return err
+			}
+		}
+		if data.Properties.SHA256Hash != "" {
+			if err := hashesBucket.Put([]byte(data.Properties.SHA256Hash), []byte(data.Value)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// HotRecords returns up to n unexpired records, most loaded first
+func (b *boltBackend) HotRecords(ctx context.Context, n int) ([]*StringData, error) {
+	records, err := b.AllRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	hits := make(map[string]uint64)
+	err = b.db.View(func(tx *bolt.Tx) error {
+		hitsBucket := tx.Bucket(boltHitsBucket)
+		for _, data := range records {
+			if count := hitsBucket.Get(boltKey(data.Value)); len(count) == 8 {
+				hits[data.Value] = binary.BigEndian.Uint64(count)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return hits[records[i].Value] > hits[records[j].Value]
+	})
+	if len(records) > n {
+		records = records[:n]
+	}
+
+	return records, nil
+}
+
+// AllRecords returns every unexpired record
+func (b *boltBackend) AllRecords(ctx context.Context) ([]*StringData, error) {
+	var records []*StringData
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		now := time.Now()
+
+		return tx.Bucket(boltRecordsBucket).ForEach(func(_, raw []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			var data StringData
+			if err := json.Unmarshal(raw, &data); err != nil {
+				return err
+			}
+			if data.expired(now) {
+				return nil
+			}
+			records = append(records, &data)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// Load fetches a record by value and counts the access towards its hotness
+func (b *boltBackend) Load(ctx context.Context, value string) (*StringData, error) {
+	var data *StringData
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(boltRecordsBucket).Get(boltKey(value))
+		if raw == nil {
+			return nil
+		}
+		data = &StringData{}
+		return json.Unmarshal(raw, data)
+	})
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	if data.expired(time.Now()) {
+		return nil, b.Delete(ctx, value)
+	}
+
+	err = b.db.Batch(func(tx *bolt.Tx) error {
+		hitsBucket := tx.Bucket(boltHitsBucket)
+		key := boltKey(value)
+
+		var count uint64
+		if raw := hitsBucket.Get(key); len(raw) == 8 {
+			count = binary.BigEndian.Uint64(raw)
+		}
+		return hitsBucket.Put(key, binary.BigEndian.AppendUint64(nil, count+1))
+	})
+
+	return data, err
+}
+
+// LoadByHash fetches a record through the hash index
+func (b *boltBackend) LoadByHash(ctx context.Context, hash string) (*StringData, error) {
+	var value []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(boltHashesBucket).Get([]byte(hash)); v != nil {
+			value = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	return b.Load(ctx, string(value))
+}
+
+// Save writes a record and its hash index entry
+func (b *boltBackend) Save(ctx context.Context, data *StringData) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(boltRecordsBucket).Put(boltKey(data.Value), encoded); err != nil {
+			return err
+		}
+		// Records created under another HASH_ALGORITHM have no sha256_hash
+		if data.Properties.SHA256Hash == "" {
+			return nil
+		}
+		return tx.Bucket(boltHashesBucket).Put([]byte(data.Properties.SHA256Hash), []byte(data.Value))
+	})
+}
+
+// Delete removes a record with its hash index entry and hit count
+func (b *boltBackend) Delete(ctx context.Context, value string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltRecordsBucket)
+		raw := bucket.Get(boltKey(value))
+		if raw == nil {
+			return nil
+		}
+
+		// The stored hash covers the raw bytes, not the base64 key, of binary
+		// values, so it is read from the record
+		var data StringData
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return err
+		}
+		if err := bucket.Delete(boltKey(value)); err != nil {
+			return err
+		}
+		if data.Properties.SHA256Hash != "" {
+			if err := tx.Bucket(boltHashesBucket).Delete([]byte(data.Properties.SHA256Hash)); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(boltHitsBucket).Delete(boltKey(value))
+	})
+}
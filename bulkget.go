@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// BulkGetRequest represents the request body for POST /strings/bulk-get
+type BulkGetRequest struct {
+	IDs    []string `json:"ids"`
+	Values []string `json:"values"`
+}
+
+// BulkGetResponse holds the records found and the keys that were not
+type BulkGetResponse struct {
+	Data          []StringData `json:"data"`
+	Count         int          `json:"count"`
+	MissingIDs    []string     `json:"missing_ids"`
+	MissingValues []string     `json:"missing_values"`
+}
+
+// bulkGetStrings handles POST /strings/bulk-get, fetching up to
+// MAX_BATCH_SIZE strings by ID or value in one round trip
+func bulkGetStrings(c *fiber.Ctx) error {
+	var req BulkGetRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	requested := len(req.IDs) + len(req.Values)
+	if requested == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Missing 'ids' or 'values' field")
+	}
+	if config.MaxBatchSize > 0 && requested > config.MaxBatchSize {
+		return fiber.NewError(fiber.StatusRequestEntityTooLarge, fmt.Sprintf("At most %d ids and values may be requested at once", config.MaxBatchSize))
+	}
+
+	response := BulkGetResponse{
+		Data:          []StringData{},
+		MissingIDs:    []string{},
+		MissingValues: []string{},
+	}
+	now := time.Now()
+
+	byID := lookupIDs(req.IDs)
+	for _, id := range req.IDs {
+		data, ok := byID[id]
+		if !ok || data.expired(now) {
+			response.MissingIDs = append(response.MissingIDs, id)
+			continue
+		}
+		response.Data = append(response.Data, *data)
+	}
+
+	var cold []string
+	for _, value := range req.Values {
+		data, ok := lookup(value)
+		if !ok || data.expired(now) {
+			cold = append(cold, value)
+			continue
+		}
+		response.Data = append(response.Data, *data)
+	}
+
+	// Values missing from memory may still be in the backend
+	for _, value := range cold {
+		data, err := loadCold(c.UserContext(), value)
+		if err != nil {
+			return err
+		}
+		if data == nil {
+			response.MissingValues = append(response.MissingValues, value)
+			continue
+		}
+		response.Data = append(response.Data, *data)
+	}
+
+	response.Count = len(response.Data)
+
+	return c.JSON(response)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// encodingBase64 marks records whose value holds base64-encoded raw bytes
+const encodingBase64 = "base64"
+
+// binaryKeyPrefix starts the stored value of binary records, so the bytes
+// "hi" and the text "aGk=" are different strings. U+FFFF is a
+// noncharacter, and text values may not start with it. Clients only ever
+// see the base64 after it.
+const binaryKeyPrefix = "\uffff"
+
+// ByteAnalysis holds properties computed over the raw bytes of a binary value
+type ByteAnalysis struct {
+	ByteFrequency  map[string]int `json:"byte_frequency"`
+	PrintableRatio float64        `json:"printable_ratio"`
+	MagicType      string         `json:"magic_type,omitempty"`
+}
+
+// magicNumber identifies a file format by its leading bytes
+type magicNumber struct {
+	name   string
+	offset int
+	prefix []byte
+}
+
+var magicNumbers = []magicNumber{
+	{"png", 0, []byte("\x89PNG\r\n\x1a\n")},
+	{"jpeg", 0, []byte{0xFF, 0xD8, 0xFF}},
+	{"gif", 0, []byte("GIF8")},
+	{"bmp", 0, []byte("BM")},
+	{"webp", 8, []byte("WEBP")},
+	{"pdf", 0, []byte("%PDF-")},
+	{"zip", 0, []byte("PK\x03\x04")},
+	{"gzip", 0, []byte{0x1F, 0x8B}},
+	{"bzip2", 0, []byte("BZh")},
+	{"7z", 0, []byte("7z\xBC\xAF\x27\x1C")},
+	{"elf", 0, []byte("\x7fELF")},
+	{"pe", 0, []byte("MZ")},
+	{"wasm", 0, []byte("\x00asm")},
+	{"mp3", 0, []byte("ID3")},
+	{"ogg", 0, []byte("OggS")},
+}
+
+// decodeBinaryValue decodes a base64 value and returns the raw bytes with
+// their storage key, binaryKey of the canonical base64 form
+func decodeBinaryValue(encoded string) (string, string, error) {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", fiber.NewError(fiber.StatusBadRequest, "'value_base64' is not valid base64")
+	}
+	if len(raw) == 0 {
+		return "", "", fiber.NewError(fiber.StatusBadRequest, "'value_base64' decodes to an empty value")
+	}
+	return string(raw), binaryKey(base64.StdEncoding.EncodeToString(raw)), nil
+}
+
+// binaryKey returns the stored value of the binary record with this base64
+func binaryKey(encoded string) string {
+	return binaryKeyPrefix + encoded
+}
+
+// displayValue returns a stored value as clients see it: binary values as
+// their bare base64
+func displayValue(value string) string {
+	return strings.TrimPrefix(value, binaryKeyPrefix)
+}
+
+// rawValue returns the value a record was analyzed from, decoding base64 records
+func rawValue(data *StringData) string {
+	if data.Encoding == encodingBase64 {
+		if raw, err := base64.StdEncoding.DecodeString(displayValue(data.Value)); err == nil {
+			return string(raw)
+		}
+	}
+	return data.Value
+}
+
+// stringDataJSON is StringData without its JSON methods
+type stringDataJSON StringData
+
+// MarshalJSON writes binary values as their bare base64
+func (d StringData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.public())
+}
+
+// UnmarshalJSON reads binary values back into their stored form, whether
+// written with or without binaryKeyPrefix
+func (d *StringData) UnmarshalJSON(b []byte) error {
+	var decoded stringDataJSON
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		return err
+	}
+	if decoded.Encoding == encodingBase64 && !strings.HasPrefix(decoded.Value, binaryKeyPrefix) {
+		decoded.Value = binaryKey(decoded.Value)
+	}
+	*d = StringData(decoded)
+	return nil
+}
+
+// public returns a copy of the record as clients see it, for types that
+// embed a record and so need their own MarshalJSON
+func (d *StringData) public() *stringDataJSON {
+	if d == nil {
+		return nil
+	}
+	public := stringDataJSON(*d)
+	public.Value = displayValue(d.Value)
+	return &public
+}
+
+// analyzeBytes computes byte-level properties of a binary value
+func analyzeBytes(raw string) *ByteAnalysis {
+	analysis := &ByteAnalysis{ByteFrequency: make(map[string]int)}
+
+	printable := 0
+	for i := 0; i < len(raw); i++ {
+		b := raw[i]
+		analysis.ByteFrequency[fmt.Sprintf("%02x", b)]++
+		if b < unicode.MaxASCII && (unicode.IsPrint(rune(b)) || b == '\n' || b == '\r' || b == '\t') {
+			printable++
+		}
+	}
+	analysis.PrintableRatio = float64(printable) / float64(len(raw))
+
+	for _, magic := range magicNumbers {
+		if len(raw) >= magic.offset+len(magic.prefix) && bytes.Equal([]byte(raw[magic.offset:magic.offset+len(magic.prefix)]), magic.prefix) {
+			analysis.MagicType = magic.name
+			break
+		}
+	}
+
+	return analysis
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"unicode"
+)
+
+// isVowel reports whether r is one of the ASCII vowels, either case
+func isVowel(r rune) bool {
+	return strings.ContainsRune("aeiouAEIOU", r)
+}
+
+// isConsonant reports whether r is an ASCII letter other than a vowel
+func isConsonant(r rune) bool {
+	return r < unicode.MaxASCII && unicode.IsLetter(r) && !isVowel(r)
+}
+
+// analyzeCharacterClasses counts the vowels, consonants, upper and
+// lowercase letters and digits of a value. Upper and lowercase cover
+// every script; vowels and consonants are ASCII only.
+func analyzeCharacterClasses(_ context.Context, value string, p *StringProperties, _ *analysisProfile) {
+	for _, r := range value {
+		switch {
+		case isVowel(r):
+			p.VowelCount++
+		case isConsonant(r):
+			p.ConsonantCount++
+		}
+		switch {
+		case unicode.IsUpper(r):
+			p.UppercaseCount++
+		case unicode.IsLower(r):
+			p.LowercaseCount++
+		case unicode.IsDigit(r):
+			p.DigitCount++
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"strings"
+	"unicode"
+)
+
+//go:embed wordlists/en.txt
+var englishWordList string
+
+// englishWords is the dictionary used to recognise ROT13-encoded words
+var englishWords = func() map[string]bool {
+	words := make(map[string]bool)
+	for _, word := range strings.Fields(englishWordList) {
+		words[word] = true
+	}
+	return words
+}()
+
+// caesarShift rotates ASCII letters by shift places, leaving everything else untouched
+func caesarShift(s string, shift int) string {
+	shift = ((shift % 26) + 26) % 26
+
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return 'a' + (r-'a'+rune(shift))%26
+		case r >= 'A' && r <= 'Z':
+			return 'A' + (r-'A'+rune(shift))%26
+		default:
+			return r
+		}
+	}, s)
+}
+
+// rot13 is the self-inverse Caesar shift of 13
+func rot13(s string) string {
+	return caesarShift(s, 13)
+}
+
+// allEnglishWords reports whether every word of s is in the English word list
+func allEnglishWords(s string) bool {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	if len(words) == 0 {
+		return false
+	}
+
+	for _, word := range words {
+		if !englishWords[word] {
+			return false
+		}
+	}
+	return true
+}
+
+// analyzeROT13 flags values that read as English only after ROT13 decoding
+func analyzeROT13(_ context.Context, value string, properties *StringProperties, _ *analysisProfile) {
+	decoded := rot13(value)
+	if allEnglishWords(decoded) && !allEnglishWords(value) {
+		properties.IsROT13 = true
+		properties.ROT13Decoded = decoded
+	}
+}
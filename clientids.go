@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxClientIDLength caps the length of a client-supplied ID
+const maxClientIDLength = 128
+
+var errClientIDTaken = fiber.NewError(fiber.StatusConflict, "ID is already used by another string")
+
+// clientIDMu is held by creates with a client-supplied ID from checking the
+// ID is free until the record is stored, so two values cannot claim it
+var clientIDMu sync.Mutex
+
+// validateClientID checks an ID sent on create: 1 to 128 URL-safe
+// characters (letters, digits, '.', '_', '~' and '-'), and not 64
+// hexadecimal ones, which lookups take for a SHA-256
+func validateClientID(id string) error {
+	if id == "" || len(id) > maxClientIDLength {
+		return fiber.NewError(fiber.StatusBadRequest, "'id' must be 1 to 128 characters")
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("._~-", r)) {
+			return fiber.NewError(fiber.StatusBadRequest, "'id' may only contain letters, digits, '.', '_', '~' and '-'")
+		}
+	}
+	if len(id) == 64 && isHexPrefix(strings.ToLower(id)) {
+		return fiber.NewError(fiber.StatusBadRequest, "'id' must not look like a SHA-256")
+	}
+	return nil
+}
+
+// clientIDOwner returns the value of the live or soft-deleted string with
+// an ID, and whether there is one
+func clientIDOwner(id string) (string, bool) {
+	for _, shard := range shards {
+		shard.RLock()
+		value, ok := shard.idOwnerLocked(id)
+		shard.RUnlock()
+		if ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// idOwnerLocked returns the value of the shard's live or soft-deleted
+// string with an ID. Caller must hold the shard lock.
+func (s *storeShard) idOwnerLocked(id string) (string, bool) {
+	if value, ok := s.ids[id]; ok {
+		return value, true
+	}
+	value, ok := s.deletedIDs[id]
+	return value, ok
+}
+
+// clientIDOwnerLocked is clientIDOwner for callers holding every shard lock
+func clientIDOwnerLocked(id string) (string, bool) {
+	for _, shard := range shards {
+		if value, ok := shard.idOwnerLocked(id); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
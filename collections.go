@@ -0,0 +1,477 @@
+package main
+
+import (
+	"log"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Collection is a namespace of strings stored independently of the main
+// store and of each other, so projects can store the same value without
+// conflicting. Analysis is the collection's own analysis config; without
+// one, its strings are analyzed with the service-wide config.
+type Collection struct {
+	Name      string          `json:"name"`
+	CreatedAt time.Time       `json:"created_at"`
+	Count     int             `json:"count"`
+	Analysis  *AnalysisConfig `json:"analysis,omitempty"`
+}
+
+// CreateCollectionRequest represents the request body for POST /collections
+type CreateCollectionRequest struct {
+	Name     string          `json:"name"`
+	Analysis *AnalysisConfig `json:"analysis,omitempty"`
+}
+
+// CollectionsResponse represents the response for GET /collections
+type CollectionsResponse struct {
+	Collections []Collection `json:"collections"`
+	Count       int          `json:"count"`
+}
+
+// CollectionSnapshot is the on-disk form of a collection
+type CollectionSnapshot struct {
+	Name      string          `json:"name"`
+	CreatedAt time.Time       `json:"created_at"`
+	Analysis  *AnalysisConfig `json:"analysis,omitempty"`
+	Strings   []*StringData   `json:"strings"`
+}
+
+// collection holds the strings of one collection, keyed by value
+type collection struct {
+	sync.RWMutex
+	name      string
+	createdAt time.Time
+	// profile analyzes the collection's strings, or is nil to use
+	// defaultProfile
+	profile *analysisProfile
+	records map[string]*StringData
+	// dropped is set once the collection is deleted, so writers still
+	// holding it fail instead of logging writes to it
+	dropped bool
+}
+
+// collections holds every collection by name. Code needing both locks takes
+// the registry's first.
+var collections = struct {
+	sync.RWMutex
+	byName map[string]*collection
+}{byName: make(map[string]*collection)}
+
+// collectionNamePattern keeps names usable in URLs
+var collectionNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// createCollection handles POST /collections
+func createCollection(c *fiber.Ctx) error {
+	var req CreateCollectionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if !collectionNamePattern.MatchString(req.Name) {
+		return fiber.NewError(fiber.StatusBadRequest, "Name must be 1 to 64 lowercase letters, digits, '-' and '_', starting with a letter or digit")
+	}
+
+	var profile *analysisProfile
+	if req.Analysis != nil {
+		var err error
+		if profile, err = newAnalysisProfile(*req.Analysis); err != nil {
+			return fiber.NewError(fiber.StatusUnprocessableEntity, err.Error())
+		}
+	}
+
+	createdAt := time.Now().UTC()
+
+	collections.Lock()
+	defer collections.Unlock()
+
+	if _, exists := collections.byName[req.Name]; exists {
+		return fiber.NewError(fiber.StatusConflict, "Collection already exists")
+	}
+	col := newCollection(req.Name, createdAt, profile)
+	collections.byName[req.Name] = col
+	writeWAL(walEntry{Op: walCreateCollection, Collection: req.Name, At: &createdAt, Analysis: col.analysisConfig()})
+
+	c.Location("/collections/" + req.Name)
+	return c.Status(fiber.StatusCreated).JSON(col.describe())
+}
+
+// getCollections handles GET /collections
+func getCollections(c *fiber.Ctx) error {
+	collections.RLock()
+	list := make([]*collection, 0, len(collections.byName))
+	for _, col := range collections.byName {
+		list = append(list, col)
+	}
+	collections.RUnlock()
+
+	response := CollectionsResponse{Collections: make([]Collection, 0, len(list))}
+	for _, col := range list {
+		response.Collections = append(response.Collections, col.describe())
+	}
+	sort.Slice(response.Collections, func(i, j int) bool {
+		return response.Collections[i].Name < response.Collections[j].Name
+	})
+	response.Count = len(response.Collections)
+
+	return c.JSON(response)
+}
+
+// getCollection handles GET /collections/:name
+func getCollection(c *fiber.Ctx) error {
+	col, err := findCollection(c.Params("name"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(col.describe())
+}
+
+// deleteCollection handles DELETE /collections/:name, deleting the
+// collection with all its strings
+func deleteCollection(c *fiber.Ctx) error {
+	collections.Lock()
+	defer collections.Unlock()
+
+	col, exists := collections.byName[c.Params("name")]
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "Collection does not exist")
+	}
+	delete(collections.byName, col.name)
+
+	col.Lock()
+	col.dropped = true
+	writeWAL(walEntry{Op: walDropCollection, Collection: col.name})
+	col.Unlock()
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// createCollectionString handles POST /collections/:name/strings, taking the
+// same body as POST /strings. Values only conflict with the same value in
+// the same collection.
+func createCollectionString(c *fiber.Ctx) error {
+	var req CreateStringRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	if req.ID != "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Strings in collections cannot have a client-supplied 'id'")
+	}
+
+	col, err := findCollection(c.Params("name"))
+	if err != nil {
+		return err
+	}
+
+	// Analyze without storing
+	result, err := createValue(c.UserContext(), req, createOptions{
+		duplicatePolicy: duplicatePolicyOff,
+		onConflict:      onConflictReplace,
+		validateOnly:    true,
+		profile:         col.profile,
+		forCollection:   true,
+	})
+	if e, ok := err.(*createError); ok {
+		return c.Status(e.status).JSON(e.body)
+	}
+	if err != nil {
+		return err
+	}
+
+	data := result.data
+	data.Collection = col.name
+	data.UpdatedAt = data.CreatedAt
+
+	col.Lock()
+	defer col.Unlock()
+
+	if col.dropped {
+		return fiber.NewError(fiber.StatusNotFound, "Collection does not exist")
+	}
+	if existing := col.records[data.Value]; existing != nil && !existing.expired(time.Now()) {
+		return fiber.NewError(fiber.StatusConflict, "String already exists in the collection")
+	}
+	col.putLocked(data)
+
+	return c.Status(fiber.StatusCreated).JSON(data)
+}
+
+// getCollectionStrings handles GET /collections/:name/strings, accepting the
+// filters of GET /strings
+func getCollectionStrings(c *fiber.Ctx) error {
+	col, err := findCollection(c.Params("name"))
+	if err != nil {
+		return err
+	}
+
+	filters, err := parseQueryFilters(c)
+	if err != nil {
+		return err
+	}
+	plan := planFilters(filters)
+
+	now := time.Now()
+	filtered := []StringData{}
+	truncated := false
+
+	col.RLock()
+	for _, data := range col.records {
+		if !data.expired(now) && plan.matches(data) {
+			filtered = append(filtered, *data)
+		}
+	}
+	col.RUnlock()
+
+	// Sorted before truncating, so a capped listing is always the same one
+	sort.Slice(filtered, func(i, j int) bool { return filtered[i].Value < filtered[j].Value })
+	if config.MaxResults > 0 && len(filtered) > config.MaxResults {
+		filtered, truncated = filtered[:config.MaxResults], true
+	}
+
+	return c.JSON(GetAllStringsResponse{
+		Data:           filtered,
+		Count:          len(filtered),
+		FiltersApplied: filters,
+		Truncated:      truncated,
+	})
+}
+
+// getCollectionString handles GET /collections/:name/strings/:string_value
+func getCollectionString(c *fiber.Ctx) error {
+	col, err := findCollection(c.Params("name"))
+	if err != nil {
+		return err
+	}
+
+	col.RLock()
+	data := col.records[c.Params("string_value")]
+	col.RUnlock()
+
+	if data == nil || data.expired(time.Now()) {
+		return fiber.NewError(fiber.StatusNotFound, "String does not exist in the collection")
+	}
+	return c.JSON(data)
+}
+
+// deleteCollectionString handles DELETE /collections/:name/strings/:string_value
+func deleteCollectionString(c *fiber.Ctx) error {
+	col, err := findCollection(c.Params("name"))
+	if err != nil {
+		return err
+	}
+
+	col.Lock()
+	defer col.Unlock()
+
+	value := c.Params("string_value")
+	if _, exists := col.records[value]; !exists || col.dropped {
+		return fiber.NewError(fiber.StatusNotFound, "String does not exist in the collection")
+	}
+	col.removeLocked(value)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// findCollection looks a collection up by name
+func findCollection(name string) (*collection, error) {
+	collections.RLock()
+	defer collections.RUnlock()
+
+	col, exists := collections.byName[name]
+	if !exists {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Collection does not exist")
+	}
+	return col, nil
+}
+
+func newCollection(name string, createdAt time.Time, profile *analysisProfile) *collection {
+	return &collection{name: name, createdAt: createdAt, profile: profile, records: make(map[string]*StringData)}
+}
+
+// restoredProfile rebuilds a collection's analysis profile from a snapshot
+// or the WAL. A config no longer valid, say naming an analyzer since
+// removed, falls back to the service-wide one.
+func restoredProfile(name string, cfg *AnalysisConfig) *analysisProfile {
+	if cfg == nil {
+		return nil
+	}
+	profile, err := newAnalysisProfile(*cfg)
+	if err != nil {
+		log.Printf("collection %s: invalid analysis config, using the service-wide one: %v", name, err)
+		return nil
+	}
+	return profile
+}
+
+// analysisConfig returns the collection's own analysis config, or nil
+func (col *collection) analysisConfig() *AnalysisConfig {
+	if col.profile == nil {
+		return nil
+	}
+	cfg := col.profile.config
+	return &cfg
+}
+
+// describe summarizes a collection for responses
+func (col *collection) describe() Collection {
+	col.RLock()
+	defer col.RUnlock()
+
+	return Collection{Name: col.name, CreatedAt: col.createdAt, Count: len(col.records), Analysis: col.analysisConfig()}
+}
+
+// putLocked stores a string in the collection and logs it to the WAL.
+// Caller must hold the collection lock.
+func (col *collection) putLocked(data *StringData) {
+	col.records[data.Value] = data
+	writeWAL(walEntry{Op: walPut, Collection: col.name, Value: data.Value, Record: data})
+}
+
+// removeLocked deletes a string from the collection and logs it to the WAL.
+// Caller must hold the collection lock.
+func (col *collection) removeLocked(value string) {
+	delete(col.records, value)
+	writeWAL(walEntry{Op: walDelete, Collection: col.name, Value: value})
+}
+
+// sweepExpiredLocked removes the collection's strings expired at now and
+// returns how many it removed. Caller must hold the collection lock.
+func (col *collection) sweepExpiredLocked(now time.Time) int {
+	swept := 0
+	for value, data := range col.records {
+		if data.expired(now) {
+			col.removeLocked(value)
+			swept++
+		}
+	}
+	return swept
+}
+
+// snapshotCollections copies every collection for a snapshot, one at a time
+func snapshotCollections() []CollectionSnapshot {
+	collections.RLock()
+	defer collections.RUnlock()
+
+	snapshots := make([]CollectionSnapshot, 0, len(collections.byName))
+	for _, col := range collections.byName {
+		col.RLock()
+		snapshot := CollectionSnapshot{
+			Name:      col.name,
+			CreatedAt: col.createdAt,
+			Analysis:  col.analysisConfig(),
+			Strings:   make([]*StringData, 0, len(col.records)),
+		}
+		for _, data := range col.records {
+			snapshot.Strings = append(snapshot.Strings, data)
+		}
+		col.RUnlock()
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots
+}
+
+// restoreCollections loads collections from a snapshot, skipping strings
+// that expired while the service was down
+func restoreCollections(snapshots []CollectionSnapshot, now time.Time) {
+	collections.Lock()
+	defer collections.Unlock()
+
+	for _, snapshot := range snapshots {
+		col := newCollection(snapshot.Name, snapshot.CreatedAt, restoredProfile(snapshot.Name, snapshot.Analysis))
+		for _, data := range snapshot.Strings {
+			if !data.expired(now) {
+				col.records[data.Value] = data
+			}
+		}
+		collections.byName[col.name] = col
+	}
+}
+
+// collectionConflictLocked finds a string of snapshots already live in an
+// existing collection. Caller must hold the registry lock.
+func collectionConflictLocked(snapshots []CollectionSnapshot) (string, string, bool) {
+	now := time.Now()
+	for _, snapshot := range snapshots {
+		col, exists := collections.byName[snapshot.Name]
+		if !exists {
+			continue
+		}
+		col.RLock()
+		for _, data := range snapshot.Strings {
+			if existing := col.records[data.Value]; existing != nil && !existing.expired(now) {
+				col.RUnlock()
+				return snapshot.Name, data.Value, true
+			}
+		}
+		col.RUnlock()
+	}
+	return "", "", false
+}
+
+// restoreBackupCollectionsLocked loads collections from a backup, creating
+// those missing, and counts the strings restored, skipped and overwritten.
+// Existing collections keep their analysis config. Caller must hold the
+// registry lock.
+func restoreBackupCollectionsLocked(snapshots []CollectionSnapshot, skipExisting bool, response *RestoreResponse) {
+	now := time.Now()
+	for _, snapshot := range snapshots {
+		col, exists := collections.byName[snapshot.Name]
+		if !exists {
+			col = newCollection(snapshot.Name, snapshot.CreatedAt, restoredProfile(snapshot.Name, snapshot.Analysis))
+			collections.byName[col.name] = col
+			createdAt := snapshot.CreatedAt
+			writeWAL(walEntry{Op: walCreateCollection, Collection: col.name, At: &createdAt, Analysis: col.analysisConfig()})
+		}
+
+		col.Lock()
+		for _, data := range snapshot.Strings {
+			if existing := col.records[data.Value]; existing != nil && !existing.expired(now) {
+				if skipExisting {
+					response.Skipped++
+					continue
+				}
+				response.Overwritten++
+			} else {
+				response.Restored++
+			}
+			col.putLocked(data)
+		}
+		col.Unlock()
+	}
+}
+
+// replayCollectionEntry applies a WAL entry for a collection. Writes to a
+// collection that no longer exists are ignored.
+func replayCollectionEntry(entry walEntry) {
+	collections.Lock()
+	defer collections.Unlock()
+
+	switch entry.Op {
+	case walCreateCollection:
+		createdAt := time.Time{}
+		if entry.At != nil {
+			createdAt = *entry.At
+		}
+		collections.byName[entry.Collection] = newCollection(entry.Collection, createdAt, restoredProfile(entry.Collection, entry.Analysis))
+	case walDropCollection:
+		delete(collections.byName, entry.Collection)
+	case walPut, walDelete:
+		col, exists := collections.byName[entry.Collection]
+		if !exists {
+			return
+		}
+		if entry.Op == walPut && entry.Record != nil {
+			col.records[entry.Value] = entry.Record
+		} else {
+			delete(col.records, legacyBinaryValue(entry.Value, func(value string) bool {
+				_, stored := col.records[value]
+				return stored
+			}))
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"math"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CompareRequest represents the request body for POST /compare
+type CompareRequest struct {
+	Value     string `json:"value"`
+	Reference string `json:"reference"`
+}
+
+// CompareResponse reports how far a value is from a reference
+type CompareResponse struct {
+	Value            string  `json:"value"`
+	Reference        string  `json:"reference"`
+	EditDistance     int     `json:"edit_distance"`
+	KeyboardDistance float64 `json:"keyboard_distance"`
+	TypoPlausibility float64 `json:"typo_plausibility"`
+}
+
+// adjacentKeyCost is the substitution cost between neighbouring QWERTY keys
+const adjacentKeyCost = 0.5
+
+// qwertyRows lays out the QWERTY keyboard; each row sits half a key further right
+var qwertyRows = []string{
+	"1234567890-=",
+	"qwertyuiop[]",
+	"asdfghjkl;'",
+	"zxcvbnm,./",
+}
+
+// keyPositions maps each key to its row and column on the keyboard
+var keyPositions = func() map[rune][2]float64 {
+	positions := make(map[rune][2]float64)
+	for row, keys := range qwertyRows {
+		for col, key := range keys {
+			positions[key] = [2]float64{float64(row), float64(col) + float64(row)*0.5}
+		}
+	}
+	return positions
+}()
+
+// keysAdjacent reports whether two keys touch on a QWERTY keyboard
+func keysAdjacent(a, b rune) bool {
+	pa, okA := keyPositions[unicode.ToLower(a)]
+	pb, okB := keyPositions[unicode.ToLower(b)]
+	if !okA || !okB {
+		return false
+	}
+	return math.Abs(pa[0]-pb[0]) <= 1 && math.Abs(pa[1]-pb[1]) <= 1
+}
+
+// substitutionCost weighs replacing a with b, cheaper for neighbouring keys
+func substitutionCost(a, b rune) float64 {
+	switch {
+	case a == b:
+		return 0
+	case unicode.ToLower(a) == unicode.ToLower(b):
+		return adjacentKeyCost
+	case keysAdjacent(a, b):
+		return adjacentKeyCost
+	default:
+		return 1
+	}
+}
+
+// editDistance computes the Levenshtein distance between two strings in runes
+func editDistance(a, b string) int {
+	distance := weightedEditDistance(a, b, func(x, y rune) float64 {
+		if x == y {
+			return 0
+		}
+		return 1
+	})
+	return int(distance)
+}
+
+// keyboardDistance computes an edit distance where typos on neighbouring keys cost less
+func keyboardDistance(a, b string) float64 {
+	return weightedEditDistance(a, b, substitutionCost)
+}
+
+// weightedEditDistance is Levenshtein distance with a custom substitution cost
+func weightedEditDistance(a, b string, cost func(x, y rune) float64) float64 {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]float64, len(rb)+1)
+	curr := make([]float64, len(rb)+1)
+
+	for j := range prev {
+		prev[j] = float64(j)
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = float64(i)
+		for j := 1; j <= len(rb); j++ {
+			curr[j] = math.Min(
+				math.Min(prev[j]+1, curr[j-1]+1),
+				prev[j-1]+cost(ra[i-1], rb[j-1]),
+			)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+// typoPlausibility scores from 0 to 1 how likely value is a mistyped reference
+func typoPlausibility(value, reference string) float64 {
+	longest := math.Max(float64(len([]rune(value))), float64(len([]rune(reference))))
+	if longest == 0 {
+		return 1
+	}
+	return math.Max(0, 1-keyboardDistance(value, reference)/longest)
+}
+
+// compareStrings handles POST /compare
+func compareStrings(c *fiber.Ctx) error {
+	var req CompareRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	if req.Value == "" || req.Reference == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Both 'value' and 'reference' are required")
+	}
+
+	return c.JSON(CompareResponse{
+		Value:            req.Value,
+		Reference:        req.Reference,
+		EditDistance:     editDistance(req.Value, req.Reference),
+		KeyboardDistance: keyboardDistance(req.Value, req.Reference),
+		TypoPlausibility: math.Round(typoPlausibility(req.Value, req.Reference)*1000) / 1000,
+	})
+}
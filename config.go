@@ -0,0 +1,201 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config holds runtime settings read from the environment
+type Config struct {
+	Port                string
+	AdminPort           string
+	MetricsPort         string
+	UnixSocket          string
+	UnixSocketMode      string
+	UnixSocketOnly      bool
+	WarmupRecords       int
+	MaxResults          int
+	PageSize            int
+	MaxBatchSize        int
+	RequestTimeout      time.Duration
+	FaultInjection      bool
+	ShutdownTimeout     time.Duration
+	HashAlgorithm       string
+	AdminToken          string
+	AdminSigningSecret  string
+	AdminSigningMaxSkew time.Duration
+	DuplicatePolicy     string
+	DefaultLanguage     string
+	LanguagePacksDir    string
+	Tokenizer           string
+	OptionalAnalyzers   string
+	SentimentProvider   string
+	SentimentURL        string
+	SentimentTimeout    time.Duration
+	EventLogSize        int
+	WebhookURLs         string
+	StorageBackend      string
+	RedisURL            string
+	BoltPath            string
+	SnapshotPath        string
+	SnapshotInterval    time.Duration
+	FilterPresets       string
+	NLPhrases           string
+	ContentPolicy       string
+	SeedStrings         string
+	WALPath             string
+	BackupS3Endpoint    string
+	BackupS3Bucket      string
+	BackupS3Prefix      string
+	BackupS3Region      string
+	BackupS3AccessKey   string
+	BackupS3SecretKey   string
+	BackupInterval      time.Duration
+	BackupRetention     int
+	MaxEntries          int
+	MaxBytes            int
+	EvictionPolicy      string
+	ExportDir           string
+	ExportTTL           time.Duration
+	ImportDir           string
+	ImportTTL           time.Duration
+	QueryFeedbackPath   string
+	RecordRequests      string
+	RecordValues        bool
+	ExpirySweepInterval time.Duration
+	QueryHistorySize    int
+	DemoMode            bool
+	DemoWriteLimit      int
+	DemoWriteWindow     time.Duration
+	DemoTTL             time.Duration
+	DemoBanner          string
+	ShareSecret         string
+	PseudonymizeSecret  string
+	IdempotencyTTL      time.Duration
+	RequireIfMatch      bool
+	AbuseDetection      bool
+	AbuseWindow         time.Duration
+	AbuseBanDuration    time.Duration
+	AbuseRepeatLimit    int
+	AbuseMaxBodyBytes   int
+	AbuseOversizedLimit int
+	AbuseNotFoundLimit  int
+}
+
+// config is loaded once at startup
+var config = loadConfig()
+
+// loadConfig reads the configuration from environment variables, falling back to defaults
+func loadConfig() Config {
+	return Config{
+		Port:                envString("PORT", "8000"),
+		AdminPort:           envString("ADMIN_PORT", ""),
+		MetricsPort:         envString("METRICS_PORT", ""),
+		UnixSocket:          envString("UNIX_SOCKET", ""),
+		UnixSocketMode:      envString("UNIX_SOCKET_MODE", "0660"),
+		UnixSocketOnly:      envBool("UNIX_SOCKET_ONLY", false),
+		WarmupRecords:       envInt("WARMUP_RECORDS", 1000),
+		MaxResults:          envInt("MAX_RESULTS", 1000),
+		PageSize:            envInt("PAGE_SIZE", 100),
+		MaxBatchSize:        envInt("MAX_BATCH_SIZE", 1000),
+		RequestTimeout:      envDuration("REQUEST_TIMEOUT", 30*time.Second),
+		FaultInjection:      envBool("FAULT_INJECTION", false),
+		ShutdownTimeout:     envDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+		HashAlgorithm:       envString("HASH_ALGORITHM", defaultHashAlgorithm),
+		AdminToken:          envString("ADMIN_TOKEN", ""),
+		AdminSigningSecret:  envString("ADMIN_SIGNING_SECRET", ""),
+		AdminSigningMaxSkew: envDuration("ADMIN_SIGNING_MAX_SKEW", 5*time.Minute),
+		DuplicatePolicy:     envString("DUPLICATE_POLICY", duplicatePolicyOff),
+		DefaultLanguage:     envString("DEFAULT_LANGUAGE", "en"),
+		LanguagePacksDir:    envString("LANGUAGE_PACKS_DIR", ""),
+		Tokenizer:           envString("TOKENIZER", "whitespace"),
+		OptionalAnalyzers:   envString("OPTIONAL_ANALYZERS", ""),
+		SentimentProvider:   envString("SENTIMENT_PROVIDER", "lexicon"),
+		SentimentURL:        envString("SENTIMENT_URL", ""),
+		SentimentTimeout:    envDuration("SENTIMENT_TIMEOUT", 2*time.Second),
+		EventLogSize:        envInt("EVENT_LOG_SIZE", 1000),
+		WebhookURLs:         envString("WEBHOOK_URLS", ""),
+		StorageBackend:      envString("STORAGE_BACKEND", "memory"),
+		RedisURL:            envString("REDIS_URL", "redis://localhost:6379/0"),
+		BoltPath:            envString("BOLT_PATH", "strings.db"),
+		SnapshotPath:        envString("SNAPSHOT_PATH", ""),
+		SnapshotInterval:    envDuration("SNAPSHOT_INTERVAL", 5*time.Minute),
+		FilterPresets:       envString("FILTER_PRESETS", ""),
+		NLPhrases:           envString("NL_PHRASES", ""),
+		ContentPolicy:       envString("CONTENT_POLICY", ""),
+		SeedStrings:         envString("SEED_STRINGS", ""),
+		WALPath:             envString("WAL_PATH", ""),
+		BackupS3Endpoint:    envString("BACKUP_S3_ENDPOINT", "https://s3.amazonaws.com"),
+		BackupS3Bucket:      envString("BACKUP_S3_BUCKET", ""),
+		BackupS3Prefix:      envString("BACKUP_S3_PREFIX", "backups/"),
+		BackupS3Region:      envString("BACKUP_S3_REGION", ""),
+		BackupS3AccessKey:   envString("BACKUP_S3_ACCESS_KEY", ""),
+		BackupS3SecretKey:   envString("BACKUP_S3_SECRET_KEY", ""),
+		BackupInterval:      envDuration("BACKUP_INTERVAL", time.Hour),
+		BackupRetention:     envInt("BACKUP_RETENTION", 24),
+		MaxEntries:          envInt("MAX_ENTRIES", 0),
+		MaxBytes:            envInt("MAX_BYTES", 0),
+		EvictionPolicy:      envString("EVICTION_POLICY", evictionLRU),
+		ExportDir:           envString("EXPORT_DIR", ""),
+		ExportTTL:           envDuration("EXPORT_TTL", time.Hour),
+		ImportDir:           envString("IMPORT_DIR", ""),
+		ImportTTL:           envDuration("IMPORT_TTL", 24*time.Hour),
+		QueryFeedbackPath:   envString("QUERY_FEEDBACK_PATH", ""),
+		RecordRequests:      envString("RECORD_REQUESTS", ""),
+		RecordValues:        envBool("RECORD_REQUEST_VALUES", false),
+		ExpirySweepInterval: envDuration("EXPIRY_SWEEP_INTERVAL", time.Minute),
+		QueryHistorySize:    envInt("QUERY_HISTORY_SIZE", 50),
+		DemoMode:            envBool("DEMO_MODE", false),
+		DemoWriteLimit:      envInt("DEMO_WRITE_LIMIT", 10),
+		DemoWriteWindow:     envDuration("DEMO_WRITE_WINDOW", time.Minute),
+		DemoTTL:             envDuration("DEMO_TTL", time.Hour),
+		ShareSecret:         envString("SHARE_SECRET", ""),
+		PseudonymizeSecret:  envString("PSEUDONYMIZE_SECRET", ""),
+		IdempotencyTTL:      envDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+		RequireIfMatch:      envBool("REQUIRE_IF_MATCH", false),
+		AbuseDetection:      envBool("ABUSE_DETECTION", false),
+		AbuseWindow:         envDuration("ABUSE_WINDOW", time.Minute),
+		AbuseBanDuration:    envDuration("ABUSE_BAN_DURATION", 15*time.Minute),
+		AbuseRepeatLimit:    envInt("ABUSE_REPEAT_LIMIT", 20),
+		AbuseMaxBodyBytes:   envInt("ABUSE_MAX_BODY_BYTES", 1<<20),
+		AbuseOversizedLimit: envInt("ABUSE_OVERSIZED_LIMIT", 3),
+		AbuseNotFoundLimit:  envInt("ABUSE_NOT_FOUND_LIMIT", 50),
+		DemoBanner:          envString("DEMO_BANNER", "This is a public demo: strings are deleted automatically and writes are rate limited. Do not store anything sensitive."),
+	}
+}
+
+// envString returns the value of an environment variable or a default
+func envString(key, fallback string) string {
+	if val, ok := os.LookupEnv(key); ok && val != "" {
+		return val
+	}
+	return fallback
+}
+
+// envInt returns the integer value of an environment variable or a default
+func envInt(key string, fallback int) int {
+	val, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return val
+}
+
+// envBool returns the boolean value (e.g. "true", "1") of an environment variable or a default
+func envBool(key string, fallback bool) bool {
+	val, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return val
+}
+
+// envDuration returns the duration value (e.g. "30s") of an environment variable or a default
+func envDuration(key string, fallback time.Duration) time.Duration {
+	val, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return val
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// scanCheckInterval is how many records a scan visits between context checks
+const scanCheckInterval = 1024
+
+// requestTimeout attaches a context with a deadline to every request so
+// long scans and analysis can be abandoned. fasthttp does not report client
+// disconnects, so the deadline is the main cancellation signal.
+func requestTimeout(timeout time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if timeout <= 0 {
+			return c.Next()
+		}
+
+		ctx, cancel := context.WithTimeout(c.UserContext(), timeout)
+		defer cancel()
+
+		c.SetUserContext(ctx)
+		return c.Next()
+	}
+}
+
+// contextError converts a cancelled or expired context into an HTTP error
+func contextError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "Request timed out")
+	}
+	if errors.Is(err, context.Canceled) {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "Request cancelled")
+	}
+	return err
+}
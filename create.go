@@ -0,0 +1,604 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Conflict strategies for creating a value that is already stored
+const (
+	onConflictError          = "error"
+	onConflictSkip           = "skip"
+	onConflictReturnExisting = "return_existing"
+	onConflictReplace        = "replace"
+	// onConflictReanalyze is replace keeping the stored tags, metadata and
+	// expiry, for resubmissions that only want a fresh analysis
+	onConflictReanalyze = "reanalyze"
+)
+
+// Outcomes of creating a single value
+const (
+	outcomeCreated  = "created"
+	outcomeSkipped  = "skipped"
+	outcomeExisting = "existing"
+	outcomeReplaced = "replaced"
+)
+
+// createOptions are the per-request settings shared by single and batch create
+type createOptions struct {
+	duplicatePolicy string
+	onConflict      string
+	actor           string
+	// encryptionKey is the client's key for values with an encryption_key_id
+	encryptionKey []byte
+	// validateOnly runs every check and the analysis but stores nothing
+	validateOnly bool
+	// profile overrides the default analysis profile, e.g. for a
+	// ?palindrome_mode= given with the request or a collection's own config
+	profile *analysisProfile
+	// pinned marks the stored string as seeded, see loadSeedStrings
+	pinned bool
+	// forCollection analyzes a value for a collection, ignoring the main
+	// store's copy of it, pinned or not
+	forCollection bool
+}
+
+// createResult is the outcome of creating one value
+type createResult struct {
+	outcome    string
+	data       *StringData
+	duplicates *DuplicateMatches
+}
+
+// errStringExists is returned when a value is already stored and the
+// conflict strategy is error
+var errStringExists = fiber.NewError(fiber.StatusConflict, "String already exists in the system")
+
+// createError is a create failure that carries extra response fields
+type createError struct {
+	status int
+	body   fiber.Map
+}
+
+func (e *createError) Error() string {
+	return e.body["error"].(string)
+}
+
+// BatchCreateRequest represents the request body for POST /strings/batch
+type BatchCreateRequest struct {
+	Strings []CreateStringRequest `json:"strings"`
+}
+
+// BatchCreateItem is the outcome of one value in a batch
+type BatchCreateItem struct {
+	Index            int               `json:"index"`
+	Status           int               `json:"status"`
+	Outcome          string            `json:"outcome,omitempty"`
+	Data             *StringData       `json:"data,omitempty"`
+	DuplicateMatches *DuplicateMatches `json:"duplicate_matches,omitempty"`
+	Error            string            `json:"error,omitempty"`
+	Details          fiber.Map         `json:"details,omitempty"`
+}
+
+// BatchCreateResponse represents the response for POST /strings/batch
+type BatchCreateResponse struct {
+	Results      []BatchCreateItem     `json:"results"`
+	Counts       map[string]int        `json:"counts"`
+	ValidateOnly bool                  `json:"validate_only,omitempty"`
+	Duplicates   *BatchDuplicateCounts `json:"duplicates,omitempty"`
+}
+
+// BatchDuplicateCounts summarizes the duplicates found by a validate-only batch
+type BatchDuplicateCounts struct {
+	// InBatch counts values repeating an earlier item of the same batch
+	InBatch int `json:"in_batch"`
+	// Existing counts values already stored
+	Existing int `json:"existing"`
+	// Near counts values flagged as equivalent to or anagrams of stored ones
+	Near int `json:"near"`
+}
+
+// batchValidation tracks what a validate-only batch would have stored
+type batchValidation struct {
+	seen    map[string]bool
+	created map[string]*StringData
+	counts  BatchDuplicateCounts
+}
+
+// parseCreateOptions reads duplicate_policy, on_conflict and palindrome_mode
+// from the query string
+func parseCreateOptions(c *fiber.Ctx) (createOptions, error) {
+	policy, err := duplicatePolicy(c)
+	if err != nil {
+		return createOptions{}, err
+	}
+
+	onConflict := c.Query("on_conflict", onConflictError)
+	switch onConflict {
+	case onConflictError, onConflictSkip, onConflictReturnExisting, onConflictReplace, onConflictReanalyze:
+	default:
+		return createOptions{}, fiber.NewError(fiber.StatusBadRequest, "on_conflict must be one of error, skip, return_existing, replace, reanalyze")
+	}
+
+	key, err := parseEncryptionKey(c)
+	if err != nil {
+		return createOptions{}, err
+	}
+
+	opts := createOptions{duplicatePolicy: policy, onConflict: onConflict, actor: requestActor(c), encryptionKey: key}
+	if mode := c.Query("palindrome_mode"); mode != "" {
+		opts.profile, err = defaultProfile.Load().withPalindromeMode(mode)
+		if err != nil {
+			return createOptions{}, err
+		}
+	}
+	return opts, nil
+}
+
+// analysisProfile returns the profile new values are analyzed with
+func (opts createOptions) analysisProfile() *analysisProfile {
+	if opts.profile != nil {
+		return opts.profile
+	}
+	return defaultProfile.Load()
+}
+
+// replaces reports whether an existing record is overwritten by a new
+// analysis rather than resolved by resolveConflict
+func (opts createOptions) replaces() bool {
+	return opts.onConflict == onConflictReplace || opts.onConflict == onConflictReanalyze
+}
+
+// inherit carries over what a replacement keeps from the existing record:
+// its history, aliases and client-supplied ID unless given another, plus
+// its tags, metadata and expiry when reanalyzing
+func (opts createOptions) inherit(data, existing *StringData) {
+	data.CreatedAt, data.Aliases = existing.CreatedAt, existing.Aliases
+	if existing.ClientSuppliedID && !data.ClientSuppliedID {
+		data.ID, data.ClientSuppliedID = existing.ID, true
+	}
+	if opts.onConflict == onConflictReanalyze {
+		data.Tags, data.Metadata, data.ExpiresAt = existing.Tags, existing.Metadata, existing.ExpiresAt
+	}
+}
+
+// createValue analyzes and stores one value, resolving an existing record
+// according to opts.onConflict
+func createValue(ctx context.Context, req CreateStringRequest, opts createOptions) (*createResult, error) {
+	if req.ID != "" {
+		if err := validateClientID(req.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	// Binary values arrive base64-encoded and are analyzed as raw bytes
+	raw, encoding := req.Value, ""
+	if req.ValueBase64 != "" {
+		if req.Value != "" {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Send either 'value' or 'value_base64', not both")
+		}
+
+		var err error
+		raw, req.Value, err = decodeBinaryValue(req.ValueBase64)
+		if err != nil {
+			return nil, err
+		}
+		encoding = encodingBase64
+	}
+
+	if req.Value == "" {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Missing 'value' field")
+	}
+	if encoding == "" && strings.HasPrefix(req.Value, binaryKeyPrefix) {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "'value' must not start with U+FFFF; send bytes as 'value_base64'")
+	}
+
+	if err := checkContentPolicy(raw); err != nil {
+		return nil, err
+	}
+
+	// Encrypted values are analyzed as plaintext but stored, and keyed,
+	// by their ciphertext
+	storedEncoding := encoding
+	if req.EncryptionKeyID != "" {
+		if opts.encryptionKey == nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "'encryption_key_id' needs the key in the X-Encryption-Key header")
+		}
+		if encoding != "" {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "'encryption_key_id' cannot be combined with 'value_base64'")
+		}
+		sealed, err := encryptValue(opts.encryptionKey, req.EncryptionKeyID, raw)
+		if err != nil {
+			return nil, err
+		}
+		req.Value, storedEncoding = sealed, encodingEncrypted
+	}
+
+	if req.TTLSeconds < 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "'ttl_seconds' must not be negative")
+	}
+	if config.DemoMode && !opts.pinned {
+		req.TTLSeconds = demoTTLSeconds(req.TTLSeconds)
+	}
+
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check if string already exists
+	var existing *StringData
+	var duplicates *DuplicateMatches
+
+	shard := shardFor(req.Value)
+	if !opts.forCollection {
+		if err := ensureCached(ctx, req.Value); err != nil {
+			return nil, err
+		}
+
+		shard.RLock()
+		existing = shard.liveRecordLocked(req.Value)
+		shard.RUnlock()
+	}
+
+	if existing == nil && opts.duplicatePolicy != duplicatePolicyOff && storedEncoding != encodingEncrypted {
+		duplicates = findDuplicates(req.Value)
+	}
+
+	if existing != nil && !opts.replaces() {
+		if !opts.validateOnly {
+			recordResubmission(req.Value)
+		}
+		return resolveConflict(existing, opts.onConflict)
+	}
+	if existing != nil && existing.Pinned && !opts.pinned {
+		return nil, errPinned
+	}
+
+	if duplicates != nil && opts.duplicatePolicy == duplicatePolicyReject {
+		return nil, &createError{status: fiber.StatusConflict, body: fiber.Map{
+			"error":             "String is equivalent to or an anagram of an existing string",
+			"duplicate_matches": duplicates,
+		}}
+	}
+
+	// Analyze string
+	properties, err := analyzeString(ctx, raw, encoding, opts.analysisProfile())
+	if err != nil {
+		return nil, contextError(err)
+	}
+
+	// Catch values corrupted in transit
+	if req.ExpectedSHA256 != "" {
+		actual := properties.SHA256Hash
+		if actual == "" {
+			actual = computeSHA256(raw)
+		}
+		if !strings.EqualFold(req.ExpectedSHA256, actual) {
+			return nil, &createError{status: fiber.StatusUnprocessableEntity, body: fiber.Map{
+				"error":           "Checksum mismatch: value does not match expected_sha256",
+				"expected_sha256": req.ExpectedSHA256,
+				"actual_sha256":   actual,
+			}}
+		}
+	}
+
+	// Create string data
+	stringData := &StringData{
+		ID:            computeID(raw, properties),
+		HashAlgorithm: config.HashAlgorithm,
+		Value:         req.Value,
+		Encoding:      storedEncoding,
+		Properties:    properties,
+		CreatedAt:     time.Now().UTC(),
+		Tags:          tags,
+		Metadata:      req.Metadata,
+		Pinned:        opts.pinned,
+	}
+	if len(stringData.Metadata) == 0 {
+		stringData.Metadata = nil
+	}
+	if storedEncoding == encodingEncrypted {
+		// IDs of the same plaintext under different keys must not collide
+		stringData.ID = hashAlgorithms[config.HashAlgorithm](req.Value)
+		stringData.EncryptionKeyID = req.EncryptionKeyID
+		redactPlaintextProperties(&stringData.Properties)
+	}
+	if req.ID != "" {
+		// The hash stays available as properties.sha256_hash
+		stringData.ID, stringData.ClientSuppliedID = req.ID, true
+
+		clientIDMu.Lock()
+		defer clientIDMu.Unlock()
+		if owner, taken := clientIDOwner(req.ID); taken && owner != req.Value {
+			return nil, errClientIDTaken
+		}
+	}
+	if req.TTLSeconds > 0 {
+		expiresAt := stringData.CreatedAt.Add(time.Duration(req.TTLSeconds) * time.Second)
+		stringData.ExpiresAt = &expiresAt
+	}
+
+	if opts.validateOnly {
+		outcome := outcomeCreated
+		if existing != nil {
+			outcome = outcomeReplaced
+		}
+		return &createResult{outcome: outcome, data: stringData, duplicates: duplicates}, nil
+	}
+
+	// Store, re-checking for a concurrent create of the same value
+	shard.Lock()
+	existing = shard.liveRecordLocked(req.Value)
+	if existing != nil && !opts.replaces() {
+		shard.Unlock()
+		recordResubmission(req.Value)
+		return resolveConflict(existing, opts.onConflict)
+	}
+	if existing != nil && existing.Pinned && !opts.pinned {
+		shard.Unlock()
+		return nil, errPinned
+	}
+	// Stamped under the shard lock so a record becomes visible right after
+	// its created_at, which cursor pages rely on
+	stringData.CreatedAt = time.Now().UTC()
+	stringData.UpdatedAt = stringData.CreatedAt
+	if req.TTLSeconds > 0 {
+		expiresAt := stringData.CreatedAt.Add(time.Duration(req.TTLSeconds) * time.Second)
+		stringData.ExpiresAt = &expiresAt
+	}
+	if existing != nil {
+		// Replacing refreshes the analysis but keeps the record's history
+		opts.inherit(stringData, existing)
+	}
+	shard.putLocked(stringData)
+	shard.Unlock()
+
+	if existing != nil {
+		if changes := propertyDiff(existing.Properties, stringData.Properties); len(changes) > 0 {
+			publishEvent(Event{
+				Type:    eventPropertiesChanged,
+				ID:      stringData.ID,
+				Value:   stringData.Value,
+				Actor:   opts.actor,
+				Changes: changes,
+				before:  existing,
+				after:   stringData,
+			})
+		}
+		return &createResult{outcome: outcomeReplaced, data: stringData, duplicates: duplicates}, nil
+	}
+
+	publishEvent(Event{
+		Type:  eventStringCreated,
+		ID:    stringData.ID,
+		Value: stringData.Value,
+		Actor: opts.actor,
+		after: stringData,
+	})
+
+	return &createResult{outcome: outcomeCreated, data: stringData, duplicates: duplicates}, nil
+}
+
+// resolveConflict applies a conflict strategy other than replace to an existing record
+func resolveConflict(existing *StringData, onConflict string) (*createResult, error) {
+	switch onConflict {
+	case onConflictSkip:
+		return &createResult{outcome: outcomeSkipped}, nil
+	case onConflictReturnExisting:
+		return &createResult{outcome: outcomeExisting, data: existing}, nil
+	default:
+		return nil, errStringExists
+	}
+}
+
+// status returns the HTTP status reported for a create outcome
+func (r *createResult) status() int {
+	switch r.outcome {
+	case outcomeCreated:
+		return fiber.StatusCreated
+	case outcomeSkipped:
+		return fiber.StatusNoContent
+	default:
+		return fiber.StatusOK
+	}
+}
+
+// UpsertStringResponse is the stored record plus whether the upsert created it
+type UpsertStringResponse struct {
+	*StringData
+	Created bool   `json:"created"`
+	Outcome string `json:"outcome"`
+}
+
+// MarshalJSON inlines the record as clients see it
+func (r UpsertStringResponse) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		*stringDataJSON
+		Created bool   `json:"created"`
+		Outcome string `json:"outcome"`
+	}{r.StringData.public(), r.Created, r.Outcome})
+}
+
+// parseCreateBody reads a create request sent as JSON, as an HTML form
+// (application/x-www-form-urlencoded or multipart, tags repeated, no
+// metadata) or as YAML (application/yaml, application/x-yaml or text/yaml)
+// with the JSON field names
+func parseCreateBody(c *fiber.Ctx, req *CreateStringRequest) error {
+	switch strings.ToLower(strings.TrimSpace(strings.Split(c.Get(fiber.HeaderContentType), ";")[0])) {
+	case "application/yaml", "application/x-yaml", "text/yaml":
+		var doc interface{}
+		if err := yaml.Unmarshal(c.Body(), &doc); err != nil {
+			return err
+		}
+		encoded, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(encoded, req)
+	}
+	return c.BodyParser(req)
+}
+
+// upsertString handles PUT /strings. The value is created when absent;
+// otherwise the existing record is returned, or re-analyzed when
+// ?refresh=true.
+func upsertString(c *fiber.Ctx) error {
+	var req CreateStringRequest
+
+	if err := parseCreateBody(c, &req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	opts, err := parseCreateOptions(c)
+	if err != nil {
+		return err
+	}
+	opts.onConflict = onConflictReturnExisting
+	if c.QueryBool("refresh") {
+		opts.onConflict = onConflictReplace
+	}
+
+	result, err := createValue(c.UserContext(), req, opts)
+	if e, ok := err.(*createError); ok {
+		return c.Status(e.status).JSON(e.body)
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.Status(result.status()).JSON(UpsertStringResponse{
+		StringData: result.data,
+		Created:    result.outcome == outcomeCreated,
+		Outcome:    result.outcome,
+	})
+}
+
+// batchCreateStrings handles POST /strings/batch. Each value is created
+// independently; failures are reported per item rather than failing the batch.
+// With ?validate_only=true every item is checked and analyzed as if it were
+// created, including against earlier items of the batch, but nothing is stored.
+func batchCreateStrings(c *fiber.Ctx) error {
+	var req BatchCreateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	if len(req.Strings) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Missing 'strings' field")
+	}
+	if config.MaxBatchSize > 0 && len(req.Strings) > config.MaxBatchSize {
+		return fiber.NewError(fiber.StatusRequestEntityTooLarge, "Batch exceeds MAX_BATCH_SIZE")
+	}
+
+	opts, err := parseCreateOptions(c)
+	if err != nil {
+		return err
+	}
+
+	opts.validateOnly = c.QueryBool("validate_only")
+
+	response := BatchCreateResponse{
+		Results:      make([]BatchCreateItem, 0, len(req.Strings)),
+		Counts:       make(map[string]int),
+		ValidateOnly: opts.validateOnly,
+	}
+
+	// A validate-only batch stores nothing, so later items are checked
+	// against the records earlier ones would have created
+	validation := newBatchValidation()
+	if opts.validateOnly {
+		response.Duplicates = &validation.counts
+	}
+
+	for i, item := range req.Strings {
+		result, err := createValue(c.UserContext(), item, opts)
+		if opts.validateOnly {
+			result, err = validation.check(item, result, err, opts)
+		}
+		if err != nil {
+			if c.UserContext().Err() != nil {
+				return contextError(err)
+			}
+
+			response.Results = append(response.Results, failedBatchItem(i, err))
+			response.Counts["failed"]++
+			continue
+		}
+
+		response.Results = append(response.Results, BatchCreateItem{
+			Index:            i,
+			Status:           result.status(),
+			Outcome:          result.outcome,
+			Data:             result.data,
+			DuplicateMatches: result.duplicates,
+		})
+		response.Counts[result.outcome]++
+	}
+
+	return c.Status(fiber.StatusMultiStatus).JSON(response)
+}
+
+// failedBatchItem reports a create failure for item i
+func failedBatchItem(i int, err error) BatchCreateItem {
+	failed := BatchCreateItem{Index: i, Status: fiber.StatusInternalServerError, Error: err.Error()}
+	switch e := err.(type) {
+	case *fiber.Error:
+		failed.Status = e.Code
+	case *createError:
+		failed.Status = e.status
+		failed.Details = make(fiber.Map, len(e.body))
+		for k, v := range e.body {
+			if k != "error" {
+				failed.Details[k] = v
+			}
+		}
+	}
+	return failed
+}
+
+func newBatchValidation() *batchValidation {
+	return &batchValidation{
+		seen:    make(map[string]bool),
+		created: make(map[string]*StringData),
+	}
+}
+
+// check adjusts a validate-only result for values repeating an earlier item
+// of the batch, which would have created them, and tallies duplicates
+func (v *batchValidation) check(item CreateStringRequest, result *createResult, err error, opts createOptions) (*createResult, error) {
+	key := item.Value + "\x00" + item.ValueBase64
+	if v.seen[key] {
+		v.counts.InBatch++
+	}
+	v.seen[key] = true
+
+	if err == errStringExists {
+		v.counts.Existing++
+	}
+	if err != nil {
+		return nil, err
+	}
+	if result.duplicates != nil {
+		v.counts.Near++
+	}
+	if result.outcome != outcomeCreated {
+		v.counts.Existing++
+		return result, nil
+	}
+
+	earlier, repeated := v.created[result.data.Value]
+	if !repeated {
+		v.created[result.data.Value] = result.data
+		return result, nil
+	}
+	if opts.replaces() {
+		return &createResult{outcome: outcomeReplaced, data: result.data, duplicates: result.duplicates}, nil
+	}
+	return resolveConflict(earlier, opts.onConflict)
+}
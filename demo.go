@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+)
+
+// demoWriteLimiter throttles writes per actor in demo mode. Reads are
+// never throttled, and admin routes are left to adminAuth.
+func demoWriteLimiter() fiber.Handler {
+	return limiter.New(limiter.Config{
+		Next: func(c *fiber.Ctx) bool {
+			switch c.Method() {
+			case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+				return true
+			}
+			return strings.HasPrefix(c.Path(), "/admin")
+		},
+		Max:          config.DemoWriteLimit,
+		Expiration:   config.DemoWriteWindow,
+		KeyGenerator: requestActor,
+		LimitReached: func(c *fiber.Ctx) error {
+			return fiber.NewError(fiber.StatusTooManyRequests, fmt.Sprintf("Demo mode allows %d writes per %s; try again later", config.DemoWriteLimit, config.DemoWriteWindow))
+		},
+	})
+}
+
+// demoBanner adds a "banner" field to every JSON object response in demo
+// mode, errors included, so clients can tell users they are on a demo
+func demoBanner(c *fiber.Ctx) error {
+	if err := c.Next(); err != nil {
+		// Render the error now so it gets the banner too
+		if err := c.App().Config().ErrorHandler(c, err); err != nil {
+			return err
+		}
+	}
+
+	if c.Response().IsBodyStream() || !strings.HasPrefix(string(c.Response().Header.ContentType()), fiber.MIMEApplicationJSON) {
+		return nil
+	}
+	body := bytes.TrimSpace(c.Response().Body())
+	if len(body) < 2 || body[0] != '{' {
+		return nil
+	}
+
+	banner, err := json.Marshal(config.DemoBanner)
+	if err != nil {
+		return err
+	}
+
+	// Splice the field in rather than re-encoding, keeping the field order
+	spliced := make([]byte, 0, len(body)+len(banner)+12)
+	spliced = append(spliced, `{"banner":`...)
+	spliced = append(spliced, banner...)
+	if rest := bytes.TrimSpace(body[1:]); len(rest) > 0 && rest[0] != '}' {
+		spliced = append(spliced, ',')
+	}
+	spliced = append(spliced, body[1:]...)
+	c.Response().SetBodyRaw(spliced)
+	return nil
+}
+
+// demoTTLSeconds is the TTL applied to a string created in demo mode: the
+// requested TTL, capped at DEMO_TTL
+func demoTTLSeconds(requested int) int {
+	limit := int(config.DemoTTL / time.Second)
+	if requested == 0 || requested > limit {
+		return limit
+	}
+	return requested
+}
@@ -0,0 +1,499 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DerivedProperty is an admin-defined numeric property computed from an
+// arithmetic expression over built-in properties, e.g. vowels / length
+type DerivedProperty struct {
+	Name       string `json:"name"`
+	Expression string `json:"expression"`
+	expr       expression
+}
+
+// DerivedPropertiesResponse represents the response for GET /admin/derived-properties
+type DerivedPropertiesResponse struct {
+	Properties []DerivedProperty `json:"properties"`
+	Variables  []string          `json:"variables"`
+	Count      int               `json:"count"`
+}
+
+var (
+	// derivedProperties is replaced wholesale on every change so analysis
+	// and filtering can read it without locking
+	derivedProperties atomic.Pointer[[]DerivedProperty]
+	// derivedMu serializes admin changes to derivedProperties
+	derivedMu sync.Mutex
+)
+
+// derivedNamePattern restricts names to something usable as a query parameter suffix
+var derivedNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// derivedVariables lists the values an expression can refer to
+var derivedVariables = map[string]func(value string, p *StringProperties) float64{
+	"length":            func(_ string, p *StringProperties) float64 { return float64(p.Length) },
+	"unique_characters": func(_ string, p *StringProperties) float64 { return float64(p.UniqueCharacters) },
+	"word_count":        func(_ string, p *StringProperties) float64 { return float64(p.WordCount) },
+	"stopword_count":    func(_ string, p *StringProperties) float64 { return float64(p.StopwordCount) },
+	"syllable_count":    func(_ string, p *StringProperties) float64 { return float64(p.SyllableCount) },
+	"is_palindrome":     func(_ string, p *StringProperties) float64 { return boolNumber(p.IsPalindrome) },
+	"is_rot13":          func(_ string, p *StringProperties) float64 { return boolNumber(p.IsROT13) },
+	"vowels":            countRunes(isVowel),
+	"consonants":        countRunes(isConsonant),
+	"letters":           countRunes(unicode.IsLetter),
+	"digits":            countRunes(unicode.IsDigit),
+	"uppercase":         countRunes(unicode.IsUpper),
+	"lowercase":         countRunes(unicode.IsLower),
+	"whitespace":        countRunes(unicode.IsSpace),
+}
+
+// countRunes returns a variable counting the runes of the value matching pred
+func countRunes(pred func(r rune) bool) func(value string, p *StringProperties) float64 {
+	return func(value string, _ *StringProperties) float64 {
+		n := 0
+		for _, r := range value {
+			if pred(r) {
+				n++
+			}
+		}
+		return float64(n)
+	}
+}
+
+// boolNumber turns true into 1 and false into 0
+func boolNumber(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// loadDerivedProperties returns the current derived property definitions
+func loadDerivedProperties() []DerivedProperty {
+	if defs := derivedProperties.Load(); defs != nil {
+		return *defs
+	}
+	return nil
+}
+
+// findDerivedProperty looks up a derived property by name
+func findDerivedProperty(name string) (DerivedProperty, bool) {
+	for _, def := range loadDerivedProperties() {
+		if def.Name == name {
+			return def, true
+		}
+	}
+	return DerivedProperty{}, false
+}
+
+// analyzeDerived evaluates every derived property. It runs after the
+// built-in analyzers so their properties are available to expressions.
+func analyzeDerived(_ context.Context, value string, properties *StringProperties, _ *analysisProfile) {
+	defs := loadDerivedProperties()
+	if len(defs) == 0 {
+		return
+	}
+
+	properties.Derived = make(map[string]float64, len(defs))
+	for _, def := range defs {
+		properties.Derived[def.Name] = def.expr.eval(value, properties)
+	}
+}
+
+// derivedFilterSpecs builds min_<name> and max_<name> filters for every derived property
+func derivedFilterSpecs() []filterSpec {
+	var specs []filterSpec
+	for _, def := range loadDerivedProperties() {
+		specs = append(specs,
+			derivedFilter(def.Name, "min_", "gte", func(got, want float64) bool { return got >= want }),
+			derivedFilter(def.Name, "max_", "lte", func(got, want float64) bool { return got <= want }),
+		)
+	}
+	return specs
+}
+
+// derivedFilter builds a numeric bound filter over a derived property
+func derivedFilter(name, prefix, operator string, cmp func(got, want float64) bool) filterSpec {
+	param := prefix + name
+	return filterSpec{
+		Name:        param,
+		Type:        "number",
+		Operator:    operator,
+		Description: fmt.Sprintf("Bound on derived property %s", name),
+		parse: func(raw string) (interface{}, error) {
+			val, err := strconv.ParseFloat(raw, 64)
+			if err != nil || math.IsNaN(val) || math.IsInf(val, 0) {
+				return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid value for "+param)
+			}
+			return val, nil
+		},
+		match: func(data *StringData, val interface{}) bool {
+			got, ok := data.Properties.Derived[name]
+			return ok && cmp(got, val.(float64))
+		},
+		estimate: func(stats *cardinalityStats, val interface{}) int {
+			return stats.total
+		},
+	}
+}
+
+// reservedPropertyNames returns the built-in property and filter names a
+// derived property must not shadow
+func reservedPropertyNames() map[string]bool {
+	reserved := make(map[string]bool)
+	for _, a := range analyzers {
+		for _, prop := range a.Properties {
+			reserved[prop.Name] = true
+		}
+	}
+	for _, spec := range filterSpecs {
+		reserved[spec.Name] = true
+	}
+	for name := range derivedVariables {
+		reserved[name] = true
+	}
+	return reserved
+}
+
+// getDerivedProperties handles GET /admin/derived-properties
+func getDerivedProperties(c *fiber.Ctx) error {
+	defs := loadDerivedProperties()
+
+	variables := make([]string, 0, len(derivedVariables))
+	for name := range derivedVariables {
+		variables = append(variables, name)
+	}
+	sort.Strings(variables)
+
+	return c.JSON(DerivedPropertiesResponse{
+		Properties: defs,
+		Variables:  variables,
+		Count:      len(defs),
+	})
+}
+
+// putDerivedProperty handles PUT /admin/derived-properties/:name, creating or
+// replacing a definition and computing it for every stored string
+func putDerivedProperty(c *fiber.Ctx) error {
+	var req DerivedProperty
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	// Params are only valid for the lifetime of the request, so copy before storing
+	req.Name = strings.Clone(c.Params("name"))
+
+	if !derivedNamePattern.MatchString(req.Name) {
+		return fiber.NewError(fiber.StatusBadRequest, "Name must be lowercase letters, digits and underscores, starting with a letter")
+	}
+	if reservedPropertyNames()[req.Name] {
+		return fiber.NewError(fiber.StatusConflict, fmt.Sprintf("%q is a built-in property", req.Name))
+	}
+
+	expr, err := parseExpression(req.Expression)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, fmt.Sprintf("Invalid expression: %s", err.Error()))
+	}
+	req.expr = expr
+
+	derivedMu.Lock()
+	defer derivedMu.Unlock()
+
+	var defs []DerivedProperty
+	for _, def := range loadDerivedProperties() {
+		if def.Name != req.Name {
+			defs = append(defs, def)
+		}
+	}
+	defs = append(defs, req)
+	derivedProperties.Store(&defs)
+	writeWAL(walEntry{Op: walPutDerived, Derived: &req})
+
+	backfillDerived(func(derived map[string]float64, data *StringData) {
+		derived[req.Name] = req.expr.eval(rawValue(data), &data.Properties)
+	})
+
+	return c.JSON(req)
+}
+
+// deleteDerivedProperty handles DELETE /admin/derived-properties/:name
+func deleteDerivedProperty(c *fiber.Ctx) error {
+	name := c.Params("name")
+
+	derivedMu.Lock()
+	defer derivedMu.Unlock()
+
+	if _, ok := findDerivedProperty(name); !ok {
+		return fiber.NewError(fiber.StatusNotFound, "Derived property does not exist")
+	}
+
+	var defs []DerivedProperty
+	for _, def := range loadDerivedProperties() {
+		if def.Name != name {
+			defs = append(defs, def)
+		}
+	}
+	derivedProperties.Store(&defs)
+	writeWAL(walEntry{Op: walDeleteDerived, Derived: &DerivedProperty{Name: name}})
+
+	backfillDerived(func(derived map[string]float64, _ *StringData) {
+		delete(derived, name)
+	})
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// backfillDerived rewrites the derived map of every stored record, one
+// shard or collection at a time. Records are replaced rather than mutated
+// since responses may still be encoding the old ones.
+func backfillDerived(update func(derived map[string]float64, data *StringData)) {
+	for _, shard := range shards {
+		shard.Lock()
+		for _, data := range shard.records {
+			shard.putLocked(rederived(data, update))
+		}
+		shard.Unlock()
+	}
+
+	collections.RLock()
+	defer collections.RUnlock()
+	for _, col := range collections.byName {
+		col.Lock()
+		for _, data := range col.records {
+			col.putLocked(rederived(data, update))
+		}
+		col.Unlock()
+	}
+}
+
+// rederived returns a copy of a record with its derived map rewritten by update
+func rederived(data *StringData, update func(derived map[string]float64, data *StringData)) *StringData {
+	derived := make(map[string]float64, len(data.Properties.Derived)+1)
+	for k, v := range data.Properties.Derived {
+		derived[k] = v
+	}
+	update(derived, data)
+	if len(derived) == 0 {
+		derived = nil
+	}
+
+	updated := *data
+	updated.Properties.Derived = derived
+	updated.UpdatedAt = time.Now().UTC()
+	return &updated
+}
+
+// restoreDerivedProperties replaces the definitions with ones read back
+// from a snapshot, skipping any whose expression no longer parses
+func restoreDerivedProperties(saved []DerivedProperty) {
+	derivedMu.Lock()
+	defer derivedMu.Unlock()
+
+	var defs []DerivedProperty
+	for _, def := range saved {
+		expr, err := parseExpression(def.Expression)
+		if err != nil {
+			log.Printf("dropping derived property %s: %v", def.Name, err)
+			continue
+		}
+		def.expr = expr
+		defs = append(defs, def)
+	}
+	derivedProperties.Store(&defs)
+}
+
+// replayDerivedEntry applies a logged change to the derived properties
+func replayDerivedEntry(entry walEntry) {
+	defs := loadDerivedProperties()
+	var replayed []DerivedProperty
+	for _, def := range defs {
+		if def.Name != entry.Derived.Name {
+			replayed = append(replayed, def)
+		}
+	}
+	if entry.Op == walPutDerived {
+		replayed = append(replayed, *entry.Derived)
+	}
+	restoreDerivedProperties(replayed)
+}
+
+// expression is a parsed arithmetic expression
+type expression interface {
+	eval(value string, p *StringProperties) float64
+}
+
+type numberExpr float64
+
+type variableExpr string
+
+type negateExpr struct{ operand expression }
+
+type binaryExpr struct {
+	op          byte
+	left, right expression
+}
+
+func (e numberExpr) eval(string, *StringProperties) float64 { return float64(e) }
+
+func (e variableExpr) eval(value string, p *StringProperties) float64 {
+	return derivedVariables[string(e)](value, p)
+}
+
+func (e negateExpr) eval(value string, p *StringProperties) float64 {
+	return -e.operand.eval(value, p)
+}
+
+// eval applies the operator. Division by zero, and results too large for
+// a float64, yield 0 so every derived value stays representable in JSON.
+func (e binaryExpr) eval(value string, p *StringProperties) float64 {
+	left, right := e.left.eval(value, p), e.right.eval(value, p)
+	var result float64
+	switch e.op {
+	case '+':
+		result = left + right
+	case '-':
+		result = left - right
+	case '*':
+		result = left * right
+	default:
+		if right == 0 {
+			return 0
+		}
+		result = left / right
+	}
+	if math.IsInf(result, 0) || math.IsNaN(result) {
+		return 0
+	}
+	return result
+}
+
+// expressionParser is a recursive descent parser for + - * / and parentheses
+type expressionParser struct {
+	src string
+	pos int
+}
+
+// parseExpression parses src into an expression over derivedVariables
+func parseExpression(src string) (expression, error) {
+	p := &expressionParser{src: src}
+	expr, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.src) {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.src[p.pos], p.pos)
+	}
+	return expr, nil
+}
+
+func (p *expressionParser) skipSpace() {
+	for p.pos < len(p.src) && p.src[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// peek returns the next non-space byte, or 0 at the end of input
+func (p *expressionParser) peek() byte {
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *expressionParser) parseSum() (expression, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		p.pos++
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op, left, right}
+	}
+	return left, nil
+}
+
+func (p *expressionParser) parseProduct() (expression, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '*' || op == '/'; op = p.peek() {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op, left, right}
+	}
+	return left, nil
+}
+
+func (p *expressionParser) parseUnary() (expression, error) {
+	if p.peek() == '-' {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return negateExpr{operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *expressionParser) parsePrimary() (expression, error) {
+	switch ch := p.peek(); {
+	case ch == 0:
+		return nil, fmt.Errorf("unexpected end of expression")
+	case ch == '(':
+		p.pos++
+		expr, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("missing ')' at position %d", p.pos)
+		}
+		p.pos++
+		return expr, nil
+	case ch >= '0' && ch <= '9' || ch == '.':
+		start := p.pos
+		for p.pos < len(p.src) && (p.src[p.pos] >= '0' && p.src[p.pos] <= '9' || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		val, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", p.src[start:p.pos])
+		}
+		return numberExpr(val), nil
+	case ch >= 'a' && ch <= 'z' || ch == '_':
+		start := p.pos
+		for p.pos < len(p.src) && (p.src[p.pos] >= 'a' && p.src[p.pos] <= 'z' || p.src[p.pos] >= '0' && p.src[p.pos] <= '9' || p.src[p.pos] == '_') {
+			p.pos++
+		}
+		name := p.src[start:p.pos]
+		if _, ok := derivedVariables[name]; !ok {
+			return nil, fmt.Errorf("unknown variable %q", name)
+		}
+		return variableExpr(name), nil
+	default:
+		return nil, fmt.Errorf("unexpected %q at position %d", ch, p.pos)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DistinctValue is one value of a property and how many strings have it
+type DistinctValue struct {
+	Value interface{} `json:"value"`
+	Count int         `json:"count"`
+}
+
+// DistinctResponse represents the response for GET /strings/distinct
+type DistinctResponse struct {
+	Property       string                 `json:"property"`
+	Values         []DistinctValue        `json:"values"`
+	Count          int                    `json:"count"`
+	FiltersApplied map[string]interface{} `json:"filters_applied"`
+}
+
+// distinctProperties are the properties GET /strings/distinct can group
+// by. A property reports false for strings it does not apply to, which are
+// left out of the counts.
+var distinctProperties = map[string]func(data *StringData) (interface{}, bool){
+	"word_count": func(data *StringData) (interface{}, bool) {
+		return data.Properties.WordCount, true
+	},
+	"detected_language": func(data *StringData) (interface{}, bool) {
+		return data.Properties.DetectedLanguage, data.Properties.DetectedLanguage != ""
+	},
+	"script": func(data *StringData) (interface{}, bool) {
+		if data.Encoding == encodingEncrypted {
+			return nil, false
+		}
+		script := dominantScript(data.Value)
+		return script, script != ""
+	},
+}
+
+// dominantScript returns the Unicode script most of a value's letters are
+// written in, or "" if it has no letters. Ties go to the script named
+// first alphabetically.
+func dominantScript(value string) string {
+	if scripts := letterScripts(value); len(scripts) > 0 {
+		return scripts[0]
+	}
+	return ""
+}
+
+// getDistinctValues handles GET /strings/distinct, counting the strings
+// per value of ?property= among those matching the same filters as
+// GET /strings, most common first
+func getDistinctValues(c *fiber.Ctx) error {
+	property := c.Query("property")
+	valueOf, ok := distinctProperties[property]
+	if !ok {
+		return fiber.NewError(fiber.StatusBadRequest, "property must be word_count, detected_language or script")
+	}
+
+	filtersApplied, err := parseQueryFilters(c)
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[interface{}]int)
+	plan := planFilters(filtersApplied)
+	err = plan.each(c.UserContext(), func(data *StringData) {
+		if value, ok := valueOf(data); ok {
+			counts[value]++
+		}
+	})
+	if err != nil {
+		return contextError(err)
+	}
+
+	values := make([]DistinctValue, 0, len(counts))
+	for value, count := range counts {
+		values = append(values, DistinctValue{Value: value, Count: count})
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].Count != values[j].Count {
+			return values[i].Count > values[j].Count
+		}
+		return lessDistinct(values[i].Value, values[j].Value)
+	})
+
+	return c.JSON(DistinctResponse{
+		Property:       property,
+		Values:         values,
+		Count:          len(values),
+		FiltersApplied: filtersApplied,
+	})
+}
+
+// lessDistinct orders two values of the same property
+func lessDistinct(a, b interface{}) bool {
+	switch a := a.(type) {
+	case int:
+		return a < b.(int)
+	case string:
+		return a < b.(string)
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Duplicate policies applied on create
+const (
+	duplicatePolicyOff    = "off"
+	duplicatePolicyFlag   = "flag"
+	duplicatePolicyReject = "reject"
+)
+
+// DuplicateMatches lists existing strings a new value is considered a near-duplicate of
+type DuplicateMatches struct {
+	EquivalentIDs []string `json:"equivalent_ids,omitempty"`
+	AnagramIDs    []string `json:"anagram_ids,omitempty"`
+}
+
+// CreateStringResponse is the created record plus any flagged near-duplicates
+// and, with ?include_similar=true, the most similar existing strings
+type CreateStringResponse struct {
+	*StringData
+	DuplicateMatches *DuplicateMatches `json:"duplicate_matches,omitempty"`
+	Similar          []SimilarString   `json:"similar,omitempty"`
+}
+
+// MarshalJSON inlines the record as clients see it
+func (r CreateStringResponse) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		*stringDataJSON
+		DuplicateMatches *DuplicateMatches `json:"duplicate_matches,omitempty"`
+		Similar          []SimilarString   `json:"similar,omitempty"`
+	}{r.StringData.public(), r.DuplicateMatches, r.Similar})
+}
+
+// valueIndex maps a derived key to the set of stored values sharing it
+type valueIndex map[string]map[string]bool
+
+func (idx valueIndex) add(key, value string) {
+	if idx[key] == nil {
+		idx[key] = make(map[string]bool)
+	}
+	idx[key][value] = true
+}
+
+func (idx valueIndex) remove(key, value string) {
+	delete(idx[key], value)
+	if len(idx[key]) == 0 {
+		delete(idx, key)
+	}
+}
+
+// normalizeValue case-folds a value and drops everything but letters and digits
+func normalizeValue(s string) string {
+	var b strings.Builder
+	for _, char := range strings.ToLower(s) {
+		if unicode.IsLetter(char) || unicode.IsDigit(char) {
+			b.WriteRune(char)
+		}
+	}
+	return b.String()
+}
+
+// anagramSignature returns the sorted characters of the normalized value
+func anagramSignature(s string) string {
+	runes := []rune(normalizeValue(s))
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+	return string(runes)
+}
+
+// indexDuplicatesLocked adds a value to the shard's duplicate indexes.
+// Caller must hold the shard lock.
+func (s *storeShard) indexDuplicatesLocked(data *StringData) {
+	if key := normalizeValue(data.Value); key != "" {
+		s.equivalent.add(key, data.Value)
+		s.anagrams.add(anagramSignature(data.Value), data.Value)
+	}
+}
+
+// unindexDuplicatesLocked removes a value from the shard's duplicate
+// indexes. Caller must hold the shard lock.
+func (s *storeShard) unindexDuplicatesLocked(data *StringData) {
+	if key := normalizeValue(data.Value); key != "" {
+		s.equivalent.remove(key, data.Value)
+		s.anagrams.remove(anagramSignature(data.Value), data.Value)
+	}
+}
+
+// findDuplicates returns live existing strings that are
+// normalized-equivalent to or anagrams of value, or nil if there are none.
+// Encrypted strings are indexed by their ciphertext, so they are never
+// matched. Every shard is read in turn, so the caller must not hold a
+// shard lock.
+func findDuplicates(value string) *DuplicateMatches {
+	key := normalizeValue(value)
+	if key == "" {
+		return nil
+	}
+	signature := anagramSignature(value)
+	now := time.Now()
+
+	matches := &DuplicateMatches{}
+	for _, shard := range shards {
+		shard.RLock()
+		for existing := range shard.equivalent[key] {
+			if data := shard.records[existing]; existing != value && data.Encoding != encodingEncrypted && !data.expired(now) {
+				matches.EquivalentIDs = append(matches.EquivalentIDs, data.ID)
+			}
+		}
+		for existing := range shard.anagrams[signature] {
+			if data := shard.records[existing]; normalizeValue(existing) != key && data.Encoding != encodingEncrypted && !data.expired(now) {
+				matches.AnagramIDs = append(matches.AnagramIDs, data.ID)
+			}
+		}
+		shard.RUnlock()
+	}
+
+	if len(matches.EquivalentIDs) == 0 && len(matches.AnagramIDs) == 0 {
+		return nil
+	}
+
+	sort.Strings(matches.EquivalentIDs)
+	sort.Strings(matches.AnagramIDs)
+	return matches
+}
+
+// duplicatePolicy returns the policy for a request, defaulting to DUPLICATE_POLICY
+func duplicatePolicy(c *fiber.Ctx) (string, error) {
+	policy := c.Query("duplicate_policy", config.DuplicatePolicy)
+
+	switch policy {
+	case duplicatePolicyOff, duplicatePolicyFlag, duplicatePolicyReject:
+		return policy, nil
+	default:
+		return "", fiber.NewError(fiber.StatusBadRequest, "duplicate_policy must be one of off, flag, reject")
+	}
+}
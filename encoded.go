@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// getStringByEncoded handles GET /strings/encoded/:b64value, where the value
+// is base64url-encoded so slashes, spaces and control characters survive
+// the URL
+func getStringByEncoded(c *fiber.Ctx) error {
+	data, err := findEncoded(c, c.Params("b64value"))
+	if err != nil {
+		return err
+	}
+
+	return sendRecord(c, data)
+}
+
+// deleteStringByEncoded handles DELETE /strings/encoded/:b64value, answering
+// like DELETE /strings/:string_value
+func deleteStringByEncoded(c *fiber.Ctx) error {
+	data, err := findEncoded(c, c.Params("b64value"))
+	if err != nil {
+		return err
+	}
+
+	return deleteValue(c, data.Value)
+}
+
+// findEncoded decodes a base64url value, with or without padding, and looks
+// it up both as text and as a binary value created through value_base64
+func findEncoded(c *fiber.Ctx, encoded string) (*StringData, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil || len(raw) == 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Value must be non-empty base64url")
+	}
+
+	now := time.Now()
+	keys := []string{string(raw), binaryKey(base64.StdEncoding.EncodeToString(raw))}
+	for _, key := range keys {
+		if data, exists := lookup(key); exists && !data.expired(now) {
+			return data, nil
+		}
+	}
+
+	for _, key := range keys {
+		data, err := loadCold(c.UserContext(), key)
+		if err != nil {
+			return nil, err
+		}
+		if data != nil {
+			return data, nil
+		}
+	}
+	return nil, fiber.NewError(fiber.StatusNotFound, "String does not exist in the system")
+}
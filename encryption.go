@@ -0,0 +1,108 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// encodingEncrypted marks records whose value holds base64 AES-256-GCM
+// ciphertext under a key held by the client
+const encodingEncrypted = "aes-256-gcm"
+
+// headerEncryptionKey carries the client's base64 AES-256 key
+const headerEncryptionKey = "X-Encryption-Key"
+
+// parseEncryptionKey reads the key from X-Encryption-Key, if sent. The key
+// is only used for the request and never stored or logged.
+func parseEncryptionKey(c *fiber.Ctx) ([]byte, error) {
+	header := c.Get(headerEncryptionKey)
+	if header == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(header)
+	if err != nil || len(key) != 32 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "X-Encryption-Key must be a base64 256-bit key")
+	}
+	return key, nil
+}
+
+// encryptValue seals a value under key, binding the key ID. The nonce is
+// derived from the key and value, so the same value under the same key
+// always encrypts the same way and conflicts like any other duplicate.
+func encryptValue(key []byte, keyID, value string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	nonce := mac.Sum(nil)[:gcm.NonceSize()]
+
+	sealed := gcm.Seal(nonce, nonce, []byte(value), []byte(keyID))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptRecord returns a copy of an encrypted record holding the
+// plaintext, or 403 when key is not the one it was encrypted with
+func decryptRecord(data *StringData, key []byte) (*StringData, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(data.Value)
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Stored ciphertext is corrupt")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(data.EncryptionKeyID))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusForbidden, "X-Encryption-Key does not match the string's key")
+	}
+
+	decrypted := *data
+	decrypted.Value = string(plaintext)
+	return &decrypted, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// searchableCharacters returns text holding the characters of a record's
+// value. Encrypted records keep none, so character filters never match
+// them.
+func searchableCharacters(data *StringData) string {
+	if data.Encoding == encodingEncrypted {
+		return ""
+	}
+	return data.Value
+}
+
+// redactPlaintextProperties drops the properties that spell out the value
+// or let a guess be confirmed, so encrypted records and pseudonymized
+// exports do not leak it: the character frequency map gives short values
+// away, and the SHA-256 of the plaintext checks a guess. Counts and flags
+// stay.
+func redactPlaintextProperties(properties *StringProperties) {
+	properties.SHA256Hash = ""
+	properties.CharacterFrequencyMap = map[string]int{}
+	properties.Morse = ""
+	properties.NATOPhonetic = ""
+	properties.ROT13Decoded = ""
+	properties.LongestWord = ""
+	properties.ShortestWord = ""
+	properties.AnagramSignature = ""
+	properties.Entities = Entities{}
+	properties.URL = nil
+	properties.Email = nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Entities holds the structured values found inside a string
+type Entities struct {
+	Dates      []string         `json:"dates,omitempty"`
+	Times      []string         `json:"times,omitempty"`
+	Numbers    []float64        `json:"numbers,omitempty"`
+	Currencies []CurrencyAmount `json:"currencies,omitempty"`
+}
+
+// CurrencyAmount is a monetary amount found in a string
+type CurrencyAmount struct {
+	Text     string  `json:"text"`
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency"`
+}
+
+const monthPattern = `(?:jan(?:uary)?|feb(?:ruary)?|mar(?:ch)?|apr(?:il)?|may|jun(?:e)?|jul(?:y)?|aug(?:ust)?|sep(?:t(?:ember)?)?|oct(?:ober)?|nov(?:ember)?|dec(?:ember)?)`
+
+var (
+	datePatterns = []*regexp.Regexp{
+		regexp.MustCompile(`\b\d{4}-\d{2}-\d{2}\b`),
+		regexp.MustCompile(`\b\d{1,2}[/.]\d{1,2}[/.]\d{2,4}\b`),
+		regexp.MustCompile(`(?i)\b` + monthPattern + `\.? \d{1,2}(?:st|nd|rd|th)?,? \d{4}\b`),
+		regexp.MustCompile(`(?i)\b\d{1,2}(?:st|nd|rd|th)? ` + monthPattern + `\.?,? \d{4}\b`),
+	}
+	timePatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)\b\d{1,2}:\d{2}(?::\d{2})?(?:\s?[ap]\.?m\.?)?`),
+		regexp.MustCompile(`(?i)\b\d{1,2}\s?[ap]\.?m\.?`),
+	}
+	currencyPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`([$€£¥₦])\s?(\d[\d,]*(?:\.\d+)?)`),
+		regexp.MustCompile(`(?i)\b(\d[\d,]*(?:\.\d+)?)\s?(usd|eur|gbp|jpy|ngn|cad|aud)\b`),
+	}
+	numberPattern = regexp.MustCompile(`-?\d[\d,]*(?:\.\d+)?`)
+)
+
+// currencySymbols maps symbols to ISO 4217 codes
+var currencySymbols = map[string]string{
+	"$": "USD", "€": "EUR", "£": "GBP", "¥": "JPY", "₦": "NGN",
+}
+
+// extractEntities finds dates, times, currency amounts and other numbers in a value.
+// Numbers that are part of a date, time or amount are not reported again.
+func extractEntities(value string) Entities {
+	var entities Entities
+	var claimed [][]int
+
+	for _, pattern := range datePatterns {
+		for _, loc := range pattern.FindAllStringIndex(value, -1) {
+			if !overlaps(claimed, loc) {
+				entities.Dates = append(entities.Dates, value[loc[0]:loc[1]])
+				claimed = append(claimed, loc)
+			}
+		}
+	}
+
+	for _, pattern := range timePatterns {
+		for _, loc := range pattern.FindAllStringIndex(value, -1) {
+			if !overlaps(claimed, loc) {
+				entities.Times = append(entities.Times, strings.TrimSpace(value[loc[0]:loc[1]]))
+				claimed = append(claimed, loc)
+			}
+		}
+	}
+
+	for i, pattern := range currencyPatterns {
+		for _, loc := range pattern.FindAllStringSubmatchIndex(value, -1) {
+			if overlaps(claimed, loc[:2]) {
+				continue
+			}
+			first, second := value[loc[2]:loc[3]], value[loc[4]:loc[5]]
+			amount, currency := second, currencySymbols[first]
+			if i == 1 {
+				amount, currency = first, strings.ToUpper(second)
+			}
+			entities.Currencies = append(entities.Currencies, CurrencyAmount{
+				Text:     value[loc[0]:loc[1]],
+				Amount:   parseNumber(amount),
+				Currency: currency,
+			})
+			claimed = append(claimed, loc[:2])
+		}
+	}
+
+	for _, loc := range numberPattern.FindAllStringIndex(value, -1) {
+		if !overlaps(claimed, loc) {
+			entities.Numbers = append(entities.Numbers, parseNumber(value[loc[0]:loc[1]]))
+		}
+	}
+
+	return entities
+}
+
+// overlaps reports whether loc intersects any already claimed span
+func overlaps(claimed [][]int, loc []int) bool {
+	for _, span := range claimed {
+		if loc[0] < span[1] && span[0] < loc[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNumber parses a number that may contain thousands separators
+func parseNumber(s string) float64 {
+	val, _ := strconv.ParseFloat(strings.ReplaceAll(s, ",", ""), 64)
+	return val
+}
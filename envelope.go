@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Response schemas selectable with ?schema=
+const (
+	responseSchemaFull    = "full"
+	responseSchemaCompact = "compact"
+	// responseSchemaVersion is bumped on breaking changes to response shapes
+	responseSchemaVersion = "v1"
+)
+
+// headerResponseSchema tells clients which response shape they received
+const headerResponseSchema = "X-Response-Schema"
+
+// compactOmittedProperties are the bulky properties dropped from compact responses
+var compactOmittedProperties = []string{"character_frequency_map", "sha256_hash"}
+
+// responseSchema selects the response shape from ?schema= and labels every
+// response with X-Response-Schema, e.g. "v1.compact". Compact responses
+// drop the character frequency map and hashes from every record's
+// properties, cutting payloads for mobile clients.
+func responseSchema(c *fiber.Ctx) error {
+	schema := c.Query("schema", responseSchemaFull)
+	if schema != responseSchemaFull && schema != responseSchemaCompact {
+		return fiber.NewError(fiber.StatusBadRequest, "schema must be full or compact")
+	}
+
+	if err := c.Next(); err != nil {
+		return err
+	}
+
+	c.Set(headerResponseSchema, responseSchemaVersion+"."+schema)
+
+	if schema == responseSchemaCompact && strings.HasPrefix(string(c.Response().Header.ContentType()), fiber.MIMEApplicationJSON) {
+		var body interface{}
+		if err := json.Unmarshal(c.Response().Body(), &body); err != nil {
+			// Streamed or non-JSON bodies are passed through untouched
+			return nil
+		}
+		compactProperties(body)
+		return c.JSON(body)
+	}
+
+	return nil
+}
+
+// compactProperties removes compactOmittedProperties from every
+// "properties" object nested anywhere in v
+func compactProperties(v interface{}) {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		for key, child := range node {
+			if props, ok := child.(map[string]interface{}); ok && key == "properties" {
+				for _, name := range compactOmittedProperties {
+					delete(props, name)
+				}
+			}
+			compactProperties(child)
+		}
+	case []interface{}:
+		for _, child := range node {
+			compactProperties(child)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// EraseRequest represents the request body for POST /admin/erase. The
+// string is named by its value or its ID.
+type EraseRequest struct {
+	Value string `json:"value"`
+	ID    string `json:"id"`
+}
+
+// ErasedCopies counts what an erasure removed
+type ErasedCopies struct {
+	Record              bool     `json:"record"`
+	Collections         []string `json:"collections"`
+	Events              int      `json:"events"`
+	IdempotentResponses int      `json:"idempotent_responses"`
+	WALEntries          int      `json:"wal_entries"`
+}
+
+// ErasureReceipt is the response for POST /admin/erase. It names the value
+// by its SHA-256 only, so the receipt can be kept as proof of the erasure
+// without keeping the value.
+type ErasureReceipt struct {
+	ReceiptID   string       `json:"receipt_id"`
+	ValueSHA256 string       `json:"value_sha256"`
+	RequestedAt time.Time    `json:"requested_at"`
+	CompletedAt time.Time    `json:"completed_at"`
+	Erased      ErasedCopies `json:"erased"`
+	// Pending lists where copies remain until the next snapshot rewrites
+	// them
+	Pending []string `json:"pending,omitempty"`
+}
+
+// eraseString handles POST /admin/erase, removing every copy of a value the
+// service holds: the record, soft-deleted or not, in memory and in the
+// backend, its indexes, its strings in collections, the change-feed events
+// and remembered idempotent responses mentioning it, and its WAL entries.
+// With SNAPSHOT_PATH set the last snapshot and the WAL keep it until the
+// next snapshot. Backups and finished exports are not rewritten.
+func eraseString(c *fiber.Ctx) error {
+	requestedAt := time.Now().UTC()
+
+	var req EraseRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if (req.Value == "") == (req.ID == "") {
+		return fiber.NewError(fiber.StatusBadRequest, "Send exactly one of 'value' or 'id'")
+	}
+
+	value := req.Value
+	if req.ID != "" {
+		found, err := findValueByID(c, req.ID)
+		if err != nil {
+			return err
+		}
+		if found == nil {
+			return fiber.NewError(fiber.StatusNotFound, "No string with this ID; erase by value to remove other references to it")
+		}
+		value = found.Value
+	}
+
+	// Pull the record in from the backend so removing it deletes it there
+	if _, err := loadCold(c.UserContext(), value); err != nil {
+		return err
+	}
+
+	var erased ErasedCopies
+	var record *StringData
+
+	shard := shardFor(value)
+	shard.Lock()
+	if record = shard.records[value]; record == nil {
+		record = shard.deleted[value]
+	}
+	if record != nil {
+		shard.removeLocked(value)
+		erased.Record = true
+	}
+	shard.Unlock()
+
+	erased.Collections = eraseFromCollections(value)
+	erased.Events = eraseEvents(value)
+	erased.IdempotentResponses = eraseIdempotentResponses(value, record)
+
+	if !erased.Record && len(erased.Collections) == 0 && erased.Events == 0 && erased.IdempotentResponses == 0 {
+		return fiber.NewError(fiber.StatusNotFound, "String does not exist in the system")
+	}
+
+	receipt := ErasureReceipt{
+		ValueSHA256: computeSHA256(displayValue(value)),
+		RequestedAt: requestedAt,
+		Erased:      erased,
+	}
+
+	// Without snapshots nothing else replays the WAL, so the value's
+	// entries, the delete just logged included, can go right away
+	switch {
+	case config.SnapshotPath != "":
+		receipt.Pending = []string{"snapshot", "wal"}
+	case config.WALPath != "":
+		dropped, err := rewriteWAL(func(entry walEntry) bool { return entry.Value == value })
+		if err != nil {
+			return err
+		}
+		receipt.Erased.WALEntries = dropped
+	}
+
+	if record != nil {
+		publishEvent(Event{Type: eventStringErased, ID: record.ID, Actor: requestActor(c)})
+	}
+
+	id, err := newExportID()
+	if err != nil {
+		return err
+	}
+	receipt.ReceiptID = id
+	receipt.CompletedAt = time.Now().UTC()
+	log.Printf("erasure %s completed for value with SHA-256 %s", receipt.ReceiptID, receipt.ValueSHA256)
+
+	return c.JSON(receipt)
+}
+
+// findValueByID resolves a record ID, as given or lowercased, or a SHA-256
+// to the record holding it, soft-deleted and expired records included, or
+// nil
+func findValueByID(c *fiber.Ctx, id string) (*StringData, error) {
+	if !isHexPrefix(strings.ToLower(id)) && validateClientID(id) != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "id must be a hexadecimal hash or a client-supplied ID")
+	}
+
+	for _, candidate := range []string{id, strings.ToLower(id)} {
+		if data, ok := lookupIDs([]string{candidate})[candidate]; ok {
+			return data, nil
+		}
+	}
+	if data := findDeletedByID(id); data != nil {
+		return data, nil
+	}
+
+	id = strings.ToLower(id)
+	if len(id) != 64 || !isHexPrefix(id) {
+		return nil, nil
+	}
+	if data := lookupHash(id); data != nil {
+		return data, nil
+	}
+
+	data, err := loadColdByHash(c.UserContext(), id)
+	if err != nil || data != nil {
+		return data, err
+	}
+	// Soft-deleted records are cached but reported as missing
+	return findDeletedByID(id), nil
+}
+
+// eraseFromCollections removes a value from every collection and returns
+// the names of those that held it
+func eraseFromCollections(value string) []string {
+	collections.RLock()
+	defer collections.RUnlock()
+
+	names := []string{}
+	for name, col := range collections.byName {
+		col.Lock()
+		if _, exists := col.records[value]; exists {
+			col.removeLocked(value)
+			names = append(names, name)
+		}
+		col.Unlock()
+	}
+	return names
+}
+
+// eraseEvents drops the change-feed events mentioning a value, before or
+// after the change, and returns how many it dropped
+func eraseEvents(value string) int {
+	mentions := func(data *StringData) bool { return data != nil && data.Value == value }
+
+	eventLog.Lock()
+	defer eventLog.Unlock()
+
+	kept := eventLog.events[:0]
+	for _, event := range eventLog.events {
+		if event.Value == value || event.PreviousValue == value || mentions(event.before) || mentions(event.after) {
+			delete(eventLog.undone, event.Sequence)
+			continue
+		}
+		kept = append(kept, event)
+	}
+	erased := len(eventLog.events) - len(kept)
+	// Clear the tail so dropped events are not kept reachable
+	for i := len(kept); i < len(eventLog.events); i++ {
+		eventLog.events[i] = Event{}
+	}
+	eventLog.events = kept
+	return erased
+}
+
+// eraseIdempotentResponses forgets the remembered responses holding a value
+// or its record's ID, and returns how many it forgot. Retrying one of those
+// requests runs it again.
+func eraseIdempotentResponses(value string, record *StringData) int {
+	encoded, err := json.Marshal(displayValue(value))
+	if err != nil {
+		return 0
+	}
+	var id []byte
+	if record != nil {
+		id = []byte(record.ID)
+	}
+
+	idempotencyKeys.Lock()
+	defer idempotencyKeys.Unlock()
+
+	erased := 0
+	for key, response := range idempotencyKeys.responses {
+		if response.body == nil {
+			continue
+		}
+		if bytes.Contains(response.body, encoded) || (id != nil && bytes.Contains(response.body, id)) {
+			delete(idempotencyKeys.responses, key)
+			erased++
+		}
+	}
+	return erased
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// recordETag is a strong validator of a record. Records are replaced on
+// every change, so it is derived from the whole record.
+func recordETag(data *StringData) string {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		// Records always marshal; fall back to something that never matches
+		return `"invalid"`
+	}
+	return `"` + computeSHA256(string(encoded))[:32] + `"`
+}
+
+// listETag is a weak validator of a page of a listing: the store
+// generation read before running it, the query, the total number of
+// matches, and the earliest expiry among the results, since an expiring
+// string changes the listing without changing the store
+func listETag(generation uint64, query string, total int, data []StringData) string {
+	var earliest int64
+	for i := range data {
+		if expires := data[i].ExpiresAt; expires != nil && (earliest == 0 || expires.UnixNano() < earliest) {
+			earliest = expires.UnixNano()
+		}
+	}
+	key := strconv.FormatUint(generation, 10) + "\x00" + query + "\x00" + strconv.Itoa(total) + "\x00" + strconv.FormatInt(earliest, 10)
+	return `W/"` + computeSHA256(key)[:32] + `"`
+}
+
+// sendRecord responds with a record and its ETag, or to a GET with 304 when
+// it matches If-None-Match. Usage is not covered by the ETag, so requests
+// for it are always answered in full.
+func sendRecord(c *fiber.Ctx, data *StringData) error {
+	etag := recordETag(data)
+	c.Set(fiber.HeaderETag, etag)
+	usage := includeUsage(c)
+	if c.Method() == fiber.MethodGet && !usage && noneMatch(c, etag) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	if usage {
+		withUsage := *data
+		attachUsage(&withUsage)
+		data = &withUsage
+	}
+
+	data, err := decryptForRequest(c, data)
+	if err != nil {
+		return err
+	}
+	return c.JSON(data)
+}
+
+// decryptForRequest returns an encrypted record as plaintext when the
+// request holds its key in X-Encryption-Key, and any other record as is
+func decryptForRequest(c *fiber.Ctx, data *StringData) (*StringData, error) {
+	if data.Encoding != encodingEncrypted {
+		return data, nil
+	}
+	key, err := parseEncryptionKey(c)
+	if err != nil || key == nil {
+		return data, err
+	}
+	return decryptRecord(data, key)
+}
+
+// noneMatch reports whether If-None-Match lists etag, comparing weakly
+func noneMatch(c *fiber.Ctx, etag string) bool {
+	header := c.Get(fiber.HeaderIfNoneMatch)
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch enforces If-Match on a write to current, answering 412 when
+// the record has changed since the client read it. Without the header the
+// write goes ahead, unless REQUIRE_IF_MATCH is set. Caller must hold the
+// lock of current's shard, so nothing changes between check and write.
+func checkIfMatch(c *fiber.Ctx, current *StringData) error {
+	header := c.Get(fiber.HeaderIfMatch)
+	if header == "" {
+		if config.RequireIfMatch {
+			return fiber.NewError(fiber.StatusPreconditionRequired, "If-Match header with the string's ETag is required")
+		}
+		return nil
+	}
+
+	etag := recordETag(current)
+	for _, candidate := range strings.Split(header, ",") {
+		// Weak validators never match under If-Match
+		if candidate = strings.TrimSpace(candidate); candidate == "*" || candidate == etag {
+			return nil
+		}
+	}
+
+	c.Set(fiber.HeaderETag, etag)
+	return fiber.NewError(fiber.StatusPreconditionFailed, "String has changed since it was read; fetch it again and retry")
+}
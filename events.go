@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Event types published on the change feed and to webhooks
+const (
+	eventStringCreated     = "string_created"
+	eventStringDeleted     = "string_deleted"
+	eventPropertiesChanged = "properties_changed"
+	eventStringUpdated     = "string_updated"
+	eventStringRestored    = "string_restored"
+	eventStringPurged      = "string_purged"
+	eventStringExpired     = "string_expired"
+	eventStringErased      = "string_erased"
+)
+
+// Event describes one change to the stored strings
+type Event struct {
+	Sequence      int64                     `json:"sequence"`
+	Type          string                    `json:"type"`
+	ID            string                    `json:"id"`
+	Value         string                    `json:"value"`
+	PreviousValue string                    `json:"previous_value,omitempty"`
+	Actor         string                    `json:"actor,omitempty"`
+	Time          time.Time                 `json:"time"`
+	Changes       map[string]PropertyChange `json:"changes,omitempty"`
+	Undoes        int64                     `json:"undoes,omitempty"`
+	// before and after are the record around the change, kept for undo
+	before, after *StringData
+}
+
+// eventJSON is Event without its JSON method
+type eventJSON Event
+
+// MarshalJSON writes binary values as their bare base64
+func (e Event) MarshalJSON() ([]byte, error) {
+	e.Value, e.PreviousValue = displayValue(e.Value), displayValue(e.PreviousValue)
+	return json.Marshal(eventJSON(e))
+}
+
+// PropertyChange holds a property's value before and after reanalysis
+type PropertyChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// EventsResponse represents the response for GET /events
+type EventsResponse struct {
+	Events       []Event `json:"events"`
+	Count        int     `json:"count"`
+	NextSequence int64   `json:"next_sequence"`
+}
+
+// ReanalyzeResponse represents the response for POST /admin/reanalyze
+type ReanalyzeResponse struct {
+	Reanalyzed int `json:"reanalyzed"`
+	Changed    int `json:"changed"`
+}
+
+// eventLog keeps the most recent events in memory for the change feed
+var eventLog struct {
+	sync.Mutex
+	events []Event
+	next   int64
+	// undone holds the sequences of events that have been reversed
+	undone map[int64]bool
+}
+
+// webhookClient delivers events to WEBHOOK_URLS
+var webhookClient = &http.Client{Timeout: 5 * time.Second}
+
+// publishEvent appends an event to the change feed and delivers it to every
+// configured webhook in the background
+func publishEvent(event Event) {
+	eventLog.Lock()
+	eventLog.next++
+	event.Sequence = eventLog.next
+	event.Time = time.Now().UTC()
+	eventLog.events = append(eventLog.events, event)
+	if excess := len(eventLog.events) - config.EventLogSize; excess > 0 {
+		for _, evicted := range eventLog.events[:excess] {
+			delete(eventLog.undone, evicted.Sequence)
+		}
+		eventLog.events = append([]Event(nil), eventLog.events[excess:]...)
+	}
+	eventLog.Unlock()
+
+	for _, url := range strings.Split(config.WebhookURLs, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			go deliverWebhook(url, event)
+		}
+	}
+}
+
+// deliverWebhook posts an event to a webhook, logging failures
+func deliverWebhook(url string, event Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("webhook %s: encoding event %d: %v", url, event.Sequence, err)
+		return
+	}
+
+	resp, err := webhookClient.Post(url, fiber.MIMEApplicationJSON, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("webhook %s: delivering event %d: %v", url, event.Sequence, err)
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		log.Printf("webhook %s: event %d rejected with status %d", url, event.Sequence, resp.StatusCode)
+	}
+}
+
+// getEvents handles GET /events, returning events after the ?since= sequence
+func getEvents(c *fiber.Ctx) error {
+	var since int64
+	if raw := c.Query("since"); raw != "" {
+		val, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || val < 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid value for since")
+		}
+		since = val
+	}
+
+	eventLog.Lock()
+	events := []Event{}
+	for _, event := range eventLog.events {
+		if event.Sequence > since {
+			events = append(events, event)
+		}
+	}
+	next := eventLog.next + 1
+	eventLog.Unlock()
+
+	return c.JSON(EventsResponse{
+		Events:       events,
+		Count:        len(events),
+		NextSequence: next,
+	})
+}
+
+// propertyDiff compares two property sets field by field using their JSON
+// names, returning only the fields that differ
+func propertyDiff(before, after StringProperties) map[string]PropertyChange {
+	old, err := propertyFields(before)
+	if err != nil {
+		return nil
+	}
+	updated, err := propertyFields(after)
+	if err != nil {
+		return nil
+	}
+
+	changes := make(map[string]PropertyChange)
+	for name, val := range old {
+		if !reflect.DeepEqual(val, updated[name]) {
+			changes[name] = PropertyChange{Before: val, After: updated[name]}
+		}
+	}
+	for name, val := range updated {
+		if _, ok := old[name]; !ok {
+			changes[name] = PropertyChange{After: val}
+		}
+	}
+
+	return changes
+}
+
+// propertyFields flattens properties into their JSON fields
+func propertyFields(properties StringProperties) (map[string]interface{}, error) {
+	encoded, err := json.Marshal(properties)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]interface{}
+	err = json.Unmarshal(encoded, &fields)
+	return fields, err
+}
+
+// reanalyzeStrings handles POST /admin/reanalyze. Every stored string is
+// analyzed again with the current analyzers and a properties_changed event
+// is published for each one whose properties differ.
+func reanalyzeStrings(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	actor := requestActor(c)
+	profile := defaultProfile.Load()
+
+	records := allRecords()
+
+	var response ReanalyzeResponse
+	for _, data := range records {
+		// Encrypted values cannot be read without the client's key
+		if data.DeletedAt != nil || data.Encoding == encodingEncrypted {
+			continue
+		}
+		properties, err := analyzeString(ctx, rawValue(data), data.Encoding, profile)
+		if err != nil {
+			return contextError(err)
+		}
+		response.Reanalyzed++
+
+		changes := propertyDiff(data.Properties, properties)
+		if len(changes) == 0 {
+			continue
+		}
+
+		// Skip records deleted or replaced while analysis ran
+		shard := shardFor(data.Value)
+		shard.Lock()
+		if shard.records[data.Value] != data {
+			shard.Unlock()
+			continue
+		}
+		updated := *data
+		updated.Properties = properties
+		updated.UpdatedAt = time.Now().UTC()
+		shard.putLocked(&updated)
+		shard.Unlock()
+
+		response.Changed++
+		publishEvent(Event{
+			Type:    eventPropertiesChanged,
+			ID:      updated.ID,
+			Value:   updated.Value,
+			Actor:   actor,
+			Changes: changes,
+			before:  data,
+			after:   &updated,
+		})
+	}
+
+	return c.JSON(response)
+}
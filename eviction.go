@@ -0,0 +1,206 @@
+package main
+
+import (
+	"math/rand/v2"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Eviction policies applied once MAX_ENTRIES or MAX_BYTES is reached
+const (
+	evictionLRU = "lru"
+	evictionLFU = "lfu"
+)
+
+// Like Redis, eviction approximates its policy by sampling instead of
+// keeping every entry ordered on each read
+const (
+	// evictionSampleSize is how many entries per shard are compared
+	evictionSampleSize = 16
+	// evictionShardSample is how many shards besides the writer's own are sampled
+	evictionShardSample = 4
+)
+
+// headerEvicted reports how many strings have been evicted since startup
+const headerEvicted = "X-Evicted"
+
+// accessEntry tracks how recently and how often a stored string was used,
+// and how often clients re-submitted it. The counters are atomic so reads
+// holding only a shard's read lock can bump them.
+type accessEntry struct {
+	bytes         int
+	lastAccess    atomic.Int64
+	hits          atomic.Uint64
+	submissions   atomic.Uint64
+	lastSubmitted atomic.Int64
+}
+
+// evicted counts the strings evicted since startup
+var evicted atomic.Uint64
+
+// EvictionResponse represents the response for GET /admin/eviction
+type EvictionResponse struct {
+	Policy     string `json:"policy"`
+	MaxEntries int    `json:"max_entries"`
+	MaxBytes   int    `json:"max_bytes"`
+	Entries    int    `json:"entries"`
+	Bytes      int    `json:"bytes"`
+	Evicted    uint64 `json:"evicted"`
+}
+
+// evictionEnabled reports whether a cap on stored strings is configured
+func evictionEnabled() bool {
+	return config.MaxEntries > 0 || config.MaxBytes > 0
+}
+
+// trackLocked starts or refreshes usage tracking for a stored string.
+// Values count towards MAX_BYTES by their length. Caller must hold the
+// shard lock.
+func (s *storeShard) trackLocked(data *StringData) {
+	entry, exists := s.usage[data.Value]
+	if !exists {
+		entry = &accessEntry{}
+		s.usage[data.Value] = entry
+	}
+	storeBytes.Add(int64(len(data.Value) - entry.bytes))
+	entry.bytes = len(data.Value)
+	s.touchLocked(data.Value)
+}
+
+// untrackLocked stops usage tracking for a removed string. Caller must hold
+// the shard lock.
+func (s *storeShard) untrackLocked(value string) {
+	if entry, exists := s.usage[value]; exists {
+		storeBytes.Add(-int64(entry.bytes))
+		delete(s.usage, value)
+	}
+}
+
+// touchLocked records a use of a stored string. Caller must hold the shard
+// lock for reading or writing.
+func (s *storeShard) touchLocked(value string) {
+	if entry, exists := s.usage[value]; exists {
+		entry.lastAccess.Store(time.Now().UnixNano())
+		entry.hits.Add(1)
+	}
+}
+
+// overCapacity reports whether the store exceeds MAX_ENTRIES or MAX_BYTES
+func overCapacity() bool {
+	return (config.MaxEntries > 0 && storeCount.Load() > int64(config.MaxEntries)) ||
+		(config.MaxBytes > 0 && storeBytes.Load() > int64(config.MaxBytes))
+}
+
+// enforceLimitsLocked evicts strings other than keep until the store fits
+// MAX_ENTRIES and MAX_BYTES. Without a backend eviction deletes the string;
+// with one it only drops it from memory. Caller must hold the shard lock.
+func (s *storeShard) enforceLimitsLocked(keep string) {
+	for overCapacity() {
+		if !s.evictOneLocked(keep) {
+			// Every other shard is busy or empty; a later write catches up
+			return
+		}
+	}
+}
+
+// evictOneLocked evicts the best candidate found by sampling this shard and
+// a few others. Other shards are only tried with TryLock, since waiting on
+// them while holding this shard's lock could deadlock. Caller must hold the
+// shard lock.
+func (s *storeShard) evictOneLocked(keep string) bool {
+	candidates := []*storeShard{s}
+	start := rand.IntN(storeShardCount)
+	for i := 0; i < storeShardCount && len(candidates) <= evictionShardSample; i++ {
+		other := shards[(start+i)%storeShardCount]
+		if other == s || !other.TryLock() {
+			continue
+		}
+		if len(other.usage) == 0 {
+			other.Unlock()
+			continue
+		}
+		candidates = append(candidates, other)
+	}
+	defer func() {
+		for _, other := range candidates[1:] {
+			other.Unlock()
+		}
+	}()
+
+	var victimShard *storeShard
+	var victim string
+	var victimEntry *accessEntry
+	for _, shard := range candidates {
+		value, entry := shard.pickVictimLocked(keep)
+		if entry != nil && (victimEntry == nil || usedLess(entry, victimEntry)) {
+			victimShard, victim, victimEntry = shard, value, entry
+		}
+	}
+	if victimShard == nil {
+		return false
+	}
+
+	if backend == nil {
+		victimShard.removeLocked(victim)
+	} else {
+		victimShard.uncacheLocked(victim)
+	}
+	evicted.Add(1)
+	return true
+}
+
+// pickVictimLocked samples the shard's strings and returns the least
+// recently (lru) or least frequently (lfu) used one other than keep and
+// pinned strings. Caller must hold the shard lock.
+func (s *storeShard) pickVictimLocked(keep string) (string, *accessEntry) {
+	var victim string
+	var victimEntry *accessEntry
+
+	sampled := 0
+	for value, entry := range s.usage {
+		if data := s.records[value]; value == keep || data != nil && data.Pinned {
+			continue
+		}
+		if victimEntry == nil || usedLess(entry, victimEntry) {
+			victim, victimEntry = value, entry
+		}
+		if sampled++; sampled == evictionSampleSize {
+			break
+		}
+	}
+
+	return victim, victimEntry
+}
+
+// usedLess reports whether a is a better eviction candidate than b
+func usedLess(a, b *accessEntry) bool {
+	if config.EvictionPolicy == evictionLFU && a.hits.Load() != b.hits.Load() {
+		return a.hits.Load() < b.hits.Load()
+	}
+	return a.lastAccess.Load() < b.lastAccess.Load()
+}
+
+// evictionHeader labels every response with the eviction counter when a
+// cap is configured, so operators can spot entries being dropped
+func evictionHeader(c *fiber.Ctx) error {
+	err := c.Next()
+	if evictionEnabled() {
+		c.Set(headerEvicted, strconv.FormatUint(evicted.Load(), 10))
+	}
+	return err
+}
+
+// getEviction handles GET /admin/eviction
+func getEviction(c *fiber.Ctx) error {
+	return c.JSON(EvictionResponse{
+		Policy:     config.EvictionPolicy,
+		MaxEntries: config.MaxEntries,
+		MaxBytes:   config.MaxBytes,
+		Entries:    int(storeCount.Load()),
+		Bytes:      int(storeBytes.Load()),
+		Evicted:    evicted.Load(),
+	})
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// runExpirySweeper removes expired strings every interval until ctx is done.
+// Reads already treat them as absent; sweeping frees their memory.
+func runExpirySweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			sweepExpired(now)
+		}
+	}
+}
+
+// sweepExpired removes the strings expired at now, one shard or collection
+// at a time, publishing a string_expired event for each one outside a
+// collection. It returns how many it removed.
+func sweepExpired(now time.Time) int {
+	swept := 0
+	for _, shard := range shards {
+		var expired []*StringData
+
+		shard.Lock()
+		for _, data := range shard.records {
+			if data.expired(now) {
+				expired = append(expired, data)
+			}
+		}
+		for _, data := range expired {
+			shard.removeLocked(data.Value)
+		}
+		shard.Unlock()
+
+		for _, data := range expired {
+			publishEvent(Event{
+				Type:   eventStringExpired,
+				ID:     data.ID,
+				Value:  data.Value,
+				before: data,
+			})
+		}
+		swept += len(expired)
+	}
+
+	collections.RLock()
+	for _, col := range collections.byName {
+		col.Lock()
+		swept += col.sweepExpiredLocked(now)
+		col.Unlock()
+	}
+	collections.RUnlock()
+
+	return swept
+}
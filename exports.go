@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Export job states
+const (
+	exportRunning   = "running"
+	exportCompleted = "completed"
+	exportFailed    = "failed"
+)
+
+// exportProgressInterval is how many records are written between progress updates
+const exportProgressInterval = 1000
+
+// ExportJob describes an asynchronous export of the strings matching a set
+// of filters
+type ExportJob struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Format string `json:"format"`
+	// Pseudonymized exports carry a keyed HMAC of each value instead of
+	// the value
+	Pseudonymized bool                   `json:"pseudonymized,omitempty"`
+	Filters       map[string]interface{} `json:"filters"`
+	Total         int                    `json:"total"`
+	Exported      int                    `json:"exported"`
+	CreatedAt     time.Time              `json:"created_at"`
+	CompletedAt   *time.Time             `json:"completed_at,omitempty"`
+	ExpiresAt     *time.Time             `json:"expires_at,omitempty"`
+	Error         string                 `json:"error,omitempty"`
+	DownloadURL   string                 `json:"download_url,omitempty"`
+	// path is the finished artifact on disk
+	path string
+	// pseudonymKey keys the HMAC of pseudonymized values
+	pseudonymKey []byte
+}
+
+// exportJobs holds every job until its artifact expires
+var exportJobs = struct {
+	sync.Mutex
+	jobs map[string]*ExportJob
+}{jobs: make(map[string]*ExportJob)}
+
+// createExport handles POST /exports, starting a job that writes the strings
+// matching the GET /strings filters in the query to NDJSON (gzip-compressed
+// with ?format=gzip, values replaced by a keyed HMAC with
+// ?pseudonymize=true). The response is 202 with the job to poll.
+func createExport(c *fiber.Ctx) error {
+	format := c.Query("format", "ndjson")
+	if format != "ndjson" && format != "gzip" {
+		return fiber.NewError(fiber.StatusBadRequest, "format must be ndjson or gzip")
+	}
+
+	filters, err := parseQueryFilters(c)
+	if err != nil {
+		return err
+	}
+
+	id, err := newExportID()
+	if err != nil {
+		return err
+	}
+
+	job := &ExportJob{
+		ID:            id,
+		Status:        exportRunning,
+		Format:        format,
+		Pseudonymized: c.QueryBool("pseudonymize"),
+		Filters:       filters,
+		CreatedAt:     time.Now().UTC(),
+	}
+	if job.Pseudonymized {
+		if job.pseudonymKey, err = newPseudonymKey(config.PseudonymizeSecret); err != nil {
+			return err
+		}
+	}
+
+	exportJobs.Lock()
+	pruneExportsLocked(time.Now())
+	exportJobs.jobs[id] = job
+	exportJobs.Unlock()
+
+	go runExport(job)
+
+	c.Location("/exports/" + id)
+	return c.Status(fiber.StatusAccepted).JSON(exportStatus(job))
+}
+
+// getExport handles GET /exports/:id
+func getExport(c *fiber.Ctx) error {
+	job, err := findExport(c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(exportStatus(job))
+}
+
+// downloadExport handles GET /exports/:id/download, streaming the artifact
+// of a completed job
+func downloadExport(c *fiber.Ctx) error {
+	job, err := findExport(c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	exportJobs.Lock()
+	status, path, format, createdAt := job.Status, job.path, job.Format, job.CreatedAt
+	exportJobs.Unlock()
+
+	if status != exportCompleted {
+		return fiber.NewError(fiber.StatusConflict, "Export is "+status+"; poll /exports/"+job.ID+" until it completes")
+	}
+
+	contentType := "application/x-ndjson"
+	if format == "gzip" {
+		contentType = "application/gzip"
+	}
+	c.Attachment(backupFilename(createdAt, format == "gzip"))
+	c.Set(fiber.HeaderContentType, contentType)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fiber.NewError(fiber.StatusGone, "Export artifact is no longer available")
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	// fasthttp closes the file once it has been streamed
+	return c.SendStream(file, int(info.Size()))
+}
+
+// findExport looks a job up by ID
+func findExport(id string) (*ExportJob, error) {
+	exportJobs.Lock()
+	defer exportJobs.Unlock()
+
+	pruneExportsLocked(time.Now())
+	job, ok := exportJobs.jobs[id]
+	if !ok {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Export does not exist")
+	}
+	return job, nil
+}
+
+// exportStatus copies a job for a response while holding the jobs lock
+func exportStatus(job *ExportJob) ExportJob {
+	exportJobs.Lock()
+	defer exportJobs.Unlock()
+
+	status := *job
+	if status.Status == exportCompleted {
+		status.DownloadURL = "/exports/" + job.ID + "/download"
+	}
+	return status
+}
+
+// runExport collects the matching records and writes them to a temp file,
+// reporting progress on the job as it goes
+func runExport(job *ExportJob) {
+	records := exportRecords(job.Filters)
+
+	exportJobs.Lock()
+	job.Total = len(records)
+	exportJobs.Unlock()
+
+	path, err := writeExport(job, records)
+
+	now := time.Now().UTC()
+	expiresAt := now.Add(config.ExportTTL)
+
+	exportJobs.Lock()
+	defer exportJobs.Unlock()
+
+	job.CompletedAt = &now
+	job.ExpiresAt = &expiresAt
+	if err != nil {
+		log.Printf("export %s failed: %v", job.ID, err)
+		job.Status, job.Error = exportFailed, err.Error()
+		return
+	}
+	job.Status, job.path, job.Exported = exportCompleted, path, len(records)
+}
+
+// exportRecords returns the live records matching filters, without the
+// MAX_RESULTS cap applied to listings
+func exportRecords(filters map[string]interface{}) []*StringData {
+	plan := planFilters(filters)
+	now := time.Now()
+
+	var records []*StringData
+	for _, shard := range shards {
+		shard.RLock()
+		for _, data := range shard.records {
+			if !data.expired(now) && plan.matches(data) {
+				records = append(records, data)
+			}
+		}
+		shard.RUnlock()
+	}
+	return records
+}
+
+// writeExport encodes records to a new file in EXPORT_DIR and returns its path
+func writeExport(job *ExportJob, records []*StringData) (string, error) {
+	file, err := os.CreateTemp(config.ExportDir, "export-"+job.ID+"-*")
+	if err != nil {
+		return "", err
+	}
+
+	fail := func(err error) (string, error) {
+		file.Close()
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	buffered := bufio.NewWriter(file)
+	var out io.Writer = buffered
+	var gz *gzip.Writer
+	if job.Format == "gzip" {
+		gz = gzip.NewWriter(buffered)
+		out = gz
+	}
+
+	encoder := json.NewEncoder(out)
+	for i, data := range records {
+		if job.Pseudonymized {
+			data = pseudonymize(data, job.pseudonymKey)
+		}
+		if err := encoder.Encode(data); err != nil {
+			return fail(err)
+		}
+		if (i+1)%exportProgressInterval == 0 {
+			exportJobs.Lock()
+			job.Exported = i + 1
+			exportJobs.Unlock()
+		}
+	}
+
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return fail(err)
+		}
+	}
+	if err := buffered.Flush(); err != nil {
+		return fail(err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	return file.Name(), nil
+}
+
+// pseudonymHashAlgorithm names the hash of pseudonymized values and IDs
+const pseudonymHashAlgorithm = "hmac-sha256"
+
+// newPseudonymKey returns the PSEUDONYMIZE_SECRET key, or a random key for
+// a single export when it is unset
+func newPseudonymKey(secret string) ([]byte, error) {
+	if secret != "" {
+		return []byte(secret), nil
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// pseudonymize returns a copy of a record whose value, and ID unless the
+// client chose it, are replaced by an HMAC of the value under key, for
+// sharing datasets without the underlying text. An unkeyed hash would be
+// reversed by hashing guesses. Properties are kept, except those that
+// spell out the value or confirm a guess.
+func pseudonymize(data *StringData, key []byte) *StringData {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data.Value))
+
+	masked := *data
+	masked.Value = hex.EncodeToString(mac.Sum(nil))
+	if !masked.ClientSuppliedID {
+		masked.ID = masked.Value
+	}
+	masked.HashAlgorithm = pseudonymHashAlgorithm
+	masked.Encoding = ""
+	redactPlaintextProperties(&masked.Properties)
+	return &masked
+}
+
+// pruneExportsLocked forgets jobs whose artifacts have expired and deletes
+// their files. Caller must hold exportJobs.
+func pruneExportsLocked(now time.Time) {
+	for id, job := range exportJobs.jobs {
+		if job.ExpiresAt == nil || now.Before(*job.ExpiresAt) {
+			continue
+		}
+		if job.path != "" {
+			os.Remove(job.path)
+		}
+		delete(exportJobs.jobs, id)
+	}
+}
+
+// newExportID returns a random job ID
+func newExportID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxFaultLatency caps the latency a fault rule may add
+const maxFaultLatency = time.Minute
+
+// FaultRule slows down or fails the public requests it matches, for
+// testing how clients cope. Path is a request path, or a prefix when it
+// ends in "*"; an empty method matches any. Latency, plus up to JitterMs
+// more at random, is added before the request is handled, then with
+// probability ErrorRate it fails with Status without being handled, as if
+// storage were unavailable.
+type FaultRule struct {
+	Method    string  `json:"method,omitempty"`
+	Path      string  `json:"path"`
+	LatencyMs int     `json:"latency_ms,omitempty"`
+	JitterMs  int     `json:"jitter_ms,omitempty"`
+	ErrorRate float64 `json:"error_rate,omitempty"`
+	Status    int     `json:"status,omitempty"`
+}
+
+// FaultsRequest represents the request body for PUT /admin/faults
+type FaultsRequest struct {
+	Rules []FaultRule `json:"rules"`
+}
+
+// FaultsResponse represents the response for GET and PUT /admin/faults
+type FaultsResponse struct {
+	Rules []FaultRule `json:"rules"`
+	Count int         `json:"count"`
+}
+
+// faults holds the fault rules in force; the first matching rule applies
+var faults struct {
+	sync.RWMutex
+	rules []FaultRule
+}
+
+// injectFaults applies the first fault rule matching a request. Admin
+// routes and health checks are exempt, so faults can always be lifted.
+func injectFaults(c *fiber.Ctx) error {
+	path := c.Path()
+	if strings.HasPrefix(path, "/admin") || path == "/healthz" || path == "/readyz" {
+		return c.Next()
+	}
+
+	rule, ok := matchFault(c.Method(), path)
+	if !ok {
+		return c.Next()
+	}
+
+	delay := time.Duration(rule.LatencyMs) * time.Millisecond
+	if rule.JitterMs > 0 {
+		delay += time.Duration(rand.IntN(rule.JitterMs+1)) * time.Millisecond
+	}
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-c.Context().Done():
+		}
+	}
+
+	if rule.ErrorRate > 0 && rand.Float64() < rule.ErrorRate {
+		c.Set("X-Fault-Injected", "true")
+		return fiber.NewError(rule.Status, "Injected storage failure")
+	}
+	return c.Next()
+}
+
+// matchFault returns the first rule matching a request
+func matchFault(method, path string) (FaultRule, bool) {
+	faults.RLock()
+	defer faults.RUnlock()
+
+	for _, rule := range faults.rules {
+		if rule.Method != "" && rule.Method != method {
+			continue
+		}
+		if prefix, ok := strings.CutSuffix(rule.Path, "*"); ok && strings.HasPrefix(path, prefix) || rule.Path == path {
+			return rule, true
+		}
+	}
+	return FaultRule{}, false
+}
+
+// getFaults handles GET /admin/faults
+func getFaults(c *fiber.Ctx) error {
+	faults.RLock()
+	rules := append([]FaultRule{}, faults.rules...)
+	faults.RUnlock()
+
+	return c.JSON(FaultsResponse{Rules: rules, Count: len(rules)})
+}
+
+// putFaults handles PUT /admin/faults, replacing every fault rule. Only
+// served with FAULT_INJECTION=true.
+func putFaults(c *fiber.Ctx) error {
+	var req FaultsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	if req.Rules == nil {
+		return fiber.NewError(fiber.StatusBadRequest, "'rules' is required")
+	}
+
+	for i := range req.Rules {
+		rule := &req.Rules[i]
+		rule.Method = strings.ToUpper(rule.Method)
+		if !strings.HasPrefix(rule.Path, "/") {
+			return fiber.NewError(fiber.StatusBadRequest, "Fault paths must start with '/'")
+		}
+		if rule.LatencyMs < 0 || rule.JitterMs < 0 || time.Duration(rule.LatencyMs+rule.JitterMs)*time.Millisecond > maxFaultLatency {
+			return fiber.NewError(fiber.StatusBadRequest, "latency_ms and jitter_ms must be non-negative and add up to at most a minute")
+		}
+		if rule.ErrorRate < 0 || rule.ErrorRate > 1 {
+			return fiber.NewError(fiber.StatusBadRequest, "error_rate must be from 0 to 1")
+		}
+		if rule.Status == 0 {
+			rule.Status = fiber.StatusServiceUnavailable
+		}
+		if rule.Status < 400 || rule.Status > 599 {
+			return fiber.NewError(fiber.StatusBadRequest, "status must be an error status from 400 to 599")
+		}
+	}
+
+	faults.Lock()
+	faults.rules = req.Rules
+	faults.Unlock()
+
+	return c.JSON(FaultsResponse{Rules: req.Rules, Count: len(req.Rules)})
+}
+
+// deleteFaults handles DELETE /admin/faults, lifting every fault rule
+func deleteFaults(c *fiber.Ctx) error {
+	faults.Lock()
+	faults.rules = nil
+	faults.Unlock()
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// QueryFeedbackRequest represents the request body for POST /strings/query-feedback
+type QueryFeedbackRequest struct {
+	Query           string                 `json:"query"`
+	ExpectedFilters map[string]interface{} `json:"expected_filters"`
+	Comment         string                 `json:"comment"`
+}
+
+// QueryFeedback is a client's report that a natural language query was
+// parsed wrongly, kept for operators extending the parser's patterns
+type QueryFeedback struct {
+	ID              int64                  `json:"id"`
+	Query           string                 `json:"query"`
+	ParsedFilters   map[string]interface{} `json:"parsed_filters"`
+	ParseError      string                 `json:"parse_error,omitempty"`
+	ExpectedFilters map[string]interface{} `json:"expected_filters"`
+	Comment         string                 `json:"comment,omitempty"`
+	Actor           string                 `json:"actor,omitempty"`
+	CreatedAt       time.Time              `json:"created_at"`
+}
+
+// QueryFeedbackSummary groups the reports for one query
+type QueryFeedbackSummary struct {
+	Query    string    `json:"query"`
+	Reports  int       `json:"reports"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// QueryFeedbackResponse represents the response for GET /admin/query-feedback
+type QueryFeedbackResponse struct {
+	Feedback []QueryFeedback        `json:"feedback"`
+	Count    int                    `json:"count"`
+	Queries  []QueryFeedbackSummary `json:"queries"`
+}
+
+// queryFeedback holds the reports received, appending each one to
+// QUERY_FEEDBACK_PATH when set so they survive restarts
+var queryFeedback struct {
+	sync.Mutex
+	entries []QueryFeedback
+	next    int64
+	file    *os.File
+}
+
+// submitQueryFeedback handles POST /strings/query-feedback. The query is
+// parsed again so the report records what the parser produced.
+func submitQueryFeedback(c *fiber.Ctx) error {
+	var req QueryFeedbackRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	if strings.TrimSpace(req.Query) == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Missing 'query' field")
+	}
+	if len(req.ExpectedFilters) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Missing 'expected_filters' field")
+	}
+
+	expected, err := normalizeFilters(req.ExpectedFilters)
+	if err != nil {
+		return err
+	}
+
+	feedback := QueryFeedback{
+		Query:           req.Query,
+		ExpectedFilters: expected,
+		Comment:         req.Comment,
+		Actor:           requestActor(c),
+		CreatedAt:       time.Now().UTC(),
+	}
+	feedback.ParsedFilters, err = parseNaturalLanguageQuery(req.Query)
+	if err != nil {
+		feedback.ParseError = err.Error()
+	}
+
+	if err := recordQueryFeedback(&feedback); err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(feedback)
+}
+
+// getQueryFeedback handles GET /admin/query-feedback, listing reports newest
+// first with the most reported queries summarized
+func getQueryFeedback(c *fiber.Ctx) error {
+	queryFeedback.Lock()
+	entries := append([]QueryFeedback(nil), queryFeedback.entries...)
+	queryFeedback.Unlock()
+
+	response := QueryFeedbackResponse{
+		Feedback: make([]QueryFeedback, 0, len(entries)),
+		Count:    len(entries),
+		Queries:  []QueryFeedbackSummary{},
+	}
+
+	summaries := make(map[string]*QueryFeedbackSummary)
+	for i := len(entries) - 1; i >= 0; i-- {
+		feedback := entries[i]
+		response.Feedback = append(response.Feedback, feedback)
+
+		key := strings.ToLower(strings.TrimSpace(feedback.Query))
+		summary, ok := summaries[key]
+		if !ok {
+			summary = &QueryFeedbackSummary{Query: feedback.Query, LastSeen: feedback.CreatedAt}
+			summaries[key] = summary
+		}
+		summary.Reports++
+	}
+
+	for _, summary := range summaries {
+		response.Queries = append(response.Queries, *summary)
+	}
+	sort.Slice(response.Queries, func(i, j int) bool {
+		if response.Queries[i].Reports != response.Queries[j].Reports {
+			return response.Queries[i].Reports > response.Queries[j].Reports
+		}
+		return response.Queries[i].LastSeen.After(response.Queries[j].LastSeen)
+	})
+
+	return c.JSON(response)
+}
+
+// normalizeFilters checks filters sent as JSON against the filter specs,
+// converting each value as if it had been given in a query string
+func normalizeFilters(filters map[string]interface{}) (map[string]interface{}, error) {
+	normalized := make(map[string]interface{}, len(filters))
+	for name, val := range filters {
+		spec, ok := findFilterSpec(name)
+		if !ok {
+			return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Unknown filter %q", name))
+		}
+
+		parsed, err := spec.parse(fmt.Sprint(val))
+		if err != nil {
+			return nil, err
+		}
+		normalized[name] = parsed
+	}
+	return normalized, nil
+}
+
+// recordQueryFeedback assigns the report an ID and keeps it
+func recordQueryFeedback(feedback *QueryFeedback) error {
+	queryFeedback.Lock()
+	defer queryFeedback.Unlock()
+
+	feedback.ID = queryFeedback.next + 1
+	if queryFeedback.file != nil {
+		line, err := json.Marshal(feedback)
+		if err != nil {
+			return err
+		}
+		if _, err := queryFeedback.file.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+
+	queryFeedback.next = feedback.ID
+	queryFeedback.entries = append(queryFeedback.entries, *feedback)
+	return nil
+}
+
+// openQueryFeedback loads the reports saved at path and appends new ones to
+// it, returning how many were loaded
+func openQueryFeedback(path string) (int, error) {
+	queryFeedback.Lock()
+	defer queryFeedback.Unlock()
+
+	file, err := os.Open(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 0, err
+	}
+	if err == nil {
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			var feedback QueryFeedback
+			if err := json.Unmarshal(scanner.Bytes(), &feedback); err != nil {
+				file.Close()
+				return 0, err
+			}
+			queryFeedback.entries = append(queryFeedback.entries, feedback)
+			if feedback.ID > queryFeedback.next {
+				queryFeedback.next = feedback.ID
+			}
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return 0, err
+		}
+	}
+
+	queryFeedback.file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	return len(queryFeedback.entries), nil
+}
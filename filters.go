@@ -0,0 +1,614 @@
+package main
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// filterSpec describes a filter shared by the list and natural language endpoints
+type filterSpec struct {
+	Name        string
+	Type        string
+	Operator    string
+	Description string
+	parse       func(raw string) (interface{}, error)
+	match       func(data *StringData, val interface{}) bool
+	estimate    func(stats *cardinalityStats, val interface{}) int
+	// index names the index a listing can read the filter's matches from
+	// instead of scanning every record, and postings reads them from a
+	// shard's posting lists (the value index is read through the plan's
+	// range instead)
+	index    string
+	postings func(s *storeShard, val interface{}) []map[string]bool
+}
+
+// PlanStep is one filter in the order chosen by the planner
+type PlanStep struct {
+	Filter           string      `json:"filter"`
+	Value            interface{} `json:"value"`
+	EstimatedMatches int         `json:"estimated_matches"`
+}
+
+// filterSpecs lists the supported filters in query parameter order
+var filterSpecs = []filterSpec{
+	{
+		Name:        "is_palindrome",
+		Type:        "boolean",
+		Operator:    "eq",
+		Description: "Whether the string reads the same backwards under the palindrome mode it was analyzed with",
+		parse: func(raw string) (interface{}, error) {
+			val, err := strconv.ParseBool(raw)
+			if err != nil {
+				return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid value for is_palindrome")
+			}
+			return val, nil
+		},
+		match: func(data *StringData, val interface{}) bool {
+			return data.Properties.IsPalindrome == val.(bool)
+		},
+		estimate: func(stats *cardinalityStats, val interface{}) int {
+			if val.(bool) {
+				return stats.palindromes
+			}
+			return stats.total - stats.palindromes
+		},
+		index: indexPalindrome,
+		postings: func(s *storeShard, val interface{}) []map[string]bool {
+			return []map[string]bool{s.filters.palindromes[val.(bool)]}
+		},
+	},
+	lengthFilter("min_length", lengthUnitRune),
+	lengthFilter("max_length", lengthUnitRune),
+	{
+		Name:        "length_unit",
+		Type:        "string",
+		Operator:    "eq",
+		Description: "Unit min_length and max_length count in: rune (the default), byte or grapheme",
+		parse:       parseLengthUnit,
+		match:       func(*StringData, interface{}) bool { return true },
+		estimate:    func(stats *cardinalityStats, _ interface{}) int { return stats.total },
+	},
+	{
+		Name:        "word_count",
+		Type:        "integer",
+		Operator:    "eq",
+		Description: "Exact number of words",
+		parse:       parseNonNegative("word_count"),
+		match: func(data *StringData, val interface{}) bool {
+			return data.Properties.WordCount == val.(int)
+		},
+		estimate: func(stats *cardinalityStats, val interface{}) int {
+			return stats.wordCounts[val.(int)]
+		},
+		index: indexWordCount,
+		postings: func(s *storeShard, val interface{}) []map[string]bool {
+			return []map[string]bool{s.filters.wordCounts[val.(int)]}
+		},
+	},
+	{
+		Name:        "contains_character",
+		Type:        "string",
+		Operator:    "contains",
+		Description: "Single character the string must contain (case-insensitive)",
+		parse: func(raw string) (interface{}, error) {
+			if len(raw) != 1 {
+				return nil, fiber.NewError(fiber.StatusBadRequest, "contains_character must be a single character")
+			}
+			return raw, nil
+		},
+		match: func(data *StringData, val interface{}) bool {
+			return strings.Contains(strings.ToLower(searchableCharacters(data)), strings.ToLower(val.(string)))
+		},
+		estimate: func(stats *cardinalityStats, val interface{}) int {
+			return stats.characters[strings.ToLower(val.(string))]
+		},
+		index: indexCharacter,
+		postings: func(s *storeShard, val interface{}) []map[string]bool {
+			return []map[string]bool{s.filters.characters[strings.ToLower(val.(string))]}
+		},
+	},
+	{
+		Name:        "contains_word",
+		Type:        "string",
+		Operator:    "contains",
+		Description: "Word the string must contain, compared by stem in the string's language",
+		parse:       parseText,
+		match: func(data *StringData, val interface{}) bool {
+			return containsStem(data, val.(string))
+		},
+		estimate: func(stats *cardinalityStats, val interface{}) int {
+			return stats.total
+		},
+	},
+	boolFilter("has_date", "Whether a date was extracted from the string", func(data *StringData) bool { return len(data.Properties.Entities.Dates) > 0 }),
+	boolFilter("has_time", "Whether a clock time was extracted from the string", func(data *StringData) bool { return len(data.Properties.Entities.Times) > 0 }),
+	boolFilter("has_number", "Whether a standalone number was extracted from the string", func(data *StringData) bool { return len(data.Properties.Entities.Numbers) > 0 }),
+	boolFilter("has_currency", "Whether a currency amount was extracted from the string", func(data *StringData) bool { return len(data.Properties.Entities.Currencies) > 0 }),
+	timeFilter("modified_since", "gt", "RFC 3339 time the string must have been created or updated after", func(data *StringData, val time.Time) bool {
+		return data.modifiedAt().After(val)
+	}),
+	timeFilter("created_after", "gt", "RFC 3339 time the string must have been created after", func(data *StringData, val time.Time) bool {
+		return data.CreatedAt.After(val)
+	}),
+	timeFilter("created_before", "lt", "RFC 3339 time the string must have been created before", func(data *StringData, val time.Time) bool {
+		return data.CreatedAt.Before(val)
+	}),
+	timeFilter("updated_after", "gt", "RFC 3339 time the string must have been last updated after (its creation counts as an update)", func(data *StringData, val time.Time) bool {
+		return data.modifiedAt().After(val)
+	}),
+	{
+		Name:        "tag",
+		Type:        "string",
+		Operator:    "contains",
+		Description: "Tag the string must carry (case-insensitive)",
+		parse:       parseText,
+		match: func(data *StringData, val interface{}) bool {
+			return data.hasTag(strings.ToLower(val.(string)))
+		},
+		estimate: func(stats *cardinalityStats, val interface{}) int {
+			return stats.tags[strings.ToLower(val.(string))]
+		},
+	},
+	textFilter("host", "Host of a URL or domain of an email, subdomains included", func(data *StringData, val string) bool {
+		host := addressHost(data)
+		return host == val || strings.HasSuffix(host, "."+val)
+	}),
+	textFilter("tld", "Public suffix of a URL or email, e.g. com or co.uk", func(data *StringData, val string) bool {
+		return addressTLD(data) == strings.TrimPrefix(val, ".")
+	}),
+	textFilter("language", "Detected language code, e.g. fr; strings with no detected language never match", func(data *StringData, val string) bool {
+		return data.Properties.DetectedLanguage == val
+	}),
+	numberFilter("min_language_confidence", "gte", "Minimum probability of the detected language, from 0 to 1", func(p *StringProperties) float64 { return p.LanguageConfidence }),
+	textFilter("sentiment", "Sentiment label: positive, negative or neutral; strings analyzed without the sentiment analyzer never match", func(data *StringData, val string) bool {
+		return data.Properties.Sentiment != nil && data.Properties.Sentiment.Label == val
+	}),
+	numberFilter("min_sentiment_confidence", "gte", "Minimum confidence of the sentiment label, from 0 to 1", func(p *StringProperties) float64 {
+		if p.Sentiment == nil {
+			return -1
+		}
+		return p.Sentiment.Confidence
+	}),
+	countFilter("min_vowel_count", "gte", "Minimum number of ASCII vowels", func(p *StringProperties) int { return p.VowelCount }),
+	countFilter("max_vowel_count", "lte", "Maximum number of ASCII vowels", func(p *StringProperties) int { return p.VowelCount }),
+	countFilter("min_consonant_count", "gte", "Minimum number of ASCII consonants", func(p *StringProperties) int { return p.ConsonantCount }),
+	countFilter("max_consonant_count", "lte", "Maximum number of ASCII consonants", func(p *StringProperties) int { return p.ConsonantCount }),
+	countFilter("min_uppercase_count", "gte", "Minimum number of uppercase letters", func(p *StringProperties) int { return p.UppercaseCount }),
+	countFilter("max_uppercase_count", "lte", "Maximum number of uppercase letters", func(p *StringProperties) int { return p.UppercaseCount }),
+	countFilter("min_lowercase_count", "gte", "Minimum number of lowercase letters", func(p *StringProperties) int { return p.LowercaseCount }),
+	countFilter("max_lowercase_count", "lte", "Maximum number of lowercase letters", func(p *StringProperties) int { return p.LowercaseCount }),
+	countFilter("min_digit_count", "gte", "Minimum number of digits", func(p *StringProperties) int { return p.DigitCount }),
+	countFilter("max_digit_count", "lte", "Maximum number of digits", func(p *StringProperties) int { return p.DigitCount }),
+	textFilter("script", "Unicode script some of the string's letters are written in, e.g. cyrillic", func(data *StringData, val string) bool {
+		for _, script := range data.Properties.Scripts {
+			if strings.EqualFold(script, val) {
+				return true
+			}
+		}
+		return false
+	}),
+	boolFilter("mixed_script", "Whether the string mixes scripts not normally written together, as in homoglyph spoofing", func(data *StringData) bool { return data.Properties.MixedScript }),
+	boolFilter("is_rtl", "Whether the string's first letter is in a right-to-left script such as Arabic or Hebrew", func(data *StringData) bool { return data.Properties.IsRTL }),
+	countFilter("min_longest_word_length", "gte", "Minimum length in runes of the longest word", func(p *StringProperties) int { return p.LongestWordLength }),
+	countFilter("max_longest_word_length", "lte", "Maximum length in runes of the longest word", func(p *StringProperties) int { return p.LongestWordLength }),
+	countFilter("min_shortest_word_length", "gte", "Minimum length in runes of the shortest word", func(p *StringProperties) int { return p.ShortestWordLength }),
+	countFilter("max_shortest_word_length", "lte", "Maximum length in runes of the shortest word", func(p *StringProperties) int { return p.ShortestWordLength }),
+	numberFilter("min_average_word_length", "gte", "Minimum average word length in runes", func(p *StringProperties) float64 { return p.AverageWordLength }),
+	numberFilter("max_average_word_length", "lte", "Maximum average word length in runes", func(p *StringProperties) float64 { return p.AverageWordLength }),
+	countFilter("min_sentence_count", "gte", "Minimum number of sentences", func(p *StringProperties) int { return p.SentenceCount }),
+	countFilter("max_sentence_count", "lte", "Maximum number of sentences", func(p *StringProperties) int { return p.SentenceCount }),
+	countFilter("min_line_count", "gte", "Minimum number of lines", func(p *StringProperties) int { return p.LineCount }),
+	countFilter("max_line_count", "lte", "Maximum number of lines", func(p *StringProperties) int { return p.LineCount }),
+	numberFilter("min_reading_ease", "gte", "Minimum Flesch reading ease; strings too short to score never match", func(p *StringProperties) float64 {
+		if p.ReadingEase == nil {
+			return math.Inf(-1)
+		}
+		return *p.ReadingEase
+	}),
+	numberFilter("max_grade_level", "lte", "Maximum Flesch-Kincaid grade level; strings too short to score never match", func(p *StringProperties) float64 {
+		if p.GradeLevel == nil {
+			return math.Inf(1)
+		}
+		return *p.GradeLevel
+	}),
+	valueRangeFilter("value_gte", "gte", "Value the string must sort at or after, in byte order",
+		func(val string) valueRange { return valueRange{from: val} },
+		func(value, val string) bool { return value >= val }),
+	valueRangeFilter("value_lt", "lt", "Value the string must sort before, in byte order",
+		func(val string) valueRange { return valueRange{to: val, bounded: true} },
+		func(value, val string) bool { return value < val }),
+}
+
+// countFilter builds a lower ("gte") or upper ("lte") bound on a count
+// property. Counts are not indexed, so every record is a candidate.
+func countFilter(name, operator, description string, get func(p *StringProperties) int) filterSpec {
+	return filterSpec{
+		Name:        name,
+		Type:        "integer",
+		Operator:    operator,
+		Description: description,
+		parse:       parseNonNegative(name),
+		match: func(data *StringData, val interface{}) bool {
+			if operator == "gte" {
+				return get(&data.Properties) >= val.(int)
+			}
+			return get(&data.Properties) <= val.(int)
+		},
+		estimate: func(stats *cardinalityStats, val interface{}) int {
+			return stats.total
+		},
+	}
+}
+
+// numberFilter is countFilter for a fractional property
+func numberFilter(name, operator, description string, get func(p *StringProperties) float64) filterSpec {
+	return filterSpec{
+		Name:        name,
+		Type:        "number",
+		Operator:    operator,
+		Description: description,
+		parse: func(raw string) (interface{}, error) {
+			val, err := strconv.ParseFloat(raw, 64)
+			if err != nil || val < 0 || math.IsNaN(val) || math.IsInf(val, 0) {
+				return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid value for "+name)
+			}
+			return val, nil
+		},
+		match: func(data *StringData, val interface{}) bool {
+			if operator == "gte" {
+				return get(&data.Properties) >= val.(float64)
+			}
+			return get(&data.Properties) <= val.(float64)
+		},
+		estimate: func(stats *cardinalityStats, val interface{}) int {
+			return stats.total
+		},
+	}
+}
+
+// textFilter builds a case-insensitive string filter over a derived property
+func textFilter(name, description string, match func(data *StringData, val string) bool) filterSpec {
+	return filterSpec{
+		Name:        name,
+		Type:        "string",
+		Operator:    "eq",
+		Description: description,
+		parse: func(raw string) (interface{}, error) {
+			return strings.ToLower(raw), nil
+		},
+		match: func(data *StringData, val interface{}) bool {
+			return match(data, val.(string))
+		},
+		estimate: func(stats *cardinalityStats, val interface{}) int {
+			return stats.total
+		},
+	}
+}
+
+// timeFilter builds an RFC 3339 timestamp filter. Timestamps are not
+// indexed, so every record is a candidate.
+func timeFilter(name, operator, description string, match func(data *StringData, val time.Time) bool) filterSpec {
+	return filterSpec{
+		Name:        name,
+		Type:        "timestamp",
+		Operator:    operator,
+		Description: description,
+		parse: func(raw string) (interface{}, error) {
+			val, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return nil, fiber.NewError(fiber.StatusBadRequest, name+" must be an RFC 3339 timestamp")
+			}
+			return val.UTC(), nil
+		},
+		match: func(data *StringData, val interface{}) bool {
+			return match(data, val.(time.Time))
+		},
+		estimate: func(stats *cardinalityStats, val interface{}) int {
+			return stats.total
+		},
+	}
+}
+
+// boolFilter builds a true/false filter over a derived property. Without
+// per-property statistics every record is assumed to be a candidate.
+func boolFilter(name, description string, get func(data *StringData) bool) filterSpec {
+	return filterSpec{
+		Name:        name,
+		Type:        "boolean",
+		Operator:    "eq",
+		Description: description,
+		parse: func(raw string) (interface{}, error) {
+			val, err := strconv.ParseBool(raw)
+			if err != nil {
+				return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid value for "+name)
+			}
+			return val, nil
+		},
+		match: func(data *StringData, val interface{}) bool {
+			return get(data) == val.(bool)
+		},
+		estimate: func(stats *cardinalityStats, val interface{}) int {
+			return stats.total
+		},
+	}
+}
+
+// parseText accepts free-text query parameters as-is
+func parseText(raw string) (interface{}, error) {
+	return raw, nil
+}
+
+// parseNonNegative returns a parser for non-negative integer query parameters
+func parseNonNegative(name string) func(raw string) (interface{}, error) {
+	return func(raw string) (interface{}, error) {
+		val, err := strconv.Atoi(raw)
+		if err != nil || val < 0 {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid value for "+name)
+		}
+		return val, nil
+	}
+}
+
+// allFilterSpecs returns the built-in filters followed by those generated
+// for admin-defined derived properties
+func allFilterSpecs() []filterSpec {
+	return append(filterSpecs[:len(filterSpecs):len(filterSpecs)], derivedFilterSpecs()...)
+}
+
+// findFilterSpec looks up a filter by name
+func findFilterSpec(name string) (filterSpec, bool) {
+	for _, spec := range allFilterSpecs() {
+		if spec.Name == name {
+			return spec, true
+		}
+	}
+	return filterSpec{}, false
+}
+
+// parseQueryFilters reads all supported filters from the request query string
+func parseQueryFilters(c *fiber.Ctx) (map[string]interface{}, error) {
+	filters := make(map[string]interface{})
+
+	for _, spec := range allFilterSpecs() {
+		raw := c.Query(spec.Name)
+		if raw == "" {
+			continue
+		}
+
+		val, err := spec.parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		filters[spec.Name] = val
+	}
+
+	return filters, nil
+}
+
+// queryPlan is an ordered list of filters, most selective first
+type queryPlan struct {
+	steps []PlanStep
+	specs []filterSpec
+	// includeDeleted makes collect return soft-deleted strings too
+	includeDeleted bool
+	// values is the range of the value_gte and value_lt filters
+	values *valueRange
+	// access names the index candidates are read from, that of the filter
+	// at step accessStep, or is empty for a full scan
+	access     string
+	accessStep int
+}
+
+// planFilters orders filters by their estimated number of matches so the
+// most selective one is evaluated first
+func planFilters(filters map[string]interface{}) queryPlan {
+	var plan queryPlan
+	if len(filters) == 0 {
+		return plan
+	}
+
+	stats := mergedStats()
+	unit, _ := filters["length_unit"].(string)
+	for name, val := range filters {
+		spec, ok := findFilterSpec(name)
+		if !ok || name == "length_unit" {
+			continue
+		}
+		if _, isLength := lengthBounds[name]; isLength && unit != "" {
+			spec = lengthFilter(name, unit)
+		}
+		switch name {
+		case "value_gte":
+			plan.rangeOfValues().from = val.(string)
+		case "value_lt":
+			plan.rangeOfValues().to, plan.values.bounded = val.(string), true
+		}
+		plan.specs = append(plan.specs, spec)
+		plan.steps = append(plan.steps, PlanStep{
+			Filter:           name,
+			Value:            val,
+			EstimatedMatches: spec.estimate(stats, val),
+		})
+	}
+
+	sort.Sort(plan)
+	plan.chooseAccess()
+
+	return plan
+}
+
+// chooseAccess reads candidates from the index of the most selective filter
+// that has one, if any
+func (p *queryPlan) chooseAccess() {
+	for i, spec := range p.specs {
+		if spec.index != "" {
+			p.access, p.accessStep = spec.index, i
+			return
+		}
+	}
+}
+
+// rangeOfValues returns the plan's value range, starting an unbounded one
+func (p *queryPlan) rangeOfValues() *valueRange {
+	if p.values == nil {
+		p.values = &valueRange{}
+	}
+	return p.values
+}
+
+func (p queryPlan) Len() int { return len(p.steps) }
+
+func (p queryPlan) Less(i, j int) bool {
+	if p.steps[i].EstimatedMatches != p.steps[j].EstimatedMatches {
+		return p.steps[i].EstimatedMatches < p.steps[j].EstimatedMatches
+	}
+	return p.steps[i].Filter < p.steps[j].Filter
+}
+
+func (p queryPlan) Swap(i, j int) {
+	p.steps[i], p.steps[j] = p.steps[j], p.steps[i]
+	p.specs[i], p.specs[j] = p.specs[j], p.specs[i]
+}
+
+// matches checks if a string passes every filter in the plan
+func (p queryPlan) matches(data *StringData) bool {
+	for i, spec := range p.specs {
+		if !spec.match(data, p.steps[i].Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// collect returns the stored strings matching the plan and how many there
+// are, stopping early when ctx is done. With a sample size above zero only
+// a uniform random sample of that many is kept, by reservoir sampling.
+// Records are replaced rather than mutated, so the pointers stay valid
+// after the locks are released. Shards are scanned one at a time so writers
+// to the others proceed. A non-nil trace records the work done.
+func (p queryPlan) collect(ctx context.Context, sample int, trace *QueryTrace) ([]*StringData, int, error) {
+	var filtered []*StringData
+
+	now := time.Now()
+	scanned, matched := 0, 0
+	for _, shard := range shards {
+		if trace != nil {
+			waitStart := time.Now()
+			shard.RLock()
+			trace.lockWait += time.Since(waitStart)
+			trace.ShardsScanned++
+		} else {
+			shard.RLock()
+		}
+		completed := p.candidatesLocked(shard, func(data *StringData) bool {
+			if scanned++; scanned%scanCheckInterval == 0 && ctx.Err() != nil {
+				return false
+			}
+			if trace != nil {
+				trace.CandidatesScanned++
+				if data.expired(now) {
+					trace.ExpiredSkipped++
+					return true
+				}
+				if !p.matchesTraced(data, trace) {
+					return true
+				}
+			} else if data.expired(now) || !p.matches(data) {
+				return true
+			}
+			matched++
+			if sample > 0 && len(filtered) == sample {
+				if i := rand.IntN(matched); i < sample {
+					filtered[i] = data
+				}
+				return true
+			}
+			filtered = append(filtered, data)
+			return true
+		})
+		shard.RUnlock()
+		if !completed {
+			return nil, 0, ctx.Err()
+		}
+	}
+
+	return filtered, matched, ctx.Err()
+}
+
+// candidatesLocked calls visit with every record of a shard the plan has to
+// check: those found through the index it chose when it has one, every
+// stored one otherwise, and soft-deleted ones when included. It stops
+// early, returning false, when visit does. Caller must hold the shard lock.
+func (p queryPlan) candidatesLocked(shard *storeShard, visit func(data *StringData) bool) bool {
+	switch p.access {
+	case "":
+		for _, data := range shard.records {
+			if !visit(data) {
+				return false
+			}
+		}
+	case indexValue:
+		for _, value := range p.values.slice(shard.values) {
+			if !visit(shard.records[value]) {
+				return false
+			}
+		}
+	default:
+		for _, values := range p.specs[p.accessStep].postings(shard, p.steps[p.accessStep].Value) {
+			for value := range values {
+				if !visit(shard.records[value]) {
+					return false
+				}
+			}
+		}
+	}
+
+	if p.includeDeleted {
+		for _, data := range shard.deleted {
+			if !visit(data) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// count counts the records matching the plan, without copying them or
+// capping the result
+func (p queryPlan) count(ctx context.Context) (int, error) {
+	matched := 0
+	err := p.each(ctx, func(*StringData) { matched++ })
+	return matched, err
+}
+
+// each calls visit for every unexpired record matching the plan, one shard
+// at a time with its lock held, so visit must not keep the record
+func (p queryPlan) each(ctx context.Context, visit func(data *StringData)) error {
+	now := time.Now()
+	scanned := 0
+	for _, shard := range shards {
+		shard.RLock()
+		completed := p.candidatesLocked(shard, func(data *StringData) bool {
+			if scanned++; scanned%scanCheckInterval == 0 && ctx.Err() != nil {
+				return false
+			}
+			if !data.expired(now) && p.matches(data) {
+				visit(data)
+			}
+			return true
+		})
+		shard.RUnlock()
+		if !completed {
+			return ctx.Err()
+		}
+	}
+
+	return ctx.Err()
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxFsckDiscrepancies caps the discrepancies an fsck report lists; the
+// count covers every one
+const maxFsckDiscrepancies = 1000
+
+// Kinds of fsck discrepancy
+const (
+	fsckRecord  = "record"
+	fsckIndex   = "index"
+	fsckDurable = "durable"
+)
+
+// FsckDiscrepancy is one disagreement found by an fsck. Record
+// discrepancies are a stored string whose ID or hash does not match its
+// value, index ones an in-memory index that does not match the records of
+// its shard, and durable ones a string that differs between memory and
+// what the snapshot and WAL would restore.
+type FsckDiscrepancy struct {
+	Kind     string `json:"kind"`
+	Check    string `json:"check"`
+	Shard    int    `json:"shard"`
+	ID       string `json:"id,omitempty"`
+	Detail   string `json:"detail"`
+	Repaired bool   `json:"repaired,omitempty"`
+}
+
+// FsckReport represents the response for POST /admin/fsck
+type FsckReport struct {
+	Records          int               `json:"records"`
+	Repair           bool              `json:"repair"`
+	DurableSources   []string          `json:"durable_sources"`
+	DiscrepancyCount int               `json:"discrepancy_count"`
+	Repaired         int               `json:"repaired"`
+	Discrepancies    []FsckDiscrepancy `json:"discrepancies"`
+	Truncated        bool              `json:"truncated,omitempty"`
+	DurationMs       int64             `json:"duration_ms"`
+}
+
+// report adds a discrepancy, listing it unless the report is full
+func (r *FsckReport) report(d FsckDiscrepancy) {
+	r.DiscrepancyCount++
+	if d.Repaired {
+		r.Repaired++
+	}
+	if len(r.Discrepancies) < maxFsckDiscrepancies {
+		r.Discrepancies = append(r.Discrepancies, d)
+	} else {
+		r.Truncated = true
+	}
+}
+
+// runFsck handles POST /admin/fsck. Every stored string is hashed again
+// and checked against its ID, every shard's indexes are checked against
+// its records, and with WAL_PATH set the store is compared with what the
+// snapshot and WAL would restore. With ?repair=true indexes that disagree
+// are rebuilt from the records; other discrepancies are only reported.
+// Writes wait while it runs.
+func runFsck(c *fiber.Ctx) error {
+	started := time.Now()
+	report := FsckReport{
+		Repair:         c.QueryBool("repair"),
+		DurableSources: []string{},
+		Discrepancies:  []FsckDiscrepancy{},
+	}
+
+	// Snapshots take snapshotMu before reading the shards, so take it first
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+	lockAllShards()
+	defer unlockAllShards()
+
+	count, size := 0, 0
+	for i, shard := range shards {
+		for key, data := range shard.records {
+			checkRecord(&report, i, key, data)
+			count++
+			size += len(data.Value)
+		}
+		for key, data := range shard.deleted {
+			checkRecord(&report, i, key, data)
+		}
+		checkIndexes(&report, i, shard)
+	}
+	report.Records = count
+
+	if got := storeCount.Load(); got != int64(count) {
+		if report.Repair {
+			storeCount.Store(int64(count))
+		}
+		report.report(FsckDiscrepancy{Kind: fsckIndex, Check: "store_count", Shard: -1, Detail: fmt.Sprintf("%d strings counted, %d stored", got, count), Repaired: report.Repair})
+	}
+	if got := storeBytes.Load(); got != int64(size) {
+		if report.Repair {
+			storeBytes.Store(int64(size))
+		}
+		report.report(FsckDiscrepancy{Kind: fsckIndex, Check: "store_bytes", Shard: -1, Detail: fmt.Sprintf("%d bytes counted, %d stored", got, size), Repaired: report.Repair})
+	}
+
+	if config.WALPath != "" {
+		if err := checkDurable(&report); err != nil {
+			return err
+		}
+	}
+
+	if report.Repaired > 0 {
+		storeGeneration.Add(1)
+	}
+	report.DurationMs = time.Since(started).Milliseconds()
+	log.Printf("fsck found %d discrepancies, repaired %d", report.DiscrepancyCount, report.Repaired)
+
+	return c.JSON(report)
+}
+
+// checkRecord checks that a record is filed under its value in the right
+// shard and that its ID, unless client-supplied, and SHA-256 match the
+// value. The SHA-256 of an encrypted value is that of its plaintext, so it
+// cannot be checked.
+func checkRecord(report *FsckReport, shard int, key string, data *StringData) {
+	fail := func(check, detail string) {
+		report.report(FsckDiscrepancy{Kind: fsckRecord, Check: check, Shard: shard, ID: data.ID, Detail: detail})
+	}
+
+	if data.Value != key {
+		fail("key", "record is stored under another value")
+	}
+	if int(shardIndex(data.Value)) != shard {
+		fail("shard", fmt.Sprintf("value belongs in shard %d", shardIndex(data.Value)))
+	}
+
+	hash, ok := hashAlgorithms[recordHashAlgorithm(data)]
+	if !ok {
+		fail("id", "unknown hash algorithm "+data.HashAlgorithm)
+		return
+	}
+	if data.Encoding == encodingEncrypted {
+		if !data.ClientSuppliedID && hash(data.Value) != data.ID {
+			fail("id", "ID does not match the ciphertext")
+		}
+		return
+	}
+
+	raw := rawValue(data)
+	if !data.ClientSuppliedID && hash(raw) != data.ID {
+		fail("id", "ID does not match the value")
+	}
+	if data.Properties.SHA256Hash != "" && computeSHA256(raw) != data.Properties.SHA256Hash {
+		fail("sha256", "sha256_hash does not match the value")
+	}
+}
+
+// checkIndexes rebuilds a shard's indexes from its records and compares
+// them with the ones in use, swapping in the rebuilt ones when repairing.
+// Caller must hold the shard lock.
+func checkIndexes(report *FsckReport, i int, s *storeShard) {
+	rebuilt := &storeShard{
+		stats:      newCardinalityStats(),
+		equivalent: make(valueIndex),
+		anagrams:   make(valueIndex),
+		filters:    newFilterIndexes(),
+		ids:        make(map[string]string),
+		aliases:    make(map[string]string),
+		deletedIDs: make(map[string]string),
+	}
+	for _, data := range s.records {
+		rebuilt.stats.add(data)
+		rebuilt.indexDuplicatesLocked(data)
+		rebuilt.indexHashLocked(data)
+		rebuilt.indexValueLocked(data.Value)
+		rebuilt.indexFiltersLocked(data)
+		rebuilt.ids[data.ID] = data.Value
+		rebuilt.indexAliasesLocked(data)
+	}
+	for _, data := range s.deleted {
+		rebuilt.deletedIDs[data.ID] = data.Value
+	}
+
+	checks := []struct {
+		name    string
+		same    bool
+		entries int
+		repair  func()
+	}{
+		{"ids", reflect.DeepEqual(s.ids, rebuilt.ids), len(rebuilt.ids), func() { s.ids = rebuilt.ids }},
+		{"aliases", reflect.DeepEqual(s.aliases, rebuilt.aliases), len(rebuilt.aliases), func() { s.aliases = rebuilt.aliases }},
+		{"deleted_ids", reflect.DeepEqual(s.deletedIDs, rebuilt.deletedIDs), len(rebuilt.deletedIDs), func() { s.deletedIDs = rebuilt.deletedIDs }},
+		{"stats", reflect.DeepEqual(s.stats, rebuilt.stats), rebuilt.stats.total, func() { s.stats = rebuilt.stats }},
+		{"equivalent_index", reflect.DeepEqual(s.equivalent, rebuilt.equivalent), len(rebuilt.equivalent), func() { s.equivalent = rebuilt.equivalent }},
+		{"anagram_index", reflect.DeepEqual(s.anagrams, rebuilt.anagrams), len(rebuilt.anagrams), func() { s.anagrams = rebuilt.anagrams }},
+		{"hash_index", slices.Equal(s.hashes, rebuilt.hashes), len(rebuilt.hashes), func() { s.hashes = rebuilt.hashes }},
+		{indexValue, slices.Equal(s.values, rebuilt.values), len(rebuilt.values), func() { s.values = rebuilt.values }},
+		{"filter_indexes", reflect.DeepEqual(s.filters, rebuilt.filters), len(s.records), func() { s.filters = rebuilt.filters }},
+	}
+	for _, check := range checks {
+		if check.same {
+			continue
+		}
+		if report.Repair {
+			check.repair()
+		}
+		report.report(FsckDiscrepancy{
+			Kind:     fsckIndex,
+			Check:    check.name,
+			Shard:    i,
+			Detail:   fmt.Sprintf("index does not match the shard's records (%d entries expected)", check.entries),
+			Repaired: report.Repair,
+		})
+	}
+
+	for value, data := range s.records {
+		if _, tracked := s.usage[value]; !tracked {
+			if report.Repair {
+				s.trackLocked(data)
+			}
+			report.report(FsckDiscrepancy{Kind: fsckIndex, Check: "usage", Shard: i, ID: data.ID, Detail: "string is not tracked for eviction", Repaired: report.Repair})
+		}
+	}
+	for value := range s.usage {
+		if _, stored := s.records[value]; !stored {
+			if report.Repair {
+				s.untrackLocked(value)
+			}
+			report.report(FsckDiscrepancy{Kind: fsckIndex, Check: "usage", Shard: i, Detail: "eviction tracks a string that is not stored", Repaired: report.Repair})
+		}
+	}
+}
+
+// checkDurable compares the store with what a restart would restore from
+// the snapshot and WAL. With a storage backend memory only caches part of
+// the store, so strings found on one side only are expected and just the
+// ones on both are compared. Expired strings are skipped. Caller must hold
+// every shard lock.
+func checkDurable(report *FsckReport) error {
+	durable := make(map[string]*StringData)
+	var after uint64
+
+	if config.SnapshotPath != "" {
+		snapshot, err := readSnapshot(config.SnapshotPath)
+		if err != nil {
+			return fmt.Errorf("reading snapshot: %w", err)
+		}
+		if snapshot != nil {
+			for _, data := range snapshot.Strings {
+				durable[data.Value] = data
+			}
+			after = snapshot.WALSequence
+			report.DurableSources = append(report.DurableSources, "snapshot")
+		}
+	}
+
+	// Entries are appended under the shard locks held here; the WAL lock
+	// keeps compaction from swapping the file out mid-read
+	wal.Lock()
+	err := readWAL(config.WALPath, func(entry walEntry) {
+		if entry.Sequence <= after || entry.Collection != "" {
+			return
+		}
+		if entry.Op == walPut && entry.Record != nil {
+			durable[entry.Value] = entry.Record
+		} else {
+			delete(durable, entry.Value)
+		}
+	})
+	wal.Unlock()
+	if err != nil {
+		return fmt.Errorf("reading WAL: %w", err)
+	}
+	report.DurableSources = append(report.DurableSources, "wal")
+
+	now := time.Now()
+	for i, shard := range shards {
+		for _, records := range []map[string]*StringData{shard.records, shard.deleted} {
+			for value, data := range records {
+				if data.expired(now) {
+					continue
+				}
+				stored, ok := durable[value]
+				switch {
+				case !ok && backend == nil:
+					report.report(FsckDiscrepancy{Kind: fsckDurable, Check: "missing_on_disk", Shard: i, ID: data.ID, Detail: "string would be lost on restart"})
+				case ok && !sameRecord(data, stored):
+					report.report(FsckDiscrepancy{Kind: fsckDurable, Check: "differs", Shard: i, ID: data.ID, Detail: "a restart would restore another version of the string"})
+				}
+			}
+		}
+	}
+
+	if backend != nil {
+		return nil
+	}
+	for value, data := range durable {
+		if data.expired(now) {
+			continue
+		}
+		shard := shardFor(value)
+		if _, live := shard.records[value]; live {
+			continue
+		}
+		if _, deleted := shard.deleted[value]; !deleted {
+			report.report(FsckDiscrepancy{Kind: fsckDurable, Check: "missing_in_memory", Shard: int(shardIndex(value)), ID: data.ID, Detail: "a restart would bring back a string that is not stored"})
+		}
+	}
+	return nil
+}
+
+// sameRecord reports whether two records encode identically
+func sameRecord(a, b *StringData) bool {
+	encodedA, errA := json.Marshal(a)
+	encodedB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(encodedA, encodedB)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/hex"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// HashPrefixResponse represents the response for hash prefix lookups
+type HashPrefixResponse struct {
+	Data      []StringData `json:"data"`
+	Count     int          `json:"count"`
+	Prefix    string       `json:"prefix"`
+	Truncated bool         `json:"truncated,omitempty"`
+}
+
+// hashEntry pairs a SHA-256 hash with the value it was computed from
+type hashEntry struct {
+	hash  string
+	value string
+}
+
+// indexHashLocked inserts a string into the shard's hash index, which is
+// kept sorted by SHA-256 so prefix lookups are a binary search. Strings
+// created without a sha256_hash are left out. Caller must hold the shard
+// lock.
+func (s *storeShard) indexHashLocked(data *StringData) {
+	if data.Properties.SHA256Hash == "" || data.Encoding == encodingEncrypted {
+		return
+	}
+	entry := hashEntry{hash: data.Properties.SHA256Hash, value: data.Value}
+	i := sort.Search(len(s.hashes), func(i int) bool { return !hashEntryLess(s.hashes[i], entry) })
+
+	s.hashes = append(s.hashes, hashEntry{})
+	copy(s.hashes[i+1:], s.hashes[i:])
+	s.hashes[i] = entry
+}
+
+// unindexHashLocked removes a string from the shard's hash index. Caller
+// must hold the shard lock.
+func (s *storeShard) unindexHashLocked(data *StringData) {
+	entry := hashEntry{hash: data.Properties.SHA256Hash, value: data.Value}
+	i := sort.Search(len(s.hashes), func(i int) bool { return !hashEntryLess(s.hashes[i], entry) })
+
+	if i < len(s.hashes) && s.hashes[i] == entry {
+		s.hashes = append(s.hashes[:i], s.hashes[i+1:]...)
+	}
+}
+
+func hashEntryLess(a, b hashEntry) bool {
+	if a.hash != b.hash {
+		return a.hash < b.hash
+	}
+	return a.value < b.value
+}
+
+// getByHashPrefix handles GET /strings/by-hash-prefix/:prefix. Only the
+// sha256 HASH_ALGORITHM computes sha256_hash, so under any other the search
+// would quietly miss every new string and is refused instead.
+func getByHashPrefix(c *fiber.Ctx) error {
+	if config.HashAlgorithm != defaultHashAlgorithm {
+		return fiber.NewError(fiber.StatusNotImplemented, "Hash prefix search needs HASH_ALGORITHM=sha256; strings hashed with "+config.HashAlgorithm+" have no SHA-256")
+	}
+
+	prefix := strings.ToLower(c.Params("prefix"))
+
+	if !isHexPrefix(prefix) {
+		return fiber.NewError(fiber.StatusBadRequest, "prefix must be a hexadecimal SHA-256 prefix")
+	}
+
+	// The first MAX_RESULTS matches overall are among the first MAX_RESULTS
+	// of each shard. Each shard looks one match past that so a shard with
+	// more matches than the cap still marks the response truncated. Expired
+	// strings are skipped, as GET /strings/{value} does.
+	now := time.Now()
+	var found []*StringData
+	for _, shard := range shards {
+		shard.RLock()
+		start := sort.Search(len(shard.hashes), func(i int) bool { return shard.hashes[i].hash >= prefix })
+		contributed := 0
+		for i := start; i < len(shard.hashes) && strings.HasPrefix(shard.hashes[i].hash, prefix); i++ {
+			if config.MaxResults > 0 && contributed > config.MaxResults {
+				break
+			}
+			if data := shard.records[shard.hashes[i].value]; !data.expired(now) {
+				found = append(found, data)
+				contributed++
+			}
+		}
+		shard.RUnlock()
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return hashEntryLess(
+			hashEntry{hash: found[i].Properties.SHA256Hash, value: found[i].Value},
+			hashEntry{hash: found[j].Properties.SHA256Hash, value: found[j].Value},
+		)
+	})
+
+	var matches []StringData
+	truncated := false
+	for _, data := range found {
+		if config.MaxResults > 0 && len(matches) == config.MaxResults {
+			truncated = true
+			break
+		}
+		matches = append(matches, *data)
+	}
+
+	// A full hash can be resolved by backends that index records by hash
+	if len(matches) == 0 && len(prefix) == 64 {
+		data, err := loadColdByHash(c.UserContext(), prefix)
+		if err != nil {
+			return err
+		}
+		if data != nil && !data.expired(now) {
+			matches = append(matches, *data)
+		}
+	}
+
+	return c.JSON(HashPrefixResponse{
+		Data:      matches,
+		Count:     len(matches),
+		Prefix:    prefix,
+		Truncated: truncated,
+	})
+}
+
+// isHexPrefix reports whether s is a non-empty run of hex digits no longer than a SHA-256
+func isHexPrefix(s string) bool {
+	if s == "" || len(s) > 64 {
+		return false
+	}
+	// Pad odd lengths so hex.DecodeString validates every character
+	_, err := hex.DecodeString(s + strings.Repeat("0", len(s)%2))
+	return err == nil
+}
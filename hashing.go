@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/zeebo/blake3"
+)
+
+// defaultHashAlgorithm is assumed for records stored before the algorithm was recorded
+const defaultHashAlgorithm = "sha256"
+
+// hashAlgorithms maps supported ID hash names to their implementations
+var hashAlgorithms = map[string]func(string) string{
+	"sha256": computeSHA256,
+	"blake3": computeBLAKE3,
+	"xxhash": computeXXHash,
+}
+
+// computeBLAKE3 generates a 256-bit BLAKE3 hash of a string
+func computeBLAKE3(s string) string {
+	sum := blake3.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// computeXXHash generates a 64-bit xxHash of a string
+func computeXXHash(s string) string {
+	return strconv.FormatUint(xxhash.Sum64String(s), 16)
+}
+
+// computeID hashes a value with the configured algorithm. properties may
+// carry an already computed SHA-256 so it is not hashed twice.
+func computeID(value string, properties StringProperties) string {
+	if config.HashAlgorithm == "sha256" && properties.SHA256Hash != "" {
+		return properties.SHA256Hash
+	}
+	return hashAlgorithms[config.HashAlgorithm](value)
+}
+
+// recordHashAlgorithm returns the algorithm a stored record's ID was computed with
+func recordHashAlgorithm(data *StringData) string {
+	if data.HashAlgorithm == "" {
+		return defaultHashAlgorithm
+	}
+	return data.HashAlgorithm
+}
+
+// migrateHashes handles POST /admin/migrate-hash, recomputing the IDs of
+// records hashed with an algorithm other than the configured one.
+// Client-supplied IDs are kept.
+func migrateHashes(c *fiber.Ctx) error {
+	lockAllShards()
+	defer unlockAllShards()
+
+	migrated := 0
+	for _, data := range allRecordsLocked() {
+		if data.ClientSuppliedID || recordHashAlgorithm(data) == config.HashAlgorithm {
+			continue
+		}
+
+		updated := *data
+		if data.Encoding == encodingEncrypted {
+			// IDs of encrypted records hash the ciphertext
+			updated.ID = hashAlgorithms[config.HashAlgorithm](data.Value)
+		} else {
+			raw := rawValue(data)
+			if config.HashAlgorithm == defaultHashAlgorithm && updated.Properties.SHA256Hash == "" {
+				updated.Properties.SHA256Hash = computeSHA256(raw)
+			}
+			updated.ID = computeID(raw, updated.Properties)
+		}
+		updated.HashAlgorithm = config.HashAlgorithm
+		updated.UpdatedAt = time.Now().UTC()
+		shardFor(data.Value).putLocked(&updated)
+		migrated++
+	}
+
+	return c.JSON(fiber.Map{
+		"algorithm": config.HashAlgorithm,
+		"migrated":  migrated,
+	})
+}
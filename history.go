@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Kinds of recorded queries
+const (
+	queryKindStructured      = "structured"
+	queryKindNaturalLanguage = "natural_language"
+)
+
+// QueryHistoryEntry is one listing an API key ran
+type QueryHistoryEntry struct {
+	Kind      string                 `json:"kind"`
+	Path      string                 `json:"path"`
+	Query     string                 `json:"query"`
+	Filters   map[string]interface{} `json:"filters"`
+	Count     int                    `json:"count"`
+	Truncated bool                   `json:"truncated,omitempty"`
+	Time      time.Time              `json:"time"`
+}
+
+// QueryHistoryResponse represents the response for GET /me/query-history
+type QueryHistoryResponse struct {
+	Queries []QueryHistoryEntry `json:"queries"`
+	Count   int                 `json:"count"`
+}
+
+// queryHistory keeps the most recent QUERY_HISTORY_SIZE queries of each API
+// key, by actor, oldest first
+var queryHistory = struct {
+	sync.Mutex
+	entries map[string][]QueryHistoryEntry
+}{entries: make(map[string][]QueryHistoryEntry)}
+
+// recordQuery adds a listing to the caller's history. Only callers sending
+// an API key have one, since an IP address may be shared.
+func recordQuery(c *fiber.Ctx, kind, query string, filters map[string]interface{}, count int, truncated bool) {
+	if c.Get(headerAPIKey) == "" || config.QueryHistorySize <= 0 {
+		return
+	}
+
+	// Request strings are only valid for the lifetime of the request, so
+	// copy everything kept
+	kept := make(map[string]interface{}, len(filters))
+	for name, val := range filters {
+		if s, ok := val.(string); ok {
+			val = strings.Clone(s)
+		}
+		kept[name] = val
+	}
+
+	entry := QueryHistoryEntry{
+		Kind:      kind,
+		Path:      strings.Clone(c.Path()),
+		Query:     strings.Clone(query),
+		Filters:   kept,
+		Count:     count,
+		Truncated: truncated,
+		Time:      time.Now().UTC(),
+	}
+	actor := requestActor(c)
+
+	queryHistory.Lock()
+	defer queryHistory.Unlock()
+
+	entries := append(queryHistory.entries[actor], entry)
+	if excess := len(entries) - config.QueryHistorySize; excess > 0 {
+		entries = append([]QueryHistoryEntry(nil), entries[excess:]...)
+	}
+	queryHistory.entries[actor] = entries
+}
+
+// getQueryHistory handles GET /me/query-history, returning the caller's
+// recent queries newest first
+func getQueryHistory(c *fiber.Ctx) error {
+	if c.Get(headerAPIKey) == "" {
+		return fiber.NewError(fiber.StatusUnauthorized, "Query history requires an X-API-Key header")
+	}
+
+	queryHistory.Lock()
+	entries := queryHistory.entries[requestActor(c)]
+	queries := make([]QueryHistoryEntry, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		queries = append(queries, entries[i])
+	}
+	queryHistory.Unlock()
+
+	return c.JSON(QueryHistoryResponse{Queries: queries, Count: len(queries)})
+}
+
+// clearQueryHistory handles DELETE /me/query-history
+func clearQueryHistory(c *fiber.Ctx) error {
+	if c.Get(headerAPIKey) == "" {
+		return fiber.NewError(fiber.StatusUnauthorized, "Query history requires an X-API-Key header")
+	}
+
+	queryHistory.Lock()
+	delete(queryHistory.entries, requestActor(c))
+	queryHistory.Unlock()
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Idempotency headers
+const (
+	headerIdempotencyKey     = "Idempotency-Key"
+	headerIdempotentReplayed = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+)
+
+// idempotentResponse is a response remembered for an Idempotency-Key. A nil
+// body means the first request is still running.
+type idempotentResponse struct {
+	fingerprint [sha256.Size]byte
+	status      int
+	contentType string
+	body        []byte
+	expiresAt   time.Time
+}
+
+// queuedIdempotencyKey records when a key expires
+type queuedIdempotencyKey struct {
+	key       string
+	expiresAt time.Time
+}
+
+// idempotencyKeys holds responses by actor and key. order lists keys oldest
+// first; since every key lives for IDEMPOTENCY_TTL, expired ones are always
+// at its front.
+var idempotencyKeys = struct {
+	sync.Mutex
+	responses map[string]*idempotentResponse
+	order     []queuedIdempotencyKey
+}{responses: make(map[string]*idempotentResponse)}
+
+// idempotent wraps a handler so a request repeating the Idempotency-Key of
+// an earlier successful one by the same caller gets the original response
+// back instead of running again. Failed requests are forgotten so they can
+// be retried. Reusing a key for a different request is refused with 422.
+func idempotent(handler fiber.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get(headerIdempotencyKey)
+		if key == "" || config.IdempotencyTTL <= 0 {
+			return handler(c)
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			return fiber.NewError(fiber.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+		}
+
+		scoped := requestActor(c) + ":" + key
+		fingerprint := sha256.Sum256(bytes.Join([][]byte{c.Request().URI().FullURI(), c.Body()}, []byte{0}))
+		now := time.Now()
+
+		idempotencyKeys.Lock()
+		pruneIdempotencyKeysLocked(now)
+		if previous, exists := idempotencyKeys.responses[scoped]; exists {
+			replay := *previous
+			idempotencyKeys.Unlock()
+
+			switch {
+			case replay.fingerprint != fingerprint:
+				return fiber.NewError(fiber.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+			case replay.body == nil:
+				return fiber.NewError(fiber.StatusConflict, "A request with this Idempotency-Key is still in progress")
+			}
+			c.Set(headerIdempotentReplayed, "true")
+			c.Set(fiber.HeaderContentType, replay.contentType)
+			return c.Status(replay.status).Send(replay.body)
+		}
+		pending := &idempotentResponse{fingerprint: fingerprint, expiresAt: now.Add(config.IdempotencyTTL)}
+		idempotencyKeys.responses[scoped] = pending
+		idempotencyKeys.order = append(idempotencyKeys.order, queuedIdempotencyKey{key: scoped, expiresAt: pending.expiresAt})
+		idempotencyKeys.Unlock()
+
+		// Forget the key unless the request succeeds, so failures (panics
+		// included) can be retried
+		succeeded := false
+		defer func() {
+			if !succeeded {
+				idempotencyKeys.Lock()
+				if idempotencyKeys.responses[scoped] == pending {
+					delete(idempotencyKeys.responses, scoped)
+				}
+				idempotencyKeys.Unlock()
+			}
+		}()
+
+		if err := handler(c); err != nil || c.Response().StatusCode() >= fiber.StatusBadRequest {
+			return err
+		}
+
+		idempotencyKeys.Lock()
+		defer idempotencyKeys.Unlock()
+
+		pending.status = c.Response().StatusCode()
+		pending.contentType = string(c.Response().Header.ContentType())
+		pending.body = append([]byte{}, c.Response().Body()...)
+		succeeded = true
+		return nil
+	}
+}
+
+// pruneIdempotencyKeysLocked forgets keys expired at now. Caller must hold
+// idempotencyKeys.
+func pruneIdempotencyKeysLocked(now time.Time) {
+	expired := 0
+	for _, queued := range idempotencyKeys.order {
+		if now.Before(queued.expiresAt) {
+			break
+		}
+		// The key may have been forgotten and used again since
+		if response, exists := idempotencyKeys.responses[queued.key]; exists && response.expiresAt.Equal(queued.expiresAt) {
+			delete(idempotencyKeys.responses, queued.key)
+		}
+		expired++
+	}
+	idempotencyKeys.order = idempotencyKeys.order[expired:]
+}
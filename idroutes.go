@@ -0,0 +1,94 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// getStringByID handles GET /strings/id/:id. Every string can be addressed
+// by its ID or SHA-256, whatever characters the value contains.
+func getStringByID(c *fiber.Ctx) error {
+	data, err := findByID(c, c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	return sendRecord(c, data)
+}
+
+// deleteStringByID handles DELETE /strings/id/:id, answering like
+// DELETE /strings/:string_value
+func deleteStringByID(c *fiber.Ctx) error {
+	id := c.Params("id")
+	if c.QueryBool("permanent") {
+		if data := findDeletedByID(id); data != nil {
+			return deleteValue(c, data.Value)
+		}
+	}
+
+	data, err := findByID(c, id)
+	if err != nil {
+		return err
+	}
+
+	return deleteValue(c, data.Value)
+}
+
+// findByID resolves a record ID: a client-supplied ID exactly as given, a
+// hash ID in any case, or the SHA-256 of a string created while IDs used
+// SHA-256, falling back to backends that index records by hash
+func findByID(c *fiber.Ctx, id string) (*StringData, error) {
+	now := time.Now()
+	if data, ok := lookupIDs([]string{id})[id]; ok && !data.expired(now) {
+		return data, nil
+	}
+
+	hash := strings.ToLower(id)
+	if !isHexPrefix(hash) {
+		if validateClientID(id) != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "id must be a hexadecimal hash or a client-supplied ID")
+		}
+		return nil, fiber.NewError(fiber.StatusNotFound, "String does not exist in the system")
+	}
+
+	if hash != id {
+		if data, ok := lookupIDs([]string{hash})[hash]; ok && !data.expired(now) {
+			return data, nil
+		}
+	}
+
+	if len(hash) == 64 {
+		if data := lookupHash(hash); data != nil && !data.expired(now) {
+			return data, nil
+		}
+
+		data, err := loadColdByHash(c.UserContext(), hash)
+		if err != nil {
+			return nil, err
+		}
+		if data != nil {
+			return data, nil
+		}
+	}
+
+	return nil, fiber.NewError(fiber.StatusNotFound, "String does not exist in the system")
+}
+
+// lookupHash returns the stored record with exactly the given SHA-256, or nil
+func lookupHash(hash string) *StringData {
+	for _, shard := range shards {
+		shard.RLock()
+		i := sort.Search(len(shard.hashes), func(i int) bool { return shard.hashes[i].hash >= hash })
+		if i < len(shard.hashes) && shard.hashes[i].hash == hash {
+			data := shard.records[shard.hashes[i].value]
+			shard.touchLocked(data.Value)
+			shard.RUnlock()
+			return data
+		}
+		shard.RUnlock()
+	}
+	return nil
+}
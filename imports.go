@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Import session states
+const (
+	importOpen      = "open"
+	importCommitted = "committed"
+)
+
+// ImportSession is a file of values uploaded in chunks and stored in one go
+// at commit time
+type ImportSession struct {
+	ID        string    `json:"id"`
+	Status    string    `json:"status"`
+	Offset    int64     `json:"offset"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// path holds the chunks received so far
+	path string
+	// busy is set while a chunk is written or the session commits
+	busy bool
+}
+
+// ImportCommitResponse represents the response for POST /imports/:id/commit.
+// Only failed lines are listed, indexed from zero, since files may hold
+// millions of values.
+type ImportCommitResponse struct {
+	Counts     map[string]int       `json:"counts"`
+	Errors     []BatchCreateItem    `json:"errors"`
+	Duplicates BatchDuplicateCounts `json:"duplicates"`
+}
+
+// importSessions holds open sessions until they are committed or expire
+var importSessions = struct {
+	sync.Mutex
+	sessions map[string]*ImportSession
+}{sessions: make(map[string]*ImportSession)}
+
+// createImport handles POST /imports, opening a session whose file is
+// uploaded with PUT /imports/:id/chunks
+func createImport(c *fiber.Ctx) error {
+	id, err := newExportID()
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(config.ImportDir, "import-"+id+"-*")
+	if err != nil {
+		return err
+	}
+	file.Close()
+
+	now := time.Now().UTC()
+	session := &ImportSession{
+		ID:        id,
+		Status:    importOpen,
+		CreatedAt: now,
+		ExpiresAt: now.Add(config.ImportTTL),
+		path:      file.Name(),
+	}
+
+	importSessions.Lock()
+	pruneImportsLocked(now)
+	importSessions.sessions[id] = session
+	response := *session
+	importSessions.Unlock()
+
+	c.Location("/imports/" + id)
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+// getImport handles GET /imports/:id. Offset is where an interrupted
+// upload resumes.
+func getImport(c *fiber.Ctx) error {
+	importSessions.Lock()
+	defer importSessions.Unlock()
+
+	session, err := findImportLocked(c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(*session)
+}
+
+// uploadImportChunk handles PUT /imports/:id/chunks?offset=, appending the
+// body to the session's file. The offset must equal the bytes received so
+// far; otherwise 409 reports the offset to resume from, so a chunk that
+// was retried after a network failure is never written twice.
+func uploadImportChunk(c *fiber.Ctx) error {
+	offset, err := strconv.ParseInt(c.Query("offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "offset must be a non-negative byte offset")
+	}
+
+	session, err := claimImport(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	defer releaseImport(session)
+
+	if offset != session.Offset {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":  fmt.Sprintf("Chunk starts at byte %d but the session has %d", offset, session.Offset),
+			"offset": session.Offset,
+		})
+	}
+
+	file, err := os.OpenFile(session.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	written, err := file.Write(c.Body())
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// Drop a partial write so the offset stays trustworthy
+		os.Truncate(session.path, session.Offset)
+		return err
+	}
+
+	importSessions.Lock()
+	session.Offset += int64(written)
+	response := *session
+	importSessions.Unlock()
+
+	return c.JSON(response)
+}
+
+// commitImport handles POST /imports/:id/commit. The file holds one
+// POST /strings body per line. Every line is checked and analyzed first;
+// if any fails, nothing is stored and the failures are reported with 422.
+// Otherwise all values are stored at once, honoring on_conflict and
+// duplicate_policy like POST /strings/batch.
+func commitImport(c *fiber.Ctx) error {
+	opts, err := parseCreateOptions(c)
+	if err != nil {
+		return err
+	}
+
+	session, err := claimImport(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	defer releaseImport(session)
+
+	response := ImportCommitResponse{
+		Counts: make(map[string]int),
+		Errors: []BatchCreateItem{},
+	}
+
+	pending, err := prepareImport(c, session.path, opts, &response)
+	if err != nil {
+		return err
+	}
+	if len(response.Errors) > 0 {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	applied, err := applyImport(pending, opts)
+	if err != nil {
+		return err
+	}
+
+	for _, result := range pending {
+		response.Counts[result.outcome]++
+	}
+	for _, event := range applied {
+		publishEvent(event)
+	}
+
+	os.Remove(session.path)
+	importSessions.Lock()
+	session.Status = importCommitted
+	importSessions.Unlock()
+
+	return c.JSON(response)
+}
+
+// deleteImport handles DELETE /imports/:id, abandoning a session
+func deleteImport(c *fiber.Ctx) error {
+	session, err := claimImport(c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	importSessions.Lock()
+	delete(importSessions.sessions, session.ID)
+	importSessions.Unlock()
+	os.Remove(session.path)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// prepareImport analyzes every line of the file without storing anything,
+// recording failures on response
+func prepareImport(c *fiber.Ctx, path string, opts createOptions, response *ImportCommitResponse) ([]*createResult, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	opts.validateOnly = true
+	validation := newBatchValidation()
+
+	var pending []*createResult
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 0; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var req CreateStringRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			response.Errors = append(response.Errors, failedBatchItem(line, fiber.NewError(fiber.StatusBadRequest, "Invalid JSON: "+err.Error())))
+			response.Counts["failed"]++
+			continue
+		}
+
+		result, err := createValue(c.UserContext(), req, opts)
+		result, err = validation.check(req, result, err, opts)
+		if err != nil {
+			if c.UserContext().Err() != nil {
+				return nil, contextError(err)
+			}
+			response.Errors = append(response.Errors, failedBatchItem(line, err))
+			response.Counts["failed"]++
+			continue
+		}
+		if result.outcome == outcomeCreated || result.outcome == outcomeReplaced {
+			pending = append(pending, result)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Reading import: "+err.Error())
+	}
+
+	response.Duplicates = validation.counts
+	return pending, nil
+}
+
+// applyImport stores the prepared records while holding every shard lock,
+// so readers see either none or all of them. Values created concurrently
+// since preparation are resolved by on_conflict; with error nothing is
+// stored. It returns the events to publish.
+func applyImport(pending []*createResult, opts createOptions) ([]Event, error) {
+	lockAllShards()
+	defer unlockAllShards()
+
+	if opts.onConflict == onConflictError {
+		for _, result := range pending {
+			if result.outcome == outcomeCreated && shardFor(result.data.Value).liveRecordLocked(result.data.Value) != nil {
+				return nil, fiber.NewError(fiber.StatusConflict, fmt.Sprintf("String %q was created during the import; nothing stored", displayValue(result.data.Value)))
+			}
+		}
+	}
+	if opts.replaces() {
+		for _, result := range pending {
+			if existing := shardFor(result.data.Value).liveRecordLocked(result.data.Value); existing != nil && existing.Pinned {
+				return nil, fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("String %q is pinned by the seed file; nothing stored", displayValue(result.data.Value)))
+			}
+		}
+	}
+
+	// Client-supplied IDs were checked one line at a time
+	claimed := make(map[string]string)
+	for _, result := range pending {
+		data := result.data
+		if !data.ClientSuppliedID {
+			continue
+		}
+		owner, taken := clientIDOwnerLocked(data.ID)
+		if claimer, ok := claimed[data.ID]; ok {
+			owner, taken = claimer, true
+		}
+		if taken && owner != data.Value {
+			return nil, fiber.NewError(fiber.StatusConflict, fmt.Sprintf("ID %q is used by another string; nothing stored", data.ID))
+		}
+		claimed[data.ID] = data.Value
+	}
+
+	var events []Event
+	for _, result := range pending {
+		data := result.data
+		shard := shardFor(data.Value)
+		existing := shard.liveRecordLocked(data.Value)
+
+		if existing != nil && !opts.replaces() {
+			resolved, _ := resolveConflict(existing, opts.onConflict)
+			result.outcome = resolved.outcome
+			continue
+		}
+		if existing != nil {
+			// Replacing refreshes the analysis but keeps the record's history
+			opts.inherit(data, existing)
+			result.outcome = outcomeReplaced
+		} else {
+			result.outcome = outcomeCreated
+		}
+		data.UpdatedAt = time.Now().UTC()
+		shard.putLocked(data)
+
+		if existing == nil {
+			events = append(events, Event{Type: eventStringCreated, ID: data.ID, Value: data.Value, Actor: opts.actor, after: data})
+		} else if changes := propertyDiff(existing.Properties, data.Properties); len(changes) > 0 {
+			events = append(events, Event{Type: eventPropertiesChanged, ID: data.ID, Value: data.Value, Actor: opts.actor, Changes: changes, before: existing, after: data})
+		}
+	}
+
+	return events, nil
+}
+
+// claimImport marks an open session busy so chunks, commits and deletes
+// never overlap
+func claimImport(id string) (*ImportSession, error) {
+	importSessions.Lock()
+	defer importSessions.Unlock()
+
+	session, err := findImportLocked(id)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status != importOpen {
+		return nil, fiber.NewError(fiber.StatusConflict, "Import session is already "+session.Status)
+	}
+	if session.busy {
+		return nil, fiber.NewError(fiber.StatusConflict, "Import session is busy with another request")
+	}
+	session.busy = true
+	return session, nil
+}
+
+// releaseImport clears the busy mark set by claimImport
+func releaseImport(session *ImportSession) {
+	importSessions.Lock()
+	session.busy = false
+	importSessions.Unlock()
+}
+
+// findImportLocked looks a session up by ID. Caller must hold importSessions.
+func findImportLocked(id string) (*ImportSession, error) {
+	pruneImportsLocked(time.Now())
+	session, ok := importSessions.sessions[id]
+	if !ok {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Import session does not exist")
+	}
+	return session, nil
+}
+
+// pruneImportsLocked forgets expired sessions and deletes their files.
+// Caller must hold importSessions.
+func pruneImportsLocked(now time.Time) {
+	for id, session := range importSessions.sessions {
+		if session.busy || now.Before(session.ExpiresAt) {
+			continue
+		}
+		os.Remove(session.path)
+		delete(importSessions.sessions, id)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import "strings"
+
+// Names of the indexes a listing can read its candidates from, as reported
+// in query traces
+const (
+	indexLength     = "length_index"
+	indexWordCount  = "word_count_index"
+	indexPalindrome = "palindrome_index"
+	indexCharacter  = "character_index"
+	indexValue      = "value_index"
+)
+
+// postingList maps a property value to the set of stored values having it
+type postingList[K comparable] map[K]map[string]bool
+
+func (idx postingList[K]) add(key K, value string) {
+	if idx[key] == nil {
+		idx[key] = make(map[string]bool)
+	}
+	idx[key][value] = true
+}
+
+func (idx postingList[K]) remove(key K, value string) {
+	delete(idx[key], value)
+	if len(idx[key]) == 0 {
+		delete(idx, key)
+	}
+}
+
+// filterIndexes are the posting lists behind the indexed filters. Lengths
+// are bucketed by exact length, so a length range reads one set per
+// distinct length in it.
+type filterIndexes struct {
+	lengths     postingList[int]
+	wordCounts  postingList[int]
+	palindromes postingList[bool]
+	characters  postingList[string]
+}
+
+func newFilterIndexes() filterIndexes {
+	return filterIndexes{
+		lengths:     make(postingList[int]),
+		wordCounts:  make(postingList[int]),
+		palindromes: make(postingList[bool]),
+		characters:  make(postingList[string]),
+	}
+}
+
+// indexFiltersLocked adds a string to the shard's filter indexes. Caller
+// must hold the shard lock.
+func (s *storeShard) indexFiltersLocked(data *StringData) {
+	s.filters.lengths.add(data.Properties.Length, data.Value)
+	s.filters.wordCounts.add(data.Properties.WordCount, data.Value)
+	s.filters.palindromes.add(data.Properties.IsPalindrome, data.Value)
+	for _, char := range strings.ToLower(searchableCharacters(data)) {
+		s.filters.characters.add(string(char), data.Value)
+	}
+}
+
+// unindexFiltersLocked removes a string from the shard's filter indexes.
+// Caller must hold the shard lock.
+func (s *storeShard) unindexFiltersLocked(data *StringData) {
+	s.filters.lengths.remove(data.Properties.Length, data.Value)
+	s.filters.wordCounts.remove(data.Properties.WordCount, data.Value)
+	s.filters.palindromes.remove(data.Properties.IsPalindrome, data.Value)
+	for _, char := range strings.ToLower(searchableCharacters(data)) {
+		s.filters.characters.remove(string(char), data.Value)
+	}
+}
+
+// lengthPostings returns the sets of values whose length satisfies keep
+func lengthPostings(s *storeShard, keep func(length int) bool) []map[string]bool {
+	var sets []map[string]bool
+	for length, values := range s.filters.lengths {
+		if keep(length) {
+			sets = append(sets, values)
+		}
+	}
+	return sets
+}
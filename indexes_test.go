@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+)
+
+// indexedQueries exercise every indexed filter, alone and combined with
+// others
+var indexedQueries = []map[string]interface{}{
+	{"is_palindrome": true},
+	{"is_palindrome": false, "min_length": 12},
+	{"word_count": 2},
+	{"word_count": 3, "contains_character": "q"},
+	{"contains_character": "z"},
+	{"min_length": 5, "max_length": 9},
+	{"max_length": 4, "is_palindrome": true},
+	{"min_length": 10, "word_count": 1, "contains_character": "e"},
+}
+
+// scanned returns the plan reading every record instead of an index
+func scanned(plan queryPlan) queryPlan {
+	plan.access = ""
+	return plan
+}
+
+// matchedValues runs a plan and returns the sorted matching values
+func matchedValues(tb testing.TB, plan queryPlan) []string {
+	tb.Helper()
+	records, _, err := plan.collect(context.Background(), 0, nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	values := make([]string, len(records))
+	for i, data := range records {
+		values[i] = data.Value
+	}
+	sort.Strings(values)
+	return values
+}
+
+func TestIndexedFiltersMatchScan(t *testing.T) {
+	fillStore(t, 3000)
+	for _, value := range []string{"racecar", "Level", "a", "noon noon", "quiz", "zz top"} {
+		if err := storeValue(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Removed strings must leave the indexes too
+	for i := 0; i < 3000; i += 7 {
+		shard := shardFor(benchValue(i))
+		shard.Lock()
+		shard.removeLocked(benchValue(i))
+		shard.Unlock()
+	}
+
+	for _, filters := range indexedQueries {
+		plan := planFilters(filters)
+		if plan.access == "" {
+			t.Errorf("%v: no index used", filters)
+			continue
+		}
+
+		indexed, full := matchedValues(t, plan), matchedValues(t, scanned(plan))
+		if strings.Join(indexed, "\n") != strings.Join(full, "\n") {
+			t.Errorf("%v: %s found %d strings, a full scan %d", filters, plan.access, len(indexed), len(full))
+		}
+	}
+}
+
+// millionStrings is how many strings BenchmarkIndexedFilters stores
+const millionStrings = 1_000_000
+
+var fillMillion sync.Once
+
+// fillMillionStrings stores a million strings once for the index
+// benchmarks. Analyzing that many takes minutes, so only the properties
+// the indexes cover are filled in, and values and hashes increase so the
+// sorted value and hash indexes are appended to.
+func fillMillionStrings(b *testing.B) {
+	fillMillion.Do(func() {
+		resetStore(b)
+		for i := 0; i < millionStrings; i++ {
+			value := fmt.Sprintf("%07d %s", i, benchWords[i%len(benchWords)])
+			if i%3 == 0 {
+				value += " " + benchWords[i/3%len(benchWords)]
+			}
+			if i%100 == 0 {
+				value = fmt.Sprintf("%07d", i)
+				value += reverseString(value)
+			}
+
+			length := utf8.RuneCountInString(value)
+			data := &StringData{
+				ID:    fmt.Sprintf("%064x", i),
+				Value: value,
+				Properties: StringProperties{
+					Length:         length,
+					RuneLength:     length,
+					ByteLength:     len(value),
+					GraphemeLength: length,
+					WordCount:      len(strings.Fields(value)),
+					IsPalindrome:   isPalindrome(value),
+					SHA256Hash:     fmt.Sprintf("%064x", i),
+				},
+			}
+			shard := shardFor(value)
+			shard.Lock()
+			shard.cacheLocked(data)
+			shard.Unlock()
+		}
+	})
+}
+
+// reverseString returns a string's runes in reverse order
+func reverseString(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+// BenchmarkIndexedFilters lists a million strings with each indexed query,
+// through the planner's index and with a full scan
+func BenchmarkIndexedFilters(b *testing.B) {
+	if testing.Short() {
+		b.Skip("stores a million strings")
+	}
+	fillMillionStrings(b)
+
+	ctx := context.Background()
+	for _, filters := range indexedQueries {
+		plan := planFilters(filters)
+		for _, run := range []struct {
+			name string
+			plan queryPlan
+		}{{"indexed", plan}, {"scan", scanned(plan)}} {
+			b.Run(fmt.Sprintf("%v/%s", filters, run.name), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, _, err := run.plan.collect(ctx, 0, nil); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
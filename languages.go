@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//go:embed packs/*.json
+var builtinPacks embed.FS
+
+// LanguagePack bundles the language-dependent data used by the stopword,
+// syllable, stemming and sentiment analyzers. Packs are plain JSON so
+// supporting a new language only needs a new file. A silent ending does
+// not lose a syllable in words ending in one of KeepEndings ("table").
+// Sample is natural text in the language that, with the stopwords, trains
+// its detection model.
+type LanguagePack struct {
+	Code          string   `json:"code"`
+	Name          string   `json:"name"`
+	Stopwords     []string `json:"stopwords"`
+	Vowels        string   `json:"vowels"`
+	SilentEndings []string `json:"silent_endings"`
+	KeepEndings   []string `json:"keep_endings"`
+	Suffixes      []string `json:"suffixes"`
+	Undouble      bool     `json:"undouble"`
+	PositiveWords []string `json:"positive_words"`
+	NegativeWords []string `json:"negative_words"`
+	Negations     []string `json:"negations"`
+	Sample        string   `json:"sample"`
+
+	stopwords map[string]bool
+	polarity  map[string]int
+	negations map[string]bool
+	trigrams  trigramModel
+}
+
+// trigramModel holds the add-one smoothed log probabilities of the letter
+// trigrams seen in a language's training text
+type trigramModel struct {
+	logProb map[string]float64
+	unseen  float64
+}
+
+// trigramVocabulary is the number of distinct trigrams assumed when
+// smoothing, the same for every pack so that packs trained on more text
+// are not penalised for trigrams they have never seen
+const trigramVocabulary = 8000
+
+// languagePacks is populated at startup and read-only afterwards
+var languagePacks = make(map[string]*LanguagePack)
+
+// minLanguageEvidence is how many matching words a language-dependent
+// score needs for its full confidence
+const minLanguageEvidence = 3
+
+// loadLanguagePacks registers the built-in packs followed by any found in
+// dir, which may override built-ins with the same code
+func loadLanguagePacks(dir string) error {
+	entries, err := builtinPacks.ReadDir("packs")
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		raw, err := builtinPacks.ReadFile("packs/" + entry.Name())
+		if err != nil {
+			return err
+		}
+		if err := registerLanguagePack(raw); err != nil {
+			return fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+	}
+
+	if dir == "" {
+		return nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if err := registerLanguagePack(raw); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	}
+
+	return nil
+}
+
+// registerLanguagePack parses and registers a single JSON pack
+func registerLanguagePack(raw []byte) error {
+	var pack LanguagePack
+	if err := json.Unmarshal(raw, &pack); err != nil {
+		return err
+	}
+	if pack.Code == "" {
+		return fmt.Errorf("language pack is missing a code")
+	}
+
+	pack.stopwords = make(map[string]bool, len(pack.Stopwords))
+	for _, word := range pack.Stopwords {
+		pack.stopwords[strings.ToLower(word)] = true
+	}
+	pack.polarity = make(map[string]int, len(pack.PositiveWords)+len(pack.NegativeWords))
+	for _, word := range pack.PositiveWords {
+		pack.polarity[strings.ToLower(word)] = 1
+	}
+	for _, word := range pack.NegativeWords {
+		pack.polarity[strings.ToLower(word)] = -1
+	}
+	pack.negations = make(map[string]bool, len(pack.Negations))
+	for _, word := range pack.Negations {
+		pack.negations[strings.ToLower(word)] = true
+	}
+	pack.trigrams = newTrigramModel(append(strings.Fields(pack.Sample), pack.Stopwords...))
+
+	// Longest suffixes first so stemming strips as much as possible
+	suffixes := pack.Suffixes[:0]
+	for _, suffix := range pack.Suffixes {
+		if suffix != "" {
+			suffixes = append(suffixes, suffix)
+		}
+	}
+	pack.Suffixes = suffixes
+	sort.SliceStable(pack.Suffixes, func(i, j int) bool {
+		return utf8.RuneCountInString(pack.Suffixes[i]) > utf8.RuneCountInString(pack.Suffixes[j])
+	})
+
+	languagePacks[pack.Code] = &pack
+	return nil
+}
+
+// languageWords tokenizes a value into lowercase words with surrounding punctuation removed
+func languageWords(s string, tokenizer Tokenizer) []string {
+	var words []string
+	for _, token := range tokenizer.Tokenize(strings.ToLower(s)) {
+		word := strings.TrimFunc(token, func(r rune) bool { return !isWordRune(r) })
+		if word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// detectLanguagePack picks the most likely pack for words, falling back to
+// the configured default language
+func detectLanguagePack(words []string) *LanguagePack {
+	if pack, _ := detectLanguage(words); pack != nil {
+		return pack
+	}
+	return languagePacks[config.DefaultLanguage]
+}
+
+// detectLanguage scores words against every pack's trigram model (naive
+// Bayes over letter trigrams) and returns the most likely pack with its
+// posterior probability from 0 to 1, ties going to the code first
+// alphabetically, or nil when words have no letters
+func detectLanguage(words []string) (*LanguagePack, float64) {
+	codes := make([]string, 0, len(languagePacks))
+	for code := range languagePacks {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	var trigrams []string
+	eachTrigram(words, func(trigram string) { trigrams = append(trigrams, trigram) })
+	if len(trigrams) == 0 || len(codes) == 0 {
+		return nil, 0
+	}
+
+	scores := make([]float64, len(codes))
+	best := 0
+	for i, code := range codes {
+		scores[i] = languagePacks[code].trigrams.score(trigrams)
+		if scores[i] > scores[best] {
+			best = i
+		}
+	}
+
+	// Softmax relative to the best score keeps the exponentials finite
+	total := 0.0
+	for _, score := range scores {
+		total += math.Exp(score - scores[best])
+	}
+	return languagePacks[codes[best]], math.Round(100/total) / 100
+}
+
+// newTrigramModel counts the letter trigrams of words
+func newTrigramModel(words []string) trigramModel {
+	counts := make(map[string]int)
+	total := 0
+	eachTrigram(words, func(trigram string) {
+		counts[trigram]++
+		total++
+	})
+
+	model := trigramModel{
+		logProb: make(map[string]float64, len(counts)),
+		unseen:  math.Log(1 / float64(total+trigramVocabulary)),
+	}
+	for trigram, count := range counts {
+		model.logProb[trigram] = math.Log(float64(count+1) / float64(total+trigramVocabulary))
+	}
+	return model
+}
+
+// score is the log likelihood of trigrams under the model
+func (m trigramModel) score(trigrams []string) float64 {
+	sum := 0.0
+	for _, trigram := range trigrams {
+		if logProb, ok := m.logProb[trigram]; ok {
+			sum += logProb
+		} else {
+			sum += m.unseen
+		}
+	}
+	return sum
+}
+
+// eachTrigram calls fn with every trigram of the letter runs in words,
+// padded with a space at each end so word boundaries count
+func eachTrigram(words []string, fn func(string)) {
+	for _, word := range words {
+		runs := strings.FieldsFunc(strings.ToLower(word), func(r rune) bool { return !unicode.IsLetter(r) })
+		for _, run := range runs {
+			letters := []rune(" " + run + " ")
+			for i := 0; i+3 <= len(letters); i++ {
+				fn(string(letters[i : i+3]))
+			}
+		}
+	}
+}
+
+// countStopwords counts the words that are stopwords in this language
+func (p *LanguagePack) countStopwords(words []string) int {
+	count := 0
+	for _, word := range words {
+		if p.stopwords[word] {
+			count++
+		}
+	}
+	return count
+}
+
+// countSyllables estimates syllables as vowel groups, discounting silent endings
+func (p *LanguagePack) countSyllables(word string) int {
+	syllables := 0
+	inVowelGroup := false
+	for _, char := range word {
+		isVowel := strings.ContainsRune(p.Vowels, char)
+		if isVowel && !inVowelGroup {
+			syllables++
+		}
+		inVowelGroup = isVowel
+	}
+
+	if syllables > 1 && !p.keepsEnding(word) {
+		for _, ending := range p.SilentEndings {
+			if strings.HasSuffix(word, ending) {
+				syllables--
+				break
+			}
+		}
+	}
+
+	if syllables == 0 {
+		return 1
+	}
+	return syllables
+}
+
+// keepsEnding reports whether word ends in one of the pack's keep endings
+func (p *LanguagePack) keepsEnding(word string) bool {
+	for _, ending := range p.KeepEndings {
+		if strings.HasSuffix(word, ending) {
+			return true
+		}
+	}
+	return false
+}
+
+// stem strips the longest known suffix, keeping a stem of at least three
+// letters. Packs with undouble set also collapse a doubled final consonant
+// left by a vowel suffix ("running" -> "run").
+func (p *LanguagePack) stem(word string) string {
+	for _, suffix := range p.Suffixes {
+		if !strings.HasSuffix(word, suffix) || utf8.RuneCountInString(word)-utf8.RuneCountInString(suffix) < 3 {
+			continue
+		}
+
+		stem := []rune(strings.TrimSuffix(word, suffix))
+		last := len(stem) - 1
+		suffixStartsWithVowel := strings.ContainsRune(p.Vowels, []rune(suffix)[0])
+		if p.Undouble && suffixStartsWithVowel && last > 1 && stem[last] == stem[last-1] && !strings.ContainsRune(p.Vowels, stem[last]) {
+			stem = stem[:last]
+		}
+		return string(stem)
+	}
+	return word
+}
+
+// analyzeLanguage fills the language-dependent properties using the
+// detected pack, or the default one when no language is detected, in which
+// case detected_language is left empty
+func analyzeLanguage(_ context.Context, value string, properties *StringProperties, profile *analysisProfile) {
+	words := languageWords(value, profile.tokenizer)
+	pack, confidence := detectLanguage(words)
+	if pack != nil {
+		properties.DetectedLanguage, properties.LanguageConfidence = pack.Code, confidence
+	} else {
+		pack = languagePacks[config.DefaultLanguage]
+	}
+	if pack == nil {
+		return
+	}
+
+	properties.LanguagePack = pack.Code
+	properties.StopwordCount = pack.countStopwords(words)
+	for _, word := range words {
+		properties.SyllableCount += pack.countSyllables(word)
+	}
+}
+
+// containsStem reports whether a stored string has a word sharing word's
+// stem, tokenized and stemmed the same way the string was analyzed
+func containsStem(data *StringData, word string) bool {
+	pack := languagePacks[data.Properties.LanguagePack]
+	if pack == nil {
+		return false
+	}
+
+	tokenizer, err := tokenizerByName(data.Properties.Tokenizer)
+	if err != nil {
+		return false
+	}
+
+	target := pack.stem(strings.ToLower(word))
+	for _, candidate := range languageWords(data.Value, tokenizer) {
+		if pack.stem(candidate) == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rivo/uniseg"
+)
+
+// Units the length filters can count in, chosen with ?length_unit=
+const (
+	lengthUnitRune     = "rune"
+	lengthUnitByte     = "byte"
+	lengthUnitGrapheme = "grapheme"
+)
+
+// lengthBounds compare a length with the bound of min_length or max_length
+var lengthBounds = map[string]func(length, bound int) bool{
+	"min_length": func(length, bound int) bool { return length >= bound },
+	"max_length": func(length, bound int) bool { return length <= bound },
+}
+
+// analyzeLength counts a value in runes, bytes and user-perceived
+// characters (extended grapheme clusters). length is the rune count.
+func analyzeLength(_ context.Context, value string, p *StringProperties, _ *analysisProfile) {
+	p.RuneLength = utf8.RuneCountInString(value)
+	p.ByteLength = len(value)
+	p.GraphemeLength = uniseg.GraphemeClusterCount(value)
+	p.Length = p.RuneLength
+}
+
+// lengthIn returns a string's length in the given unit
+func lengthIn(p *StringProperties, unit string) int {
+	switch unit {
+	case lengthUnitByte:
+		return p.ByteLength
+	case lengthUnitGrapheme:
+		return p.GraphemeLength
+	}
+	return p.Length
+}
+
+// parseLengthUnit validates ?length_unit=
+func parseLengthUnit(raw string) (interface{}, error) {
+	switch raw {
+	case lengthUnitRune, lengthUnitByte, lengthUnitGrapheme:
+		return raw, nil
+	}
+	return nil, fiber.NewError(fiber.StatusBadRequest, "length_unit must be rune, byte or grapheme")
+}
+
+// lengthFilter builds min_length or max_length counting in unit. Only rune
+// lengths are indexed; other units are scanned and estimated from the rune
+// lengths, which bound byte lengths from below and grapheme lengths from
+// above.
+func lengthFilter(name, unit string) filterSpec {
+	keep := lengthBounds[name]
+	spec := filterSpec{
+		Name:        name,
+		Type:        "integer",
+		Operator:    "gte",
+		Description: "Minimum length, in runes unless length_unit is given",
+		parse:       parseNonNegative(name),
+		match: func(data *StringData, val interface{}) bool {
+			return keep(lengthIn(&data.Properties, unit), val.(int))
+		},
+		estimate: func(stats *cardinalityStats, val interface{}) int {
+			return stats.countLengths(func(length int) bool { return keep(length, val.(int)) })
+		},
+	}
+	if name == "max_length" {
+		spec.Operator, spec.Description = "lte", "Maximum length, in runes unless length_unit is given"
+	}
+
+	if unit == lengthUnitRune {
+		spec.index = indexLength
+		spec.postings = func(s *storeShard, val interface{}) []map[string]bool {
+			return lengthPostings(s, func(length int) bool { return keep(length, val.(int)) })
+		}
+	}
+	return spec
+}
@@ -1,458 +1,722 @@
-package main
-
-import (
-	"crypto/sha256"
-	"encoding/hex"
-	"fmt"
-	"log"
-	"regexp"
-	"strconv"
-	"strings"
-	"sync"
-	"time"
-
-	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/logger"
-	"github.com/gofiber/fiber/v2/middleware/recover"
-)
-
-// StringData represents the stored string and its properties
-type StringData struct {
-	ID         string           `json:"id"`
-	Value      string           `json:"value"`
-	Properties StringProperties `json:"properties"`
-	CreatedAt  time.Time        `json:"created_at"`
-}
-
-// StringProperties contains analyzed properties of the string
-type StringProperties struct {
-	Length                int            `json:"length"`
-	IsPalindrome          bool           `json:"is_palindrome"`
-	UniqueCharacters      int            `json:"unique_characters"`
-	WordCount             int            `json:"word_count"`
-	SHA256Hash            string         `json:"sha256_hash"`
-	CharacterFrequencyMap map[string]int `json:"character_frequency_map"`
-}
-
-// CreateStringRequest represents the request body for creating a string
-type CreateStringRequest struct {
-	Value string `json:"value"`
-}
-
-// GetAllStringsResponse represents the response for getting all strings
-type GetAllStringsResponse struct {
-	Data           []StringData           `json:"data"`
-	Count          int                    `json:"count"`
-	FiltersApplied map[string]interface{} `json:"filters_applied"`
-}
-
-// NaturalLanguageResponse represents the response for natural language queries
-type NaturalLanguageResponse struct {
-	Data             []StringData     `json:"data"`
-	Count            int              `json:"count"`
-	InterpretedQuery InterpretedQuery `json:"interpreted_query"`
-}
-
-// InterpretedQuery contains the parsed natural language query
-type InterpretedQuery struct {
-	Original      string                 `json:"original"`
-	ParsedFilters map[string]interface{} `json:"parsed_filters"`
-}
-
-// In-memory storage
-var (
-	storage = make(map[string]*StringData)
-	mu      sync.RWMutex
-)
-
-func main() {
-	app := fiber.New(fiber.Config{
-		ErrorHandler: customErrorHandler,
-	})
-
-	// Middleware
-	app.Use(logger.New())
-	app.Use(recover.New())
-
-	// Routes - Order matters! Specific routes before parameterized routes
-	app.Post("/strings", createString)
-	app.Get("/strings/filter-by-natural-language", filterByNaturalLanguage)
-	app.Get("/strings", getAllStrings)
-	app.Get("/strings/:string_value", getSpecificString)
-	app.Delete("/strings/:string_value", deleteString)
-
-	log.Fatal(app.Listen(":8000"))
-}
-
-// customErrorHandler handles errors consistently
-func customErrorHandler(c *fiber.Ctx, err error) error {
-	code := fiber.StatusInternalServerError
-	message := "Internal Server Error"
-
-	if e, ok := err.(*fiber.Error); ok {
-		code = e.Code
-		message = e.Message
-	}
-
-	return c.Status(code).JSON(fiber.Map{
-		"error": message,
-	})
-}
-
-// analyzeString computes all properties of a string
-func analyzeString(value string) StringProperties {
-	hash := computeSHA256(value)
-
-	return StringProperties{
-		Length:                len(value),
-		IsPalindrome:          isPalindrome(value),
-		UniqueCharacters:      countUniqueCharacters(value),
-		WordCount:             countWords(value),
-		SHA256Hash:            hash,
-		CharacterFrequencyMap: getCharacterFrequency(value),
-	}
-}
-
-// computeSHA256 generates SHA-256 hash of a string
-func computeSHA256(s string) string {
-	hasher := sha256.New()
-	hasher.Write([]byte(s))
-	return hex.EncodeToString(hasher.Sum(nil))
-}
-
-// isPalindrome checks if string is palindrome (case-insensitive)
-func isPalindrome(s string) bool {
-	cleaned := strings.ToLower(regexp.MustCompile(`[^a-zA-Z0-9]`).ReplaceAllString(s, ""))
-	length := len(cleaned)
-
-	for i := 0; i < length/2; i++ {
-		if cleaned[i] != cleaned[length-1-i] {
-			return false
-		}
-	}
-
-	return true
-}
-
-// countUniqueCharacters counts distinct characters
-func countUniqueCharacters(s string) int {
-	charSet := make(map[rune]bool)
-	for _, char := range s {
-		charSet[char] = true
-	}
-	return len(charSet)
-}
-
-// countWords counts words separated by whitespace
-func countWords(s string) int {
-	s = strings.TrimSpace(s)
-	if s == "" {
-		return 0
-	}
-	return len(strings.Fields(s))
-}
-
-// getCharacterFrequency creates character frequency map
-func getCharacterFrequency(s string) map[string]int {
-	frequency := make(map[string]int)
-	for _, char := range s {
-		frequency[string(char)]++
-	}
-	return frequency
-}
-
-// createString handles POST /strings
-func createString(c *fiber.Ctx) error {
-	var req CreateStringRequest
-
-	if err := c.BodyParser(&req); err != nil {
-		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
-	}
-
-	if req.Value == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "Missing 'value' field")
-	}
-
-	// Check if string already exists
-	hash := computeSHA256(req.Value)
-
-	mu.RLock()
-	if _, exists := storage[req.Value]; exists {
-		mu.RUnlock()
-		return fiber.NewError(fiber.StatusConflict, "String already exists in the system")
-	}
-	mu.RUnlock()
-
-	// Analyze string
-	properties := analyzeString(req.Value)
-
-	// Create string data
-	stringData := &StringData{
-		ID:         hash,
-		Value:      req.Value,
-		Properties: properties,
-		CreatedAt:  time.Now().UTC(),
-	}
-
-	// Store
-	mu.Lock()
-	storage[req.Value] = stringData
-	mu.Unlock()
-
-	return c.Status(fiber.StatusCreated).JSON(stringData)
-}
-
-// getSpecificString handles GET /strings/:string_value
-func getSpecificString(c *fiber.Ctx) error {
-	stringValue := c.Params("string_value")
-
-	mu.RLock()
-	data, exists := storage[stringValue]
-	mu.RUnlock()
-
-	if !exists {
-		// return fiber.NewError(fiber.StatusNotFound, "String does not exist in the system")
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"status": 404,
-			"error":  "String does not exist in the system",
-		})
-	}
-
-	return c.JSON(data)
-}
-
-// getAllStrings handles GET /strings with filtering
-func getAllStrings(c *fiber.Ctx) error {
-	mu.RLock()
-	defer mu.RUnlock()
-
-	var filtered []StringData
-	filtersApplied := make(map[string]interface{})
-
-	// Parse query parameters
-	isPalindromeStr := c.Query("is_palindrome")
-	minLengthStr := c.Query("min_length")
-	maxLengthStr := c.Query("max_length")
-	wordCountStr := c.Query("word_count")
-	containsChar := c.Query("contains_character")
-
-	// Convert and validate parameters
-	var isPalindrome *bool
-	if isPalindromeStr != "" {
-		val, err := strconv.ParseBool(isPalindromeStr)
-		if err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid value for is_palindrome")
-		}
-		isPalindrome = &val
-		filtersApplied["is_palindrome"] = val
-	}
-
-	var minLength *int
-	if minLengthStr != "" {
-		val, err := strconv.Atoi(minLengthStr)
-		if err != nil || val < 0 {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid value for min_length")
-		}
-		minLength = &val
-		filtersApplied["min_length"] = val
-	}
-
-	var maxLength *int
-	if maxLengthStr != "" {
-		val, err := strconv.Atoi(maxLengthStr)
-		if err != nil || val < 0 {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid value for max_length")
-		}
-		maxLength = &val
-		filtersApplied["max_length"] = val
-	}
-
-	var wordCount *int
-	if wordCountStr != "" {
-		val, err := strconv.Atoi(wordCountStr)
-		if err != nil || val < 0 {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid value for word_count")
-		}
-		wordCount = &val
-		filtersApplied["word_count"] = val
-	}
-
-	if containsChar != "" {
-		if len(containsChar) != 1 {
-			return fiber.NewError(fiber.StatusBadRequest, "contains_character must be a single character")
-		}
-		filtersApplied["contains_character"] = containsChar
-	}
-
-	// Filter strings
-	for _, data := range storage {
-		if matchesFilters(data, isPalindrome, minLength, maxLength, wordCount, containsChar) {
-			filtered = append(filtered, *data)
-		}
-	}
-
-	return c.JSON(GetAllStringsResponse{
-		Data:           filtered,
-		Count:          len(filtered),
-		FiltersApplied: filtersApplied,
-	})
-}
-
-// matchesFilters checks if a string matches all filters
-func matchesFilters(data *StringData, isPalindrome *bool, minLength, maxLength, wordCount *int, containsChar string) bool {
-	if isPalindrome != nil && data.Properties.IsPalindrome != *isPalindrome {
-		return false
-	}
-
-	if minLength != nil && data.Properties.Length < *minLength {
-		return false
-	}
-
-	if maxLength != nil && data.Properties.Length > *maxLength {
-		return false
-	}
-
-	if wordCount != nil && data.Properties.WordCount != *wordCount {
-		return false
-	}
-
-	if containsChar != "" && !strings.Contains(strings.ToLower(data.Value), strings.ToLower(containsChar)) {
-		return false
-	}
-
-	return true
-}
-
-// filterByNaturalLanguage handles GET /strings/filter-by-natural-language
-func filterByNaturalLanguage(c *fiber.Ctx) error {
-	query := c.Query("query")
-
-	if query == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "Missing 'query' parameter")
-	}
-
-	// Parse natural language query
-	filters, err := parseNaturalLanguageQuery(query)
-	if err != nil {
-		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Unable to parse query: %s", err.Error()))
-	}
-
-	// Apply filters
-	mu.RLock()
-	defer mu.RUnlock()
-
-	var filtered []StringData
-	for _, data := range storage {
-		if matchesNaturalFilters(data, filters) {
-			filtered = append(filtered, *data)
-		}
-	}
-
-	return c.JSON(NaturalLanguageResponse{
-		Data:  filtered,
-		Count: len(filtered),
-		InterpretedQuery: InterpretedQuery{
-			Original:      query,
-			ParsedFilters: filters,
-		},
-	})
-}
-
-// parseNaturalLanguageQuery converts natural language to filters
-func parseNaturalLanguageQuery(query string) (map[string]interface{}, error) {
-	filters := make(map[string]interface{})
-	lowerQuery := strings.ToLower(query)
-
-	// Check for palindrome
-	if strings.Contains(lowerQuery, "palindrom") {
-		filters["is_palindrome"] = true
-	}
-
-	// Check for word count
-	if strings.Contains(lowerQuery, "single word") {
-		filters["word_count"] = 1
-	} else if strings.Contains(lowerQuery, "two word") {
-		filters["word_count"] = 2
-	}
-
-	// Check for length constraints
-	longerThanRegex := regexp.MustCompile(`longer than (\d+)`)
-	if matches := longerThanRegex.FindStringSubmatch(lowerQuery); len(matches) > 1 {
-		length, _ := strconv.Atoi(matches[1])
-		filters["min_length"] = length + 1
-	}
-
-	shorterThanRegex := regexp.MustCompile(`shorter than (\d+)`)
-	if matches := shorterThanRegex.FindStringSubmatch(lowerQuery); len(matches) > 1 {
-		length, _ := strconv.Atoi(matches[1])
-		filters["max_length"] = length - 1
-	}
-
-	// Check for character containment
-	containsRegex := regexp.MustCompile(`contain(?:s|ing)? (?:the )?(?:letter|character) ([a-z])`)
-	if matches := containsRegex.FindStringSubmatch(lowerQuery); len(matches) > 1 {
-		filters["contains_character"] = matches[1]
-	}
-
-	// Check for first vowel
-	if strings.Contains(lowerQuery, "first vowel") {
-		filters["contains_character"] = "a"
-	}
-
-	if len(filters) == 0 {
-		return nil, fmt.Errorf("could not parse any filters from query")
-	}
-
-	return filters, nil
-}
-
-// matchesNaturalFilters checks if data matches natural language filters
-func matchesNaturalFilters(data *StringData, filters map[string]interface{}) bool {
-	if isPalindrome, ok := filters["is_palindrome"].(bool); ok {
-		if data.Properties.IsPalindrome != isPalindrome {
-			return false
-		}
-	}
-
-	if wordCount, ok := filters["word_count"].(int); ok {
-		if data.Properties.WordCount != wordCount {
-			return false
-		}
-	}
-
-	if minLength, ok := filters["min_length"].(int); ok {
-		if data.Properties.Length < minLength {
-			return false
-		}
-	}
-
-	if maxLength, ok := filters["max_length"].(int); ok {
-		if data.Properties.Length > maxLength {
-			return false
-		}
-	}
-
-	if containsChar, ok := filters["contains_character"].(string); ok {
-		if !strings.Contains(strings.ToLower(data.Value), strings.ToLower(containsChar)) {
-			return false
-		}
-	}
-
-	return true
-}
-
-// deleteString handles DELETE /strings/:string_value
-func deleteString(c *fiber.Ctx) error {
-	stringValue := c.Params("string_value")
-
-	mu.Lock()
-	defer mu.Unlock()
-
-	if _, exists := storage[stringValue]; !exists {
-		return fiber.NewError(fiber.StatusNotFound, "String does not exist in the system")
-	}
-
-	delete(storage, stringValue)
-
-	return c.SendStatus(fiber.StatusNoContent)
-}
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// StringData represents the stored string and its properties
+type StringData struct {
+	ID               string                 `json:"id"`
+	HashAlgorithm    string                 `json:"hash_algorithm"`
+	Value            string                 `json:"value"`
+	Encoding         string                 `json:"encoding,omitempty"`
+	Properties       StringProperties       `json:"properties"`
+	CreatedAt        time.Time              `json:"created_at"`
+	UpdatedAt        time.Time              `json:"updated_at"`
+	ExpiresAt        *time.Time             `json:"expires_at,omitempty"`
+	DeletedAt        *time.Time             `json:"deleted_at,omitempty"`
+	Collection       string                 `json:"collection,omitempty"`
+	Tags             []string               `json:"tags,omitempty"`
+	Aliases          []string               `json:"aliases,omitempty"`
+	Metadata         map[string]interface{} `json:"metadata,omitempty"`
+	EncryptionKeyID  string                 `json:"encryption_key_id,omitempty"`
+	ClientSuppliedID bool                   `json:"client_supplied_id,omitempty"`
+	Pinned           bool                   `json:"pinned,omitempty"`
+	Usage            *StringUsage           `json:"usage,omitempty"`
+}
+
+// StringProperties contains analyzed properties of the string
+type StringProperties struct {
+	Length                int                `json:"length"`
+	ByteLength            int                `json:"byte_length"`
+	RuneLength            int                `json:"rune_length"`
+	GraphemeLength        int                `json:"grapheme_length"`
+	IsPalindrome          bool               `json:"is_palindrome"`
+	PalindromeMode        string             `json:"palindrome_mode,omitempty"`
+	UniqueCharacters      int                `json:"unique_characters"`
+	WordCount             int                `json:"word_count"`
+	LongestWord           string             `json:"longest_word,omitempty"`
+	LongestWordLength     int                `json:"longest_word_length"`
+	ShortestWord          string             `json:"shortest_word,omitempty"`
+	ShortestWordLength    int                `json:"shortest_word_length"`
+	AverageWordLength     float64            `json:"average_word_length"`
+	SentenceCount         int                `json:"sentence_count"`
+	LineCount             int                `json:"line_count"`
+	ReadingEase           *float64           `json:"reading_ease,omitempty"`
+	GradeLevel            *float64           `json:"grade_level,omitempty"`
+	VowelCount            int                `json:"vowel_count"`
+	ConsonantCount        int                `json:"consonant_count"`
+	UppercaseCount        int                `json:"uppercase_count"`
+	LowercaseCount        int                `json:"lowercase_count"`
+	DigitCount            int                `json:"digit_count"`
+	Scripts               []string           `json:"scripts,omitempty"`
+	MixedScript           bool               `json:"mixed_script"`
+	IsRTL                 bool               `json:"is_rtl"`
+	SHA256Hash            string             `json:"sha256_hash,omitempty"`
+	CharacterFrequencyMap map[string]int     `json:"character_frequency_map"`
+	AnagramSignature      string             `json:"anagram_signature,omitempty"`
+	LanguagePack          string             `json:"language_pack"`
+	DetectedLanguage      string             `json:"detected_language,omitempty"`
+	LanguageConfidence    float64            `json:"language_confidence,omitempty"`
+	Sentiment             *Sentiment         `json:"sentiment,omitempty"`
+	StopwordCount         int                `json:"stopword_count"`
+	SyllableCount         int                `json:"syllable_count"`
+	Tokenizer             string             `json:"tokenizer"`
+	Morse                 string             `json:"morse,omitempty"`
+	NATOPhonetic          string             `json:"nato_phonetic,omitempty"`
+	IsROT13               bool               `json:"is_rot13"`
+	ROT13Decoded          string             `json:"rot13_decoded,omitempty"`
+	Entities              Entities           `json:"entities"`
+	URL                   *URLComponents     `json:"url,omitempty"`
+	Email                 *EmailComponents   `json:"email,omitempty"`
+	Bytes                 *ByteAnalysis      `json:"bytes,omitempty"`
+	Derived               map[string]float64 `json:"derived,omitempty"`
+}
+
+// CreateStringRequest represents the request body for creating a string
+type CreateStringRequest struct {
+	ID              string                 `json:"id" form:"id"`
+	Value           string                 `json:"value" form:"value"`
+	ValueBase64     string                 `json:"value_base64" form:"value_base64"`
+	ExpectedSHA256  string                 `json:"expected_sha256" form:"expected_sha256"`
+	TTLSeconds      int                    `json:"ttl_seconds" form:"ttl_seconds"`
+	Tags            []string               `json:"tags" form:"tags"`
+	Metadata        map[string]interface{} `json:"metadata" form:"-"`
+	EncryptionKeyID string                 `json:"encryption_key_id" form:"encryption_key_id"`
+}
+
+// GetAllStringsResponse represents the response for getting all strings
+type GetAllStringsResponse struct {
+	Data           []StringData           `json:"data"`
+	Count          int                    `json:"count"`
+	Total          int                    `json:"total"`
+	Limit          int                    `json:"limit"`
+	Offset         int                    `json:"offset"`
+	NextCursor     string                 `json:"next_cursor,omitempty"`
+	Sample         int                    `json:"sample,omitempty"`
+	FiltersApplied map[string]interface{} `json:"filters_applied"`
+	Truncated      bool                   `json:"truncated,omitempty"`
+	Plan           []PlanStep             `json:"plan,omitempty"`
+	Trace          *QueryTrace            `json:"trace,omitempty"`
+}
+
+// CountResponse represents the response for GET /strings/count
+type CountResponse struct {
+	Count          int                    `json:"count"`
+	FiltersApplied map[string]interface{} `json:"filters_applied"`
+}
+
+// NaturalLanguageResponse represents the response for natural language queries
+type NaturalLanguageResponse struct {
+	Data             []StringData     `json:"data"`
+	Count            int              `json:"count"`
+	InterpretedQuery InterpretedQuery `json:"interpreted_query"`
+	Truncated        bool             `json:"truncated,omitempty"`
+	Plan             []PlanStep       `json:"plan,omitempty"`
+	Trace            *QueryTrace      `json:"trace,omitempty"`
+}
+
+// InterpretedQuery contains the parsed natural language query
+type InterpretedQuery struct {
+	Original      string                 `json:"original"`
+	ParsedFilters map[string]interface{} `json:"parsed_filters"`
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		os.Exit(runReplay(os.Args[2:]))
+	}
+
+	if _, ok := hashAlgorithms[config.HashAlgorithm]; !ok {
+		log.Fatalf("unsupported HASH_ALGORITHM %q", config.HashAlgorithm)
+	}
+
+	if config.EvictionPolicy != evictionLRU && config.EvictionPolicy != evictionLFU {
+		log.Fatalf("unsupported EVICTION_POLICY %q", config.EvictionPolicy)
+	}
+
+	if config.DemoMode && (config.DemoTTL < time.Second || config.DemoWriteLimit <= 0) {
+		log.Fatalf("DEMO_MODE requires DEMO_TTL of at least 1s and a positive DEMO_WRITE_LIMIT")
+	}
+
+	if err := loadLanguagePacks(config.LanguagePacksDir); err != nil {
+		log.Fatalf("loading language packs: %v", err)
+	}
+
+	if err := loadFilterPresets(config.FilterPresets); err != nil {
+		log.Fatalf("invalid FILTER_PRESETS: %v", err)
+	}
+
+	if err := loadNLPhrases(config.NLPhrases); err != nil {
+		log.Fatalf("invalid NL_PHRASES: %v", err)
+	}
+
+	if err := loadContentPolicy(config.ContentPolicy); err != nil {
+		log.Fatalf("invalid CONTENT_POLICY: %v", err)
+	}
+
+	provider, err := newSentimentProvider()
+	if err != nil {
+		log.Fatalf("invalid sentiment configuration: %v", err)
+	}
+	sentimentProvider = provider
+
+	profile, err := newAnalysisProfile(defaultAnalysisConfig())
+	if err != nil {
+		log.Fatalf("invalid analysis configuration: %v", err)
+	}
+	defaultProfile.Store(profile)
+
+	listeners, err := newListeners()
+	if err != nil {
+		log.Fatalf("invalid listener configuration: %v", err)
+	}
+
+	if err := inheritListeners(); err != nil {
+		log.Fatalf("restarting: %v", err)
+	}
+	awaitPredecessor()
+
+	var walAfter uint64
+	if config.SnapshotPath != "" {
+		restored, sequence, err := restoreSnapshot(config.SnapshotPath)
+		if err != nil {
+			log.Fatalf("restoring snapshot %s: %v", config.SnapshotPath, err)
+		}
+		log.Printf("restored %d strings from %s", restored, config.SnapshotPath)
+		walAfter = sequence
+	}
+
+	if handoff.snapshot != "" {
+		restored, _, err := restoreSnapshot(handoff.snapshot)
+		if err != nil {
+			log.Fatalf("restoring handoff snapshot %s: %v", handoff.snapshot, err)
+		}
+		log.Printf("restored %d strings handed over from the previous process", restored)
+		os.Remove(handoff.snapshot)
+	}
+
+	if config.WALPath != "" {
+		replayed, sequence, err := replayWAL(config.WALPath, walAfter)
+		if err != nil {
+			log.Fatalf("replaying WAL %s: %v", config.WALPath, err)
+		}
+		log.Printf("replayed %d WAL entries from %s", replayed, config.WALPath)
+
+		if err := openWAL(config.WALPath, sequence); err != nil {
+			log.Fatalf("opening WAL %s: %v", config.WALPath, err)
+		}
+	}
+
+	if config.QueryFeedbackPath != "" {
+		loaded, err := openQueryFeedback(config.QueryFeedbackPath)
+		if err != nil {
+			log.Fatalf("opening query feedback %s: %v", config.QueryFeedbackPath, err)
+		}
+		log.Printf("loaded %d query feedback reports from %s", loaded, config.QueryFeedbackPath)
+	}
+
+	if config.RecordRequests != "" {
+		if err := openRecording(config.RecordRequests); err != nil {
+			log.Fatalf("opening RECORD_REQUESTS %s: %v", config.RecordRequests, err)
+		}
+		log.Printf("recording mutation requests to %s", config.RecordRequests)
+	}
+
+	if config.ExpirySweepInterval > 0 {
+		go runExpirySweeper(context.Background(), config.ExpirySweepInterval)
+	}
+
+	if config.SnapshotPath != "" && config.SnapshotInterval > 0 {
+		go runSnapshots(context.Background(), config.SnapshotPath, config.SnapshotInterval)
+	}
+
+	if config.BackupS3Bucket != "" && config.BackupInterval > 0 {
+		backups, err := newRemoteBackups(config.BackupS3Endpoint, config.BackupS3Bucket, config.BackupS3Prefix, config.BackupRetention)
+		if err != nil {
+			log.Fatalf("configuring remote backups: %v", err)
+		}
+		go backups.run(context.Background(), config.BackupInterval)
+	}
+
+	if err := startBackend(context.Background()); err != nil {
+		log.Fatalf("opening %s storage backend: %v", config.StorageBackend, err)
+	}
+
+	seeded, err := loadSeedStrings(config.SeedStrings)
+	if err != nil {
+		log.Fatalf("loading SEED_STRINGS %s: %v", config.SeedStrings, err)
+	}
+	if seeded > 0 {
+		log.Printf("seeded %d pinned strings from %s", seeded, config.SeedStrings)
+	}
+
+	go warmUp(context.Background(), config.WarmupRecords)
+
+	if err := serveListeners(listeners); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// registerRoutes adds the public API to app. Order matters! Specific
+// routes before parameterized routes.
+func registerRoutes(app fiber.Router) {
+	app.Post("/strings", idempotent(createString))
+	app.Put("/strings", upsertString)
+	app.Post("/strings/batch", batchCreateStrings)
+	app.Post("/strings/bulk-get", bulkGetStrings)
+	app.Get("/strings/filter-by-natural-language", filterByNaturalLanguage)
+	app.Post("/strings/query-feedback", submitQueryFeedback)
+	app.Get("/strings/by-hash-prefix/:prefix", getByHashPrefix)
+	app.Get("/strings/preset/:name", getPresetStrings)
+	app.Get("/strings/id/:id", getStringByID)
+	app.Get("/strings/alias/:name", getStringByAlias)
+	app.Delete("/strings/id/:id", deleteStringByID)
+	app.Get("/strings/:id/export", exportStringByID)
+	app.Get("/strings/:id/raw", getRawString)
+	app.Get("/strings/:id/anagrams", getAnagrams)
+	app.Get("/strings/encoded/:b64value", getStringByEncoded)
+	app.Delete("/strings/encoded/:b64value", deleteStringByEncoded)
+	app.Get("/strings/count", countStrings)
+	app.Get("/strings/distinct", getDistinctValues)
+	app.Get("/strings", getAllStrings)
+	app.Head("/strings/:string_value", headSpecificString)
+	app.Get("/strings/:string_value", getSpecificString)
+	app.Delete("/strings/:string_value", deleteString)
+	app.Put("/strings/:id", updateString)
+	app.Patch("/strings/:id", patchString)
+	app.Put("/strings/:id/aliases", setAliases)
+	app.Post("/strings/:id/restore", restoreString)
+	app.Post("/strings/:id/share", shareString)
+	app.Get("/shared/:token", getSharedString)
+	app.Post("/transform", transformString)
+	app.Post("/compare", compareStrings)
+	app.Get("/anagram-groups", getAnagramGroups)
+	app.Get("/schema/properties", getPropertySchema)
+	app.Get("/schema/filters", getFilterSchema)
+	app.Get("/events", getEvents)
+	app.Post("/exports", createExport)
+	app.Get("/exports/:id", getExport)
+	app.Get("/exports/:id/download", downloadExport)
+	app.Get("/me/query-history", getQueryHistory)
+	app.Delete("/me/query-history", clearQueryHistory)
+	app.Post("/collections", createCollection)
+	app.Get("/collections", getCollections)
+	app.Get("/collections/:name", getCollection)
+	app.Delete("/collections/:name", deleteCollection)
+	app.Post("/collections/:name/strings", createCollectionString)
+	app.Get("/collections/:name/strings", getCollectionStrings)
+	app.Get("/collections/:name/strings/:string_value", getCollectionString)
+	app.Delete("/collections/:name/strings/:string_value", deleteCollectionString)
+	app.Post("/imports", createImport)
+	app.Get("/imports/:id", getImport)
+	app.Put("/imports/:id/chunks", uploadImportChunk)
+	app.Post("/imports/:id/commit", commitImport)
+	app.Delete("/imports/:id", deleteImport)
+}
+
+// registerAdminRoutes adds the admin API to a group already behind adminAuth
+func registerAdminRoutes(admin fiber.Router) {
+	admin.Post("/migrate-hash", migrateHashes)
+	admin.Post("/reanalyze", reanalyzeStrings)
+	admin.Post("/snapshot", takeSnapshot)
+	admin.Post("/backup", backupStrings)
+	admin.Post("/restore", restoreStrings)
+	admin.Post("/undo-last", undoLast)
+	admin.Post("/erase", eraseString)
+	admin.Post("/verify", startVerification)
+	admin.Get("/verify/:id", getVerification)
+	admin.Post("/fsck", runFsck)
+	admin.Get("/eviction", getEviction)
+	admin.Get("/bans", getBans)
+	admin.Delete("/bans/:actor", deleteBan)
+	admin.Get("/query-feedback", getQueryFeedback)
+	admin.Get("/nl-phrases", getNLPhrases)
+	admin.Put("/nl-phrases/:phrase", putNLPhrase)
+	admin.Delete("/nl-phrases/:phrase", deleteNLPhrase)
+	admin.Get("/analysis-config", getAnalysisConfig)
+	admin.Put("/analysis-config", updateAnalysisConfig)
+	admin.Get("/derived-properties", getDerivedProperties)
+	admin.Put("/derived-properties/:name", putDerivedProperty)
+	admin.Delete("/derived-properties/:name", deleteDerivedProperty)
+	if config.FaultInjection {
+		admin.Get("/faults", getFaults)
+		admin.Put("/faults", putFaults)
+		admin.Delete("/faults", deleteFaults)
+	}
+}
+
+// customErrorHandler handles errors consistently
+func customErrorHandler(c *fiber.Ctx, err error) error {
+	code := fiber.StatusInternalServerError
+	message := "Internal Server Error"
+
+	if e, ok := err.(*fiber.Error); ok {
+		code = e.Code
+		message = e.Message
+	}
+
+	return c.Status(code).JSON(fiber.Map{
+		"error": message,
+	})
+}
+
+// computeSHA256 generates SHA-256 hash of a string
+func computeSHA256(s string) string {
+	hasher := sha256.New()
+	hasher.Write([]byte(s))
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// isPalindrome checks if string is palindrome, comparing the letters and
+// digits of any script rune by rune under Unicode case folding (so final ς
+// matches Σ), e.g. "А роза упала на лапу Азора"
+func isPalindrome(s string) bool {
+	var cleaned []rune
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			cleaned = append(cleaned, foldRune(r))
+		}
+	}
+	return runesPalindrome(cleaned)
+}
+
+// foldRune maps every rune of a case folding orbit (e.g. Σ, σ and ς) to the
+// same rune
+func foldRune(r rune) rune {
+	folded := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < folded {
+			folded = f
+		}
+	}
+	return folded
+}
+
+// countUniqueCharacters counts distinct characters
+func countUniqueCharacters(s string) int {
+	charSet := make(map[rune]bool)
+	for _, char := range s {
+		charSet[char] = true
+	}
+	return len(charSet)
+}
+
+// countWords counts words produced by the tokenizer
+func countWords(s string, tokenizer Tokenizer) int {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0
+	}
+	return len(tokenizer.Tokenize(s))
+}
+
+// getCharacterFrequency creates character frequency map
+func getCharacterFrequency(s string) map[string]int {
+	frequency := make(map[string]int)
+	for _, char := range s {
+		frequency[string(char)]++
+	}
+	return frequency
+}
+
+// createString handles POST /strings
+func createString(c *fiber.Ctx) error {
+	var req CreateStringRequest
+
+	if err := parseCreateBody(c, &req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	opts, err := parseCreateOptions(c)
+	if err != nil {
+		return err
+	}
+
+	result, err := createValue(c.UserContext(), req, opts)
+	if e, ok := err.(*createError); ok {
+		return c.Status(e.status).JSON(e.body)
+	}
+	if err != nil {
+		return err
+	}
+
+	if result.outcome == outcomeSkipped {
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+
+	response := CreateStringResponse{
+		StringData:       result.data,
+		DuplicateMatches: result.duplicates,
+	}
+	if result.outcome == outcomeCreated && c.QueryBool("include_similar") {
+		response.Similar = findSimilar(result.data)
+	}
+
+	return c.Status(result.status()).JSON(response)
+}
+
+// getSpecificString handles GET /strings/:string_value
+func getSpecificString(c *fiber.Ctx) error {
+	data, err := findString(c.UserContext(), c.Params("string_value"))
+	if err != nil {
+		return err
+	}
+
+	if data == nil {
+		// return fiber.NewError(fiber.StatusNotFound, "String does not exist in the system")
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"status": 404,
+			"error":  "String does not exist in the system",
+		})
+	}
+
+	return sendRecord(c, data)
+}
+
+// headSpecificString handles HEAD /strings/:string_value, answering 200 or
+// 404 without a body so clients can check for a value cheaply
+func headSpecificString(c *fiber.Ctx) error {
+	data, err := findString(c.UserContext(), c.Params("string_value"))
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	c.Set(fiber.HeaderETag, recordETag(data))
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// findString returns the live record of a value, falling back to the
+// backend on a cache miss, or nil when it is not stored
+func findString(ctx context.Context, value string) (*StringData, error) {
+	if data, exists := lookup(value); exists && !data.expired(time.Now()) {
+		return data, nil
+	}
+	return loadCold(ctx, value)
+}
+
+// getAllStrings handles GET /strings with filtering
+func getAllStrings(c *fiber.Ctx) error {
+	filtersApplied, err := parseQueryFilters(c)
+	if err != nil {
+		return err
+	}
+
+	// Pollers may send their last sync time as If-Modified-Since instead
+	conditional := false
+	if header := c.Get(fiber.HeaderIfModifiedSince); header != "" && filtersApplied["modified_since"] == nil {
+		since, err := http.ParseTime(header)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid If-Modified-Since header")
+		}
+		filtersApplied["modified_since"] = since.UTC()
+		conditional = true
+	}
+
+	return listStrings(c, filtersApplied, conditional)
+}
+
+// listStrings responds with the page of stored strings matching filters
+// selected by ?limit= and ?offset=, or a random ?sample= of them, in ?sort=
+// order and then oldest first.
+// A conditional listing answers 304 when nothing matches.
+func listStrings(c *fiber.Ctx, filtersApplied map[string]interface{}, conditional bool) error {
+	pg, err := parsePage(c)
+	if err != nil {
+		return err
+	}
+
+	debug := c.QueryBool("debug")
+	generation := storeGeneration.Load()
+	plan, result, trace, err := runQuery(c.UserContext(), filtersApplied, queryOptions{
+		limit:          pg.limit,
+		offset:         pg.offset,
+		after:          pg.after,
+		order:          pg.order,
+		sample:         pg.sample,
+		debug:          debug,
+		includeDeleted: c.QueryBool("include_deleted"),
+	})
+	if err != nil {
+		return contextError(err)
+	}
+	filtered, total, truncated := result.data, result.total, result.truncated
+	if conditional && total == 0 {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	// Traces and samples differ on every run and usage changes without
+	// changing the store, so none of those listings is cached
+	usage := includeUsage(c)
+	if usage {
+		for i := range filtered {
+			attachUsage(&filtered[i])
+		}
+	} else if !debug && pg.sample == 0 {
+		etag := listETag(generation, c.OriginalURL(), total, filtered)
+		c.Set(fiber.HeaderETag, etag)
+		if noneMatch(c, etag) {
+			return c.SendStatus(fiber.StatusNotModified)
+		}
+	}
+
+	response := GetAllStringsResponse{
+		Data:           filtered,
+		Count:          len(filtered),
+		Total:          total,
+		Limit:          pg.limit,
+		Offset:         pg.offset,
+		Sample:         pg.sample,
+		FiltersApplied: filtersApplied,
+		Truncated:      truncated,
+	}
+	// Cursors follow created_at and ID, so sorted listings page with offset
+	if truncated && len(pg.order) == 0 {
+		response.NextCursor = encodeCursor(&filtered[len(filtered)-1])
+	}
+	if debug {
+		response.Plan, response.Trace = plan.steps, trace
+	}
+	recordQuery(c, queryKindStructured, string(c.Request().URI().QueryString()), filtersApplied, len(filtered), truncated)
+
+	return c.JSON(response)
+}
+
+// countStrings handles GET /strings/count, counting the strings matching
+// the same filters as GET /strings without returning them
+func countStrings(c *fiber.Ctx) error {
+	filtersApplied, err := parseQueryFilters(c)
+	if err != nil {
+		return err
+	}
+
+	plan := planFilters(filtersApplied)
+	plan.includeDeleted = c.QueryBool("include_deleted")
+	count, err := plan.count(c.UserContext())
+	if err != nil {
+		return contextError(err)
+	}
+
+	return c.JSON(CountResponse{
+		Count:          count,
+		FiltersApplied: filtersApplied,
+	})
+}
+
+// filterByNaturalLanguage handles GET /strings/filter-by-natural-language
+func filterByNaturalLanguage(c *fiber.Ctx) error {
+	query := c.Query("query")
+
+	if query == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Missing 'query' parameter")
+	}
+
+	// Parse natural language query
+	filters, err := parseNaturalLanguageQuery(query)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Unable to parse query: %s", err.Error()))
+	}
+
+	// Apply filters
+	debug := c.QueryBool("debug")
+	plan, result, trace, err := runQuery(c.UserContext(), filters, queryOptions{
+		limit:          config.MaxResults,
+		debug:          debug,
+		includeDeleted: c.QueryBool("include_deleted"),
+	})
+	if err != nil {
+		return contextError(err)
+	}
+	filtered, truncated := result.data, result.truncated
+
+	response := NaturalLanguageResponse{
+		Data:  filtered,
+		Count: len(filtered),
+		InterpretedQuery: InterpretedQuery{
+			Original:      query,
+			ParsedFilters: filters,
+		},
+		Truncated: truncated,
+	}
+	if debug {
+		response.Plan, response.Trace = plan.steps, trace
+	}
+	recordQuery(c, queryKindNaturalLanguage, query, filters, len(filtered), truncated)
+
+	return c.JSON(response)
+}
+
+// deleteString handles DELETE /strings/:string_value, soft-deleting the
+// string so it can be restored with POST /strings/:id/restore, or with
+// ?permanent=true purging it for good, deleted or not. It answers 204 or,
+// with ?return=representation, 200 and the deleted record.
+func deleteString(c *fiber.Ctx) error {
+	return deleteValue(c, c.Params("string_value"))
+}
+
+// deleteValue deletes a stored string and publishes the deletion, answering
+// as described on deleteString
+func deleteValue(c *fiber.Ctx, stringValue string) error {
+	permanent := c.QueryBool("permanent")
+	if err := ensureCached(c.UserContext(), stringValue); err != nil {
+		return err
+	}
+
+	shard := shardFor(stringValue)
+	shard.Lock()
+	defer shard.Unlock()
+
+	existing, exists := shard.records[stringValue]
+	if !exists && permanent {
+		existing, exists = shard.deleted[stringValue]
+	}
+	if !exists {
+		return fiber.NewError(fiber.StatusNotFound, "String does not exist in the system")
+	}
+	if existing.Pinned {
+		return errPinned
+	}
+	if err := checkIfMatch(c, existing); err != nil {
+		return err
+	}
+
+	event := Event{
+		Type:   eventStringDeleted,
+		ID:     existing.ID,
+		Value:  existing.Value,
+		Actor:  requestActor(c),
+		before: existing,
+	}
+	if permanent {
+		shard.removeLocked(stringValue)
+		event.Type = eventStringPurged
+	} else {
+		now := time.Now().UTC()
+		trashed := *existing
+		trashed.DeletedAt, trashed.UpdatedAt = &now, now
+		shard.putLocked(&trashed)
+		event.after, existing = &trashed, &trashed
+	}
+	publishEvent(event)
+
+	// Clients building undo flows can ask for the removed record back
+	if c.Query("return") == "representation" {
+		return c.JSON(existing)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
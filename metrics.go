@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// requestKey groups answered requests for http_requests_total
+type requestKey struct {
+	listener string
+	method   string
+	status   int
+}
+
+// requestCounts counts the requests answered since startup
+var requestCounts = struct {
+	sync.Mutex
+	counts map[requestKey]uint64
+}{counts: make(map[requestKey]uint64)}
+
+// countRequests counts the requests a listener answers by method and
+// status code, including errors and recovered panics
+func countRequests(listener string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if e, ok := err.(*fiber.Error); ok {
+			status = e.Code
+		} else if err != nil {
+			status = fiber.StatusInternalServerError
+		}
+
+		// Fiber reuses the method's bytes once the request is done
+		key := requestKey{listener, strings.Clone(c.Method()), status}
+		requestCounts.Lock()
+		requestCounts.counts[key]++
+		requestCounts.Unlock()
+		return err
+	}
+}
+
+// getMetrics handles GET /metrics in the Prometheus text format
+func getMetrics(c *fiber.Ctx) error {
+	var b strings.Builder
+	gauge := func(name, help string, val int64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", name, help, name, name, val)
+	}
+
+	gauge("strings_stored", "Strings held in memory.", storeCount.Load())
+	gauge("strings_stored_bytes", "Bytes of the values held in memory.", storeBytes.Load())
+	readyValue := int64(0)
+	if ready.Load() {
+		readyValue = 1
+	}
+	gauge("strings_ready", "Whether warm-up has finished.", readyValue)
+	fmt.Fprintf(&b, "# HELP strings_evicted_total Strings evicted since startup.\n# TYPE strings_evicted_total counter\nstrings_evicted_total %d\n", evicted.Load())
+
+	requestCounts.Lock()
+	keys := make([]requestKey, 0, len(requestCounts.counts))
+	for key := range requestCounts.counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.listener != b.listener {
+			return a.listener < b.listener
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+	b.WriteString("# HELP http_requests_total Requests answered, by listener, method and status code.\n# TYPE http_requests_total counter\n")
+	for _, key := range keys {
+		fmt.Fprintf(&b, "http_requests_total{listener=%q,method=%q,code=\"%d\"} %d\n", key.listener, key.method, key.status, requestCounts.counts[key])
+	}
+	requestCounts.Unlock()
+
+	c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	return c.SendString(b.String())
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// nlRule maps a natural language phrasing to filters
+type nlRule struct {
+	Phrasing string
+	Example  string
+	Filters  []string
+	pattern  *regexp.Regexp
+	apply    func(matches []string, filters map[string]interface{})
+}
+
+// nlRules is the parser's pattern registry, applied in order against the
+// lowercased query. Later rules may refine filters set by earlier ones.
+var nlRules = []nlRule{
+	{
+		Phrasing: "palindrome / palindromic",
+		Example:  "all palindromic strings",
+		Filters:  []string{"is_palindrome"},
+		pattern:  regexp.MustCompile(`palindrom`),
+		apply: func(_ []string, filters map[string]interface{}) {
+			filters["is_palindrome"] = true
+		},
+	},
+	{
+		Phrasing: "single word",
+		Example:  "single word palindromic strings",
+		Filters:  []string{"word_count"},
+		pattern:  regexp.MustCompile(`single word`),
+		apply: func(_ []string, filters map[string]interface{}) {
+			filters["word_count"] = 1
+		},
+	},
+	{
+		Phrasing: "two word",
+		Example:  "two word strings",
+		Filters:  []string{"word_count"},
+		pattern:  regexp.MustCompile(`two word`),
+		apply: func(_ []string, filters map[string]interface{}) {
+			if _, set := filters["word_count"]; !set {
+				filters["word_count"] = 2
+			}
+		},
+	},
+	{
+		Phrasing: "longer than <n>",
+		Example:  "strings longer than 10 characters",
+		Filters:  []string{"min_length"},
+		pattern:  regexp.MustCompile(`longer than (\d+)`),
+		apply: func(matches []string, filters map[string]interface{}) {
+			length, _ := strconv.Atoi(matches[1])
+			filters["min_length"] = length + 1
+		},
+	},
+	{
+		Phrasing: "shorter than <n>",
+		Example:  "strings shorter than 5 characters",
+		Filters:  []string{"max_length"},
+		pattern:  regexp.MustCompile(`shorter than (\d+)`),
+		apply: func(matches []string, filters map[string]interface{}) {
+			length, _ := strconv.Atoi(matches[1])
+			filters["max_length"] = length - 1
+		},
+	},
+	{
+		Phrasing: "containing the letter <c>",
+		Example:  "strings containing the letter z",
+		Filters:  []string{"contains_character"},
+		pattern:  regexp.MustCompile(`contain(?:s|ing)? (?:the )?(?:letter|character) ([a-z])`),
+		apply: func(matches []string, filters map[string]interface{}) {
+			filters["contains_character"] = matches[1]
+		},
+	},
+	{
+		Phrasing: "first vowel",
+		Example:  "palindromic strings that contain the first vowel",
+		Filters:  []string{"contains_character"},
+		pattern:  regexp.MustCompile(`first vowel`),
+		apply: func(_ []string, filters map[string]interface{}) {
+			filters["contains_character"] = "a"
+		},
+	},
+}
+
+// parseNaturalLanguageQuery converts natural language to filters
+func parseNaturalLanguageQuery(query string) (map[string]interface{}, error) {
+	filters := make(map[string]interface{})
+	lowerQuery := strings.ToLower(query)
+
+	// Operator-defined phrases come last so they can override built-in ones
+	for _, rules := range [][]nlRule{nlRules, loadCustomNLRules()} {
+		for _, rule := range rules {
+			if matches := rule.pattern.FindStringSubmatch(lowerQuery); matches != nil {
+				rule.apply(matches, filters)
+			}
+		}
+	}
+
+	if len(filters) == 0 {
+		return nil, fmt.Errorf("could not parse any filters from query")
+	}
+
+	return filters, nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// NLPhrase is an operator-defined phrase the natural language parser maps
+// to filters, e.g. "short" to max_length=5
+type NLPhrase struct {
+	Phrase  string                 `json:"phrase"`
+	Filters map[string]interface{} `json:"filters"`
+}
+
+// NLPhrasesResponse represents the response for GET /admin/nl-phrases
+type NLPhrasesResponse struct {
+	Phrases []NLPhrase `json:"phrases"`
+	Count   int        `json:"count"`
+}
+
+var (
+	// customNLRules holds the rules built from NL_PHRASES and the admin
+	// endpoints, replaced wholesale on every change so queries can read it
+	// without locking
+	customNLRules atomic.Pointer[[]nlRule]
+	// nlPhrases holds the phrases customNLRules is built from
+	nlPhrases = make(map[string]map[string]interface{})
+	// nlPhrasesMu serializes changes to nlPhrases
+	nlPhrasesMu sync.Mutex
+)
+
+// loadNLPhrases parses phrases written as phrase:query pairs separated by
+// semicolons, e.g. "short:max_length=5;tiny:max_length=3". Every filter is
+// validated so a typo fails at startup rather than on use.
+func loadNLPhrases(spec string) error {
+	nlPhrasesMu.Lock()
+	defer nlPhrasesMu.Unlock()
+
+	for _, entry := range strings.Split(spec, ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+
+		phrase, query, ok := strings.Cut(entry, ":")
+		if phrase = normalizePhrase(phrase); !ok || phrase == "" {
+			return fmt.Errorf("phrase %q must be written as phrase:query", entry)
+		}
+
+		filters, err := parseFilterQuery(query)
+		if err != nil {
+			return fmt.Errorf("phrase %q: %v", phrase, err)
+		}
+		if len(filters) == 0 {
+			return fmt.Errorf("phrase %q maps to no filters", phrase)
+		}
+
+		nlPhrases[phrase] = filters
+	}
+
+	rebuildNLRulesLocked()
+	return nil
+}
+
+// getNLPhrases handles GET /admin/nl-phrases
+func getNLPhrases(c *fiber.Ctx) error {
+	nlPhrasesMu.Lock()
+	defer nlPhrasesMu.Unlock()
+
+	phrases := make([]NLPhrase, 0, len(nlPhrases))
+	for _, phrase := range sortedNLPhrasesLocked() {
+		phrases = append(phrases, NLPhrase{Phrase: phrase, Filters: nlPhrases[phrase]})
+	}
+
+	return c.JSON(NLPhrasesResponse{Phrases: phrases, Count: len(phrases)})
+}
+
+// putNLPhrase handles PUT /admin/nl-phrases/:phrase, mapping a phrase to the
+// filters in the body. Custom phrases are applied after the built-in ones,
+// so they can override them.
+func putNLPhrase(c *fiber.Ctx) error {
+	var req NLPhrase
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	phrase, err := url.PathUnescape(c.Params("phrase"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid phrase")
+	}
+	if req.Phrase = normalizePhrase(phrase); req.Phrase == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Phrase must not be empty")
+	}
+	if len(req.Filters) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Missing 'filters' field")
+	}
+
+	req.Filters, err = normalizeFilters(req.Filters)
+	if err != nil {
+		return err
+	}
+
+	nlPhrasesMu.Lock()
+	nlPhrases[req.Phrase] = req.Filters
+	rebuildNLRulesLocked()
+	nlPhrasesMu.Unlock()
+
+	return c.JSON(req)
+}
+
+// deleteNLPhrase handles DELETE /admin/nl-phrases/:phrase
+func deleteNLPhrase(c *fiber.Ctx) error {
+	phrase, err := url.PathUnescape(c.Params("phrase"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid phrase")
+	}
+	phrase = normalizePhrase(phrase)
+
+	nlPhrasesMu.Lock()
+	defer nlPhrasesMu.Unlock()
+
+	if _, ok := nlPhrases[phrase]; !ok {
+		return fiber.NewError(fiber.StatusNotFound, "Phrase does not exist")
+	}
+	delete(nlPhrases, phrase)
+	rebuildNLRulesLocked()
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// loadCustomNLRules returns the rules for the current custom phrases
+func loadCustomNLRules() []nlRule {
+	if rules := customNLRules.Load(); rules != nil {
+		return *rules
+	}
+	return nil
+}
+
+// rebuildNLRulesLocked turns nlPhrases into parser rules, matching each
+// phrase as whole words. Caller must hold nlPhrasesMu.
+func rebuildNLRulesLocked() {
+	rules := make([]nlRule, 0, len(nlPhrases))
+	for _, phrase := range sortedNLPhrasesLocked() {
+		filters := nlPhrases[phrase]
+
+		names := make([]string, 0, len(filters))
+		for name := range filters {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		rules = append(rules, nlRule{
+			Phrasing: phrase,
+			Example:  phrase + " strings",
+			Filters:  names,
+			pattern:  regexp.MustCompile(`\b` + regexp.QuoteMeta(phrase) + `\b`),
+			apply: func(_ []string, applied map[string]interface{}) {
+				for name, val := range filters {
+					applied[name] = val
+				}
+			},
+		})
+	}
+	customNLRules.Store(&rules)
+}
+
+// sortedNLPhrasesLocked returns the phrases shortest first, so when phrases
+// overlap the longer, more specific one applies last and wins. Caller must
+// hold nlPhrasesMu.
+func sortedNLPhrasesLocked() []string {
+	phrases := make([]string, 0, len(nlPhrases))
+	for phrase := range nlPhrases {
+		phrases = append(phrases, phrase)
+	}
+	sort.Slice(phrases, func(i, j int) bool {
+		if len(phrases[i]) != len(phrases[j]) {
+			return len(phrases[i]) < len(phrases[j])
+		}
+		return phrases[i] < phrases[j]
+	})
+	return phrases
+}
+
+// normalizePhrase lowercases a phrase and collapses its whitespace, matching
+// how queries are compared
+func normalizePhrase(phrase string) string {
+	return strings.Join(strings.Fields(strings.ToLower(phrase)), " ")
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"cmp"
+	"encoding/base64"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// page is the slice of a listing requested with ?limit= and either
+// ?offset= or ?cursor=, in the order requested with ?sort=
+type page struct {
+	limit  int
+	offset int
+	after  *listCursor
+	order  []sortKey
+	sample int
+}
+
+// sortKey orders records by one field
+type sortKey struct {
+	name    string
+	desc    bool
+	compare func(a, b *StringData) int
+}
+
+// sortFields are the fields a listing can be sorted by
+var sortFields = map[string]func(a, b *StringData) int{
+	"length": func(a, b *StringData) int {
+		return cmp.Compare(a.Properties.Length, b.Properties.Length)
+	},
+	"word_count": func(a, b *StringData) int {
+		return cmp.Compare(a.Properties.WordCount, b.Properties.WordCount)
+	},
+	"unique_characters": func(a, b *StringData) int {
+		return cmp.Compare(a.Properties.UniqueCharacters, b.Properties.UniqueCharacters)
+	},
+	"created_at": func(a, b *StringData) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	},
+}
+
+// parsePage reads ?limit=, ?offset=, ?cursor=, ?sort= and ?sample=. The
+// limit defaults to PAGE_SIZE; it and the sample size are capped at
+// MAX_RESULTS.
+func parsePage(c *fiber.Ctx) (page, error) {
+	p := page{limit: config.PageSize}
+
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return page{}, fiber.NewError(fiber.StatusBadRequest, "limit must be a positive integer")
+		}
+		p.limit = limit
+	}
+	if config.MaxResults > 0 && (p.limit <= 0 || p.limit > config.MaxResults) {
+		p.limit = config.MaxResults
+	}
+
+	if raw := c.Query("offset"); raw != "" {
+		offset, err := strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			return page{}, fiber.NewError(fiber.StatusBadRequest, "offset must be a non-negative integer")
+		}
+		p.offset = offset
+	}
+
+	order, err := parseSort(c.Query("sort"), c.Query("order", "asc"))
+	if err != nil {
+		return page{}, err
+	}
+	p.order = order
+
+	if raw := c.Query("cursor"); raw != "" {
+		if p.offset != 0 {
+			return page{}, fiber.NewError(fiber.StatusBadRequest, "Send either offset or cursor, not both")
+		}
+		if len(p.order) > 0 {
+			return page{}, fiber.NewError(fiber.StatusBadRequest, "cursor pages follow created_at and ID; use offset with sort")
+		}
+		after, err := parseCursor(raw)
+		if err != nil {
+			return page{}, err
+		}
+		p.after = after
+	}
+
+	if raw := c.Query("sample"); raw != "" {
+		sample, err := strconv.Atoi(raw)
+		if err != nil || sample < 1 {
+			return page{}, fiber.NewError(fiber.StatusBadRequest, "sample must be a positive integer")
+		}
+		if p.offset != 0 || p.after != nil {
+			return page{}, fiber.NewError(fiber.StatusBadRequest, "sample cannot be combined with offset or cursor")
+		}
+		if config.MaxResults > 0 && sample > config.MaxResults {
+			sample = config.MaxResults
+		}
+		p.sample = sample
+	}
+
+	return p, nil
+}
+
+// parseSort reads a comma-separated list of sort fields, each ascending
+// unless prefixed with "-" or order is desc. Without fields, order applies
+// to created_at.
+func parseSort(raw, order string) ([]sortKey, error) {
+	if order != "asc" && order != "desc" {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "order must be asc or desc")
+	}
+	if raw == "" {
+		if order == "asc" {
+			return nil, nil
+		}
+		raw = "created_at"
+	}
+
+	var keys []sortKey
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		desc := order == "desc"
+		if name, found := strings.CutPrefix(field, "-"); found {
+			field, desc = name, true
+		}
+		compare, ok := sortFields[field]
+		if !ok {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "sort fields must be length, word_count, created_at or unique_characters")
+		}
+		keys = append(keys, sortKey{name: field, desc: desc, compare: compare})
+	}
+	return keys, nil
+}
+
+// sortRecords orders records by the given keys, then by creation time and
+// ID, so pages of a listing line up from one request to the next
+func sortRecords(records []*StringData, order []sortKey) {
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		for _, key := range order {
+			if c := key.compare(a, b); c != 0 {
+				return (c < 0) != key.desc
+			}
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	})
+}
+
+// pageRecords copies the records from offset on, at most limit of them
+// unless limit is zero or less
+func pageRecords(records []*StringData, limit, offset int) queryResult {
+	result := queryResult{data: []StringData{}, total: len(records)}
+	if offset >= len(records) {
+		return result
+	}
+	records = records[offset:]
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+		result.truncated = true
+	}
+
+	result.data = make([]StringData, len(records))
+	for i, data := range records {
+		result.data[i] = *data
+	}
+	return result
+}
+
+// listCursor is the position of a record in creation order, handed to
+// clients as an opaque ?cursor= to continue a listing after it. Strings
+// created after a page was read sort after its cursor, so paging by cursor
+// while writes go on never repeats a string and only skips one whose
+// create was in progress while the previous page was read.
+type listCursor struct {
+	createdAt time.Time
+	id        string
+}
+
+// encodeCursor returns the cursor continuing a listing after data
+func encodeCursor(data *StringData) string {
+	raw := strconv.FormatInt(data.CreatedAt.UnixNano(), 10) + ":" + data.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// parseCursor decodes a cursor from encodeCursor
+func parseCursor(s string) (*listCursor, error) {
+	invalid := fiber.NewError(fiber.StatusBadRequest, "Invalid cursor")
+
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, invalid
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok || id == "" {
+		return nil, invalid
+	}
+	unixNano, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, invalid
+	}
+	return &listCursor{createdAt: time.Unix(0, unixNano).UTC(), id: id}, nil
+}
+
+// precedes reports whether the cursor comes before data in creation order
+func (cur *listCursor) precedes(data *StringData) bool {
+	if !cur.createdAt.Equal(data.CreatedAt) {
+		return cur.createdAt.Before(data.CreatedAt)
+	}
+	return cur.id < data.ID
+}
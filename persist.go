@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// persistTimeout bounds each backend write and persistRetryDelay spaces
+// out retries while the backend is unavailable
+const (
+	persistTimeout    = 5 * time.Second
+	persistRetryDelay = time.Second
+)
+
+// pendingWrites coalesces writes waiting for the backend by value; a nil
+// record means the value was deleted. Writes happen outside the shard locks
+// so a slow backend never blocks readers.
+var pendingWrites = struct {
+	sync.Mutex
+	records map[string]*StringData
+	wake    chan struct{}
+}{
+	records: make(map[string]*StringData),
+	wake:    make(chan struct{}, 1),
+}
+
+// queuePersist schedules a record (or its deletion when data is nil) to be
+// written to the backend
+func queuePersist(value string, data *StringData) {
+	if backend == nil {
+		return
+	}
+
+	pendingWrites.Lock()
+	pendingWrites.records[value] = data
+	pendingWrites.Unlock()
+
+	select {
+	case pendingWrites.wake <- struct{}{}:
+	default:
+	}
+}
+
+// persistMu is held while a batch of queued writes goes to the backend, so
+// flushPersistence waits for one in flight
+var persistMu sync.Mutex
+
+// runPersistence writes queued records to the backend until ctx is done
+func runPersistence(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-pendingWrites.wake:
+		}
+
+		if failed := writePending(ctx); failed > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(persistRetryDelay):
+			}
+		}
+	}
+}
+
+// flushPersistence writes whatever is still queued before the process
+// exits, without retrying, and returns how many writes failed
+func flushPersistence(ctx context.Context) int {
+	if backend == nil {
+		return 0
+	}
+	return writePending(ctx)
+}
+
+// writePending writes every queued record to the backend, requeueing the
+// ones that fail, and returns how many did
+func writePending(ctx context.Context) int {
+	persistMu.Lock()
+	defer persistMu.Unlock()
+
+	pendingWrites.Lock()
+	records := pendingWrites.records
+	pendingWrites.records = make(map[string]*StringData)
+	pendingWrites.Unlock()
+
+	failed := 0
+	for value, data := range records {
+		writeCtx, cancel := context.WithTimeout(ctx, persistTimeout)
+		var err error
+		if data == nil {
+			err = backend.Delete(writeCtx, value)
+		} else {
+			err = backend.Save(writeCtx, data)
+		}
+		cancel()
+
+		if err != nil {
+			log.Printf("backend write for %.64q failed, retrying: %v", value, err)
+			requeuePersist(value, data)
+			failed++
+		}
+	}
+	return failed
+}
+
+// requeuePersist puts a failed write back unless a newer one has been queued
+func requeuePersist(value string, data *StringData) {
+	pendingWrites.Lock()
+	if _, newer := pendingWrites.records[value]; !newer {
+		pendingWrites.records[value] = data
+	}
+	pendingWrites.Unlock()
+
+	select {
+	case pendingWrites.wake <- struct{}{}:
+	default:
+	}
+}
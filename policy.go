@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Kinds of content policy rules
+const (
+	policyRegex    = "regex"
+	policyMaxLines = "max_lines"
+	policyScript   = "script"
+	policyRange    = "range"
+)
+
+// policyRule rejects values it matches
+type policyRule struct {
+	name   string
+	reject func(value string) bool
+}
+
+// contentPolicy holds the rules from CONTENT_POLICY, checked in order
+var contentPolicy []policyRule
+
+// loadContentPolicy parses CONTENT_POLICY: rules written as name:kind=arg and
+// separated by ";". Kinds are regex=<pattern> (reject values matching it),
+// max_lines=<n>, script=<Unicode script, e.g. Cyrillic> and
+// range=<U+XXXX-U+YYYY> (reject values with characters in the range).
+func loadContentPolicy(spec string) error {
+	for _, entry := range strings.Split(spec, ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+
+		name, rule, ok := strings.Cut(entry, ":")
+		kind, arg, hasArg := strings.Cut(rule, "=")
+		if !ok || name == "" || !hasArg {
+			return fmt.Errorf("rule %q must be written as name:kind=arg", entry)
+		}
+
+		reject, err := newPolicyCheck(kind, arg)
+		if err != nil {
+			return fmt.Errorf("rule %q: %v", name, err)
+		}
+		contentPolicy = append(contentPolicy, policyRule{name: name, reject: reject})
+	}
+
+	return nil
+}
+
+// newPolicyCheck builds the check of one rule
+func newPolicyCheck(kind, arg string) (func(string) bool, error) {
+	switch kind {
+	case policyRegex:
+		pattern, err := regexp.Compile(arg)
+		if err != nil {
+			return nil, err
+		}
+		return pattern.MatchString, nil
+
+	case policyMaxLines:
+		limit, err := strconv.Atoi(arg)
+		if err != nil || limit < 1 {
+			return nil, fmt.Errorf("max_lines must be a positive integer")
+		}
+		return func(value string) bool {
+			return strings.Count(value, "\n")+1 > limit
+		}, nil
+
+	case policyScript:
+		script, ok := unicode.Scripts[arg]
+		if !ok {
+			return nil, fmt.Errorf("unknown Unicode script %q", arg)
+		}
+		return func(value string) bool {
+			return strings.IndexFunc(value, func(r rune) bool { return unicode.Is(script, r) }) >= 0
+		}, nil
+
+	case policyRange:
+		low, high, err := parseRuneRange(arg)
+		if err != nil {
+			return nil, err
+		}
+		return func(value string) bool {
+			return strings.IndexFunc(value, func(r rune) bool { return r >= low && r <= high }) >= 0
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown rule kind %q; use regex, max_lines, script or range", kind)
+}
+
+// parseRuneRange parses a character range such as "U+0400-U+04FF"
+func parseRuneRange(arg string) (rune, rune, error) {
+	from, to, ok := strings.Cut(arg, "-")
+	if !ok {
+		to = from
+	}
+
+	var bounds [2]rune
+	for i, bound := range []string{from, to} {
+		hex, found := strings.CutPrefix(strings.ToUpper(strings.TrimSpace(bound)), "U+")
+		code, err := strconv.ParseUint(hex, 16, 32)
+		if !found || err != nil || code > unicode.MaxRune {
+			return 0, 0, fmt.Errorf("range must be written as U+XXXX-U+YYYY")
+		}
+		bounds[i] = rune(code)
+	}
+	if bounds[0] > bounds[1] {
+		return 0, 0, fmt.Errorf("range starts after it ends")
+	}
+	return bounds[0], bounds[1], nil
+}
+
+// checkContentPolicy rejects a value violating a CONTENT_POLICY rule with
+// 422, naming the rule
+func checkContentPolicy(value string) error {
+	for _, rule := range contentPolicy {
+		if rule.reject(value) {
+			return &createError{status: fiber.StatusUnprocessableEntity, body: fiber.Map{
+				"error": fmt.Sprintf("Value violates content policy rule '%s'", rule.name),
+				"rule":  rule.name,
+			}}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// filterPresets maps preset names to their parsed filters, loaded from
+// FILTER_PRESETS at startup
+var filterPresets = make(map[string]map[string]interface{})
+
+// loadFilterPresets parses presets written as name:query pairs separated
+// by semicolons, e.g. "short-palindromes:is_palindrome=true&max_length=5".
+// Every filter is validated so a typo fails at startup rather than on use.
+func loadFilterPresets(spec string) error {
+	for _, entry := range strings.Split(spec, ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+
+		name, query, ok := strings.Cut(entry, ":")
+		if !ok || name == "" {
+			return fmt.Errorf("preset %q must be written as name:query", entry)
+		}
+
+		filters, err := parseFilterQuery(query)
+		if err != nil {
+			return fmt.Errorf("preset %q: %v", name, err)
+		}
+
+		filterPresets[name] = filters
+	}
+
+	return nil
+}
+
+// parseFilterQuery parses and validates filters written as a GET /strings
+// query string, e.g. "is_palindrome=true&max_length=5"
+func parseFilterQuery(query string) (map[string]interface{}, error) {
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	filters := make(map[string]interface{})
+	for param := range params {
+		spec, ok := findFilterSpec(param)
+		if !ok {
+			return nil, fmt.Errorf("unknown filter %q", param)
+		}
+
+		val, err := spec.parse(params.Get(param))
+		if err != nil {
+			return nil, err
+		}
+		filters[param] = val
+	}
+	return filters, nil
+}
+
+// getPresetStrings handles GET /strings/preset/:name
+func getPresetStrings(c *fiber.Ctx) error {
+	filters, ok := filterPresets[c.Params("name")]
+	if !ok {
+		return fiber.NewError(fiber.StatusNotFound, "Filter preset does not exist")
+	}
+
+	return listStrings(c, filters, false)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"math"
+)
+
+// minReadabilityWords is the fewest words a value needs for readability
+// scores; the formulas mean little for a phrase or two
+const minReadabilityWords = 20
+
+// analyzeReadability scores a value with the Flesch reading ease (higher
+// is easier, 60 to 70 plain English) and Flesch-Kincaid grade level (the
+// US school grade able to follow it). Syllables are estimated with the
+// detected language pack, or the default one, but the formulas are
+// calibrated for English.
+func analyzeReadability(_ context.Context, value string, p *StringProperties, profile *analysisProfile) {
+	words := languageWords(value, profile.tokenizer)
+	sentences := countSentences(value)
+	pack := detectLanguagePack(words)
+	if len(words) < minReadabilityWords || sentences == 0 || pack == nil {
+		return
+	}
+
+	syllables := 0
+	for _, word := range words {
+		syllables += pack.countSyllables(word)
+	}
+
+	wordsPerSentence := float64(len(words)) / float64(sentences)
+	syllablesPerWord := float64(syllables) / float64(len(words))
+	ease := math.Round((206.835-1.015*wordsPerSentence-84.6*syllablesPerWord)*100) / 100
+	grade := math.Round((0.39*wordsPerSentence+11.8*syllablesPerWord-15.59)*100) / 100
+	p.ReadingEase, p.GradeLevel = &ease, &grade
+}
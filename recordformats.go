@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// recordFormats maps each ?format= of GET /strings/:id/export to its
+// content type
+var recordFormats = map[string]string{
+	"json": fiber.MIMEApplicationJSON,
+	"yaml": "application/yaml",
+	"toml": "application/toml",
+	"txt":  fiber.MIMETextPlainCharsetUTF8,
+}
+
+// exportStringByID handles GET /strings/:id/export, rendering one record
+// as JSON, YAML or TOML with the field names of the JSON API, or with
+// ?format=txt just its value. Encrypted values are only exported as text
+// to holders of the key.
+func exportStringByID(c *fiber.Ctx) error {
+	format := c.Query("format", "json")
+	contentType, ok := recordFormats[format]
+	if !ok {
+		return fiber.NewError(fiber.StatusBadRequest, "format must be json, yaml, toml or txt")
+	}
+
+	stored, err := findByID(c, c.Params("id"))
+	if err != nil {
+		return err
+	}
+	data, err := decryptForRequest(c, stored)
+	if err != nil {
+		return err
+	}
+
+	if format == "txt" {
+		return sendRawValue(c, stored, data)
+	}
+
+	var body []byte
+	if format == "json" {
+		body, err = json.MarshalIndent(data, "", "  ")
+	} else {
+		var fields map[string]interface{}
+		if fields, err = recordFields(data); err == nil {
+			if format == "yaml" {
+				body, err = yaml.Marshal(fields)
+			} else {
+				body = encodeTOML(fields)
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	c.Set(fiber.HeaderContentType, contentType)
+	return c.Send(body)
+}
+
+// getRawString handles GET /strings/:id/raw, answering with the value of
+// the string with that ID (or SHA-256) alone, for piping into other tools
+func getRawString(c *fiber.Ctx) error {
+	stored, err := findByID(c, c.Params("id"))
+	if err != nil {
+		return err
+	}
+	data, err := decryptForRequest(c, stored)
+	if err != nil {
+		return err
+	}
+
+	return sendRawValue(c, stored, data)
+}
+
+// sendRawValue answers with a record's value alone, typed by
+// rawContentType. data is stored decrypted with the request's key, if any;
+// ciphertext is never sent as the value.
+func sendRawValue(c *fiber.Ctx, stored, data *StringData) error {
+	if data == stored && data.Encoding == encodingEncrypted {
+		return fiber.NewError(fiber.StatusForbidden, "The value of an encrypted string needs its key in X-Encryption-Key")
+	}
+
+	raw := rawValue(data)
+	c.Set(fiber.HeaderContentType, rawContentType(raw, data.Encoding == encodingBase64))
+	return c.SendString(raw)
+}
+
+// rawContentType guesses the content type of a value: sniffed from the
+// bytes for binary values, JSON or CSV for text that parses as such, plain
+// UTF-8 text otherwise
+func rawContentType(raw string, binary bool) string {
+	if binary {
+		return http.DetectContentType([]byte(raw))
+	}
+
+	trimmed := strings.TrimSpace(raw)
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		if json.Valid([]byte(trimmed)) {
+			return fiber.MIMEApplicationJSONCharsetUTF8
+		}
+	}
+	if looksLikeCSV(trimmed) {
+		return "text/csv; charset=utf-8"
+	}
+	return fiber.MIMETextPlainCharsetUTF8
+}
+
+// looksLikeCSV reports whether text is at least two rows that all parse
+// as CSV with the same number of fields, more than one
+func looksLikeCSV(text string) bool {
+	if !strings.Contains(text, "\n") || !strings.Contains(text, ",") {
+		return false
+	}
+	rows, err := csv.NewReader(strings.NewReader(text)).ReadAll()
+	return err == nil && len(rows) >= 2 && len(rows[0]) > 1
+}
+
+// recordFields decodes a record's JSON form into plain maps and slices, so
+// other encoders use the same field names
+func recordFields(data *StringData) (map[string]interface{}, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]interface{}
+	err = json.Unmarshal(encoded, &fields)
+	return fields, err
+}
+
+// encodeTOML renders decoded JSON as a TOML document. Nested objects become
+// tables and arrays of objects arrays of tables; nulls, which TOML cannot
+// express, are left out.
+func encodeTOML(fields map[string]interface{}) []byte {
+	var b strings.Builder
+	writeTOMLTable(&b, "", fields)
+	return []byte(b.String())
+}
+
+// writeTOMLTable writes a table's plain keys followed by its subtables
+func writeTOMLTable(b *strings.Builder, path string, table map[string]interface{}) {
+	keys := make([]string, 0, len(table))
+	for key := range table {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var tables, tableArrays []string
+	for _, key := range keys {
+		switch val := table[key].(type) {
+		case nil:
+		case map[string]interface{}:
+			tables = append(tables, key)
+		case []interface{}:
+			if isTableArray(val) {
+				tableArrays = append(tableArrays, key)
+				continue
+			}
+			fmt.Fprintf(b, "%s = %s\n", tomlKey(key), tomlValue(val))
+		default:
+			fmt.Fprintf(b, "%s = %s\n", tomlKey(key), tomlValue(val))
+		}
+	}
+
+	for _, key := range tables {
+		name := joinTOMLPath(path, key)
+		fmt.Fprintf(b, "\n[%s]\n", name)
+		writeTOMLTable(b, name, table[key].(map[string]interface{}))
+	}
+	for _, key := range tableArrays {
+		name := joinTOMLPath(path, key)
+		for _, item := range table[key].([]interface{}) {
+			fmt.Fprintf(b, "\n[[%s]]\n", name)
+			writeTOMLTable(b, name, item.(map[string]interface{}))
+		}
+	}
+}
+
+// isTableArray reports whether an array is non-empty and holds only objects
+func isTableArray(items []interface{}) bool {
+	for _, item := range items {
+		if _, ok := item.(map[string]interface{}); !ok {
+			return false
+		}
+	}
+	return len(items) > 0
+}
+
+func joinTOMLPath(path, key string) string {
+	if path == "" {
+		return tomlKey(key)
+	}
+	return path + "." + tomlKey(key)
+}
+
+// tomlKey returns key bare when TOML allows it, quoted otherwise
+func tomlKey(key string) string {
+	if key == "" {
+		return `""`
+	}
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return tomlString(key)
+		}
+	}
+	return key
+}
+
+// tomlValue renders a value inline
+func tomlValue(val interface{}) string {
+	switch val := val.(type) {
+	case string:
+		return tomlString(val)
+	case float64:
+		// Whole numbers are written as TOML integers
+		if val == math.Trunc(val) && math.Abs(val) < 1e15 {
+			return strconv.FormatInt(int64(val), 10)
+		}
+		return strconv.FormatFloat(val, 'g', -1, 64)
+	case bool:
+		if val {
+			return "true"
+		}
+		return "false"
+	case []interface{}:
+		items := make([]string, 0, len(val))
+		for _, item := range val {
+			if item != nil {
+				items = append(items, tomlValue(item))
+			}
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for key := range val {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		items := make([]string, 0, len(keys))
+		for _, key := range keys {
+			if val[key] != nil {
+				items = append(items, tomlKey(key)+" = "+tomlValue(val[key]))
+			}
+		}
+		return "{" + strings.Join(items, ", ") + "}"
+	}
+	return tomlString(fmt.Sprint(val))
+}
+
+// tomlString quotes s as a TOML basic string
+func tomlString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"':
+			b.WriteString(`\"`)
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// recordedHeaders are the request headers kept in a recording. Credentials
+// (Authorization, request signatures) and encryption keys never are, and
+// API keys only as a fingerprint.
+var recordedHeaders = []string{fiber.HeaderContentType, fiber.HeaderIfMatch, headerIdempotencyKey, headerAPIKey}
+
+// redactedFields are the JSON body fields holding string values, recorded
+// as placeholders unless RECORD_REQUEST_VALUES is set
+var redactedFields = map[string]bool{"value": true, "value_base64": true, "reference": true}
+
+// RecordedRequest is one line of a RECORD_REQUESTS file: a create, update
+// or delete as received, with the status it was answered with. Redacted is
+// set when a body holding values could not be redacted and was dropped.
+type RecordedRequest struct {
+	At         time.Time         `json:"at"`
+	Listener   string            `json:"listener"`
+	Method     string            `json:"method"`
+	Path       string            `json:"path"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       string            `json:"body,omitempty"`
+	BodyBase64 string            `json:"body_base64,omitempty"`
+	Redacted   bool              `json:"redacted,omitempty"`
+	Status     int               `json:"status"`
+}
+
+// recording is the file mutation requests are appended to
+var recording struct {
+	sync.Mutex
+	file *os.File
+	// key is a random HMAC key for placeholders and API key fingerprints,
+	// set before any request is recorded and never written down
+	key []byte
+}
+
+// openRecording starts appending mutation requests to path
+func openRecording(path string) error {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+
+	recording.Lock()
+	recording.file, recording.key = file, key
+	recording.Unlock()
+	return nil
+}
+
+// recordRequests appends every POST, PUT, PATCH and DELETE a listener
+// answers to the RECORD_REQUESTS file, refused ones included, in the order
+// they complete. Unless RECORD_REQUEST_VALUES is set, string values in
+// bodies and paths are recorded as placeholders.
+func recordRequests(listener string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		switch c.Method() {
+		case fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch, fiber.MethodDelete:
+		default:
+			return c.Next()
+		}
+
+		// Fiber reuses the request's bytes once it is done, so copy them first
+		entry := RecordedRequest{
+			At:       time.Now().UTC(),
+			Listener: listener,
+			Method:   strings.Clone(c.Method()),
+			Path:     string(c.Request().RequestURI()),
+		}
+		for _, name := range recordedHeaders {
+			if val := c.Get(name); val != "" {
+				if entry.Headers == nil {
+					entry.Headers = make(map[string]string)
+				}
+				entry.Headers[name] = strings.Clone(val)
+			}
+		}
+		// Replayed requests still tell clients apart by the fingerprint
+		if key, sent := entry.Headers[headerAPIKey]; sent {
+			entry.Headers[headerAPIKey] = "recorded:" + recordingHMAC(key)
+		}
+		body := c.Body()
+		if !config.RecordValues && len(body) > 0 {
+			body, entry.Redacted = redactBody(body)
+		}
+		if utf8.Valid(body) {
+			entry.Body = string(body)
+		} else {
+			entry.BodyBase64 = base64.StdEncoding.EncodeToString(body)
+		}
+
+		err := c.Next()
+
+		if !config.RecordValues {
+			entry.Path = redactPath(c, entry.Path)
+		}
+
+		entry.Status = c.Response().StatusCode()
+		if e, ok := err.(*fiber.Error); ok {
+			entry.Status = e.Code
+		} else if err != nil {
+			entry.Status = fiber.StatusInternalServerError
+		}
+		writeRecording(entry)
+		return err
+	}
+}
+
+// redactedValue is recorded in place of a value: the same for the same
+// value within a recording, so replayed requests still conflict and find
+// each other. It is keyed so the value cannot be recovered by hashing
+// guesses.
+func redactedValue(value string) string {
+	return "redacted:" + recordingHMAC(value)
+}
+
+// recordingHMAC returns the hex HMAC-SHA256 of s under the recording's key
+func recordingHMAC(s string) string {
+	mac := hmac.New(sha256.New, recording.key)
+	mac.Write([]byte(s))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// redactBody replaces the string values of a JSON body with placeholders.
+// Other bodies, such as import chunks, are dropped, reporting true.
+func redactBody(body []byte) ([]byte, bool) {
+	// Numbers are kept as written
+	var doc interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, true
+	}
+	redacted, err := json.Marshal(redactJSON(doc))
+	if err != nil {
+		return nil, true
+	}
+	return redacted, false
+}
+
+// redactJSON replaces the redacted fields of decoded JSON, at any depth.
+// A value_base64 stays valid base64, of its placeholder.
+func redactJSON(doc interface{}) interface{} {
+	switch doc := doc.(type) {
+	case map[string]interface{}:
+		for key, val := range doc {
+			s, isString := val.(string)
+			switch {
+			case !redactedFields[key] || !isString:
+				doc[key] = redactJSON(val)
+			case key == "value_base64":
+				raw, err := base64.StdEncoding.DecodeString(s)
+				if err != nil {
+					raw = []byte(s)
+				}
+				doc[key] = base64.StdEncoding.EncodeToString([]byte(redactedValue(string(raw))))
+			default:
+				doc[key] = redactedValue(s)
+			}
+		}
+	case []interface{}:
+		for i, val := range doc {
+			doc[i] = redactJSON(val)
+		}
+	}
+	return doc
+}
+
+// redactPath replaces the value in the path of routes addressing a string
+// by value, once the route is known
+func redactPath(c *fiber.Ctx, path string) string {
+	if value := c.Params("string_value"); value != "" {
+		return strings.Replace(path, "/strings/"+value, "/strings/"+redactedValue(value), 1)
+	}
+	if encoded := c.Params("b64value"); encoded != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+		if err != nil {
+			raw = []byte(encoded)
+		}
+		return strings.Replace(path, "/encoded/"+encoded, "/encoded/"+base64.RawURLEncoding.EncodeToString([]byte(redactedValue(string(raw)))), 1)
+	}
+	return path
+}
+
+// writeRecording appends an entry to the recording
+func writeRecording(entry RecordedRequest) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("encoding recorded %s %s: %v", entry.Method, entry.Path, err)
+		return
+	}
+
+	recording.Lock()
+	defer recording.Unlock()
+	if _, err := recording.file.Write(append(line, '\n')); err != nil {
+		log.Printf("recording %s %s: %v", entry.Method, entry.Path, err)
+	}
+}
+
+// runReplay implements the replay command, sending the requests of a
+// recording one at a time, in order, to another instance and reporting
+// those answered with a different status than when recorded. It returns
+// the exit code: 1 when any answer differed, 2 when replay failed.
+//
+//	hng13_stage01 replay [-target URL] [-admin-target URL] [-admin-token TOKEN] [-stop-on-mismatch] FILE
+func runReplay(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	target := flags.String("target", "http://localhost:8000", "base URL of the instance to replay against")
+	adminTarget := flags.String("admin-target", "", "base URL for requests recorded on the admin listener (default -target)")
+	adminToken := flags.String("admin-token", "", "ADMIN_TOKEN of the instance, sent on /admin requests")
+	stop := flags.Bool("stop-on-mismatch", false, "stop at the first request answered differently")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: replay [flags] FILE")
+		flags.PrintDefaults()
+		return 2
+	}
+	if *adminTarget == "" {
+		*adminTarget = *target
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	defer file.Close()
+
+	client := &http.Client{Timeout: time.Minute}
+	replayed, mismatched := 0, 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var entry RecordedRequest
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			fmt.Fprintf(os.Stderr, "line %d: %v\n", replayed+1, err)
+			return 2
+		}
+
+		base := *target
+		if entry.Listener == "admin" {
+			base = *adminTarget
+		}
+		status, err := replayRequest(client, strings.TrimSuffix(base, "/"), *adminToken, entry)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s %s: %v\n", entry.Method, entry.Path, err)
+			return 2
+		}
+		replayed++
+
+		if status != entry.Status {
+			mismatched++
+			fmt.Printf("%s %s: answered %d, recorded %d\n", entry.Method, entry.Path, status, entry.Status)
+			if *stop {
+				break
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	fmt.Printf("replayed %d requests, %d answered differently\n", replayed, mismatched)
+	if mismatched > 0 {
+		return 1
+	}
+	return 0
+}
+
+// replayRequest sends one recorded request and returns the status
+func replayRequest(client *http.Client, base, adminToken string, entry RecordedRequest) (int, error) {
+	body := []byte(entry.Body)
+	if entry.BodyBase64 != "" {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(entry.BodyBase64); err != nil {
+			return 0, err
+		}
+	}
+
+	req, err := http.NewRequest(entry.Method, base+entry.Path, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	for name, val := range entry.Headers {
+		req.Header.Set(name, val)
+	}
+	if adminToken != "" && strings.HasPrefix(entry.Path, "/admin/") {
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+adminToken)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis key layout. Records are stored as JSON under the SHA-256 of their
+// value so arbitrary values make safe keys.
+const (
+	redisRecordPrefix  = "strings:record:"
+	redisHitsKey       = "strings:hits"
+	redisChangeChannel = "strings:changes"
+	// redisBinaryKeysMigrated is set once binary records written before
+	// their values had binaryKeyPrefix have been rekeyed
+	redisBinaryKeysMigrated = "strings:migrated:binary-keys"
+)
+
+// redisBackend shares the string set between instances through Redis
+type redisBackend struct {
+	client *redis.Client
+	// instance tags change notifications so an instance ignores its own
+	instance string
+}
+
+// newRedisBackend connects to the Redis server at url, e.g. redis://localhost:6379/0
+func newRedisBackend(ctx context.Context, url string) (*redisBackend, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	instance := make([]byte, 8)
+	if _, err := rand.Read(instance); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	if err := migrateRedisBinaryKeys(ctx, client); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &redisBackend{client: client, instance: hex.EncodeToString(instance)}, nil
+}
+
+// migrateRedisBinaryKeys rekeys binary records written before their values
+// had binaryKeyPrefix, with their hit counts, once per Redis database
+func migrateRedisBinaryKeys(ctx context.Context, client *redis.Client) error {
+	migrated, err := client.Exists(ctx, redisBinaryKeysMigrated).Result()
+	if err != nil || migrated > 0 {
+		return err
+	}
+
+	iter := client.Scan(ctx, 0, redisRecordPrefix+"*", 1000).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		raw, err := client.Get(ctx, key).Bytes()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		var data StringData
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return err
+		}
+		if data.Encoding != encodingBase64 || key == redisKey(data.Value) {
+			continue
+		}
+
+		oldHash, newHash := computeSHA256(displayValue(data.Value)), computeSHA256(data.Value)
+		hits, err := client.ZScore(ctx, redisHitsKey, oldHash).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		_, err = client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Rename(ctx, key, redisKey(data.Value))
+			pipe.ZRem(ctx, redisHitsKey, oldHash)
+			pipe.ZAdd(ctx, redisHitsKey, redis.Z{Score: hits, Member: newHash})
+			return nil
+		})
+		// Another instance starting at the same time may have moved it
+		if err != nil && !strings.Contains(err.Error(), "no such key") {
+			return err
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+
+	return client.Set(ctx, redisBinaryKeysMigrated, "1", 0).Err()
+}
+
+// redisKey returns the key holding a value's record
+func redisKey(value string) string {
+	return redisRecordPrefix + computeSHA256(value)
+}
+
+// HotRecords returns up to n records ordered by how often they were loaded
+func (b *redisBackend) HotRecords(ctx context.Context, n int) ([]*StringData, error) {
+	hashes, err := b.client.ZRevRange(ctx, redisHitsKey, 0, int64(n-1)).Result()
+	if err != nil || len(hashes) == 0 {
+		return nil, err
+	}
+
+	keys := make([]string, len(hashes))
+	for i, hash := range hashes {
+		keys[i] = redisRecordPrefix + hash
+	}
+
+	encoded, err := b.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*StringData
+	var expired []interface{}
+	for i, raw := range encoded {
+		s, ok := raw.(string)
+		if !ok {
+			// The record expired; its hit counter is stale
+			expired = append(expired, hashes[i])
+			continue
+		}
+
+		var data StringData
+		if err := json.Unmarshal([]byte(s), &data); err != nil {
+			return nil, err
+		}
+		records = append(records, &data)
+	}
+
+	if len(expired) > 0 {
+		b.client.ZRem(ctx, redisHitsKey, expired...)
+	}
+
+	return records, nil
+}
+
+// Load fetches a record and counts the access towards its hotness
+func (b *redisBackend) Load(ctx context.Context, value string) (*StringData, error) {
+	raw, err := b.client.Get(ctx, redisKey(value)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var data StringData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, err
+	}
+
+	b.client.ZIncrBy(ctx, redisHitsKey, 1, computeSHA256(value))
+
+	return &data, nil
+}
+
+// Save writes a record, letting Redis expire it when it has an expiry time
+func (b *redisBackend) Save(ctx context.Context, data *StringData) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	var ttl time.Duration
+	if data.ExpiresAt != nil {
+		if ttl = time.Until(*data.ExpiresAt); ttl <= 0 {
+			return b.Delete(ctx, data.Value)
+		}
+	}
+
+	_, err = b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, redisKey(data.Value), encoded, ttl)
+		pipe.ZAddNX(ctx, redisHitsKey, redis.Z{Member: computeSHA256(data.Value)})
+		pipe.Publish(ctx, redisChangeChannel, b.instance+":"+data.Value)
+		return nil
+	})
+	return err
+}
+
+// Delete removes a record and its hit counter
+func (b *redisBackend) Delete(ctx context.Context, value string) error {
+	_, err := b.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, redisKey(value))
+		pipe.ZRem(ctx, redisHitsKey, computeSHA256(value))
+		pipe.Publish(ctx, redisChangeChannel, b.instance+":"+value)
+		return nil
+	})
+	return err
+}
+
+// Watch reports values saved or deleted by other instances
+func (b *redisBackend) Watch(ctx context.Context, changed func(value string)) error {
+	sub := b.client.Subscribe(ctx, redisChangeChannel)
+	defer sub.Close()
+
+	messages := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+
+			instance, value, found := strings.Cut(msg.Payload, ":")
+			if !found {
+				log.Printf("ignoring malformed change notification %q", msg.Payload)
+				continue
+			}
+			if instance != b.instance {
+				changed(value)
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// remoteBackups pushes gzipped NDJSON backups to an S3-compatible bucket
+// (AWS S3, MinIO, or GCS through its S3 interoperability endpoint) and
+// keeps only the newest few, so a host that loses its disk can be
+// restored through /admin/restore
+type remoteBackups struct {
+	client    *minio.Client
+	bucket    string
+	prefix    string
+	retention int
+}
+
+// newRemoteBackups connects to the bucket at endpoint, e.g.
+// https://s3.amazonaws.com; an http:// endpoint disables TLS
+func newRemoteBackups(endpoint, bucket, prefix string, retention int) (*remoteBackups, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid endpoint %q", endpoint)
+	}
+
+	client, err := minio.New(u.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.BackupS3AccessKey, config.BackupS3SecretKey, ""),
+		Secure: u.Scheme == "https",
+		Region: config.BackupS3Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &remoteBackups{client: client, bucket: bucket, prefix: prefix, retention: retention}, nil
+}
+
+// push uploads a backup of every stored string and collection and prunes
+// old ones
+func (r *remoteBackups) push(ctx context.Context) (string, error) {
+	var body bytes.Buffer
+	if err := encodeBackup(&body, allRecords(), snapshotCollections(), true); err != nil {
+		return "", err
+	}
+
+	key := r.prefix + backupFilename(time.Now(), true)
+	_, err := r.client.PutObject(ctx, r.bucket, key, &body, int64(body.Len()), minio.PutObjectOptions{
+		ContentType: "application/gzip",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return key, r.prune(ctx)
+}
+
+// prune deletes all but the newest retention backups under the prefix.
+// Backup names sort by time, so the oldest come first.
+func (r *remoteBackups) prune(ctx context.Context) error {
+	if r.retention <= 0 {
+		return nil
+	}
+
+	var keys []string
+	for object := range r.client.ListObjects(ctx, r.bucket, minio.ListObjectsOptions{Prefix: r.prefix + "strings-"}) {
+		if object.Err != nil {
+			return object.Err
+		}
+		if strings.HasSuffix(object.Key, ".ndjson.gz") {
+			keys = append(keys, object.Key)
+		}
+	}
+	sort.Strings(keys)
+
+	for len(keys) > r.retention {
+		if err := r.client.RemoveObject(ctx, r.bucket, keys[0], minio.RemoveObjectOptions{}); err != nil {
+			return err
+		}
+		keys = keys[1:]
+	}
+	return nil
+}
+
+// run pushes a backup every interval until ctx is done
+func (r *remoteBackups) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			key, err := r.push(ctx)
+			if err != nil {
+				log.Printf("pushing backup to bucket %s: %v", r.bucket, err)
+				continue
+			}
+			log.Printf("pushed backup to %s/%s", r.bucket, key)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Environment a restarting process passes to its successor: the addresses
+// of the listening sockets it hands over, in file descriptor order, and the
+// snapshot to restore when neither SNAPSHOT_PATH nor WAL_PATH keeps the
+// store on disk
+const (
+	handoffListenersEnv = "HANDOFF_LISTENERS"
+	handoffSnapshotEnv  = "HANDOFF_SNAPSHOT"
+)
+
+// File descriptors of a successor: it reports on the ready pipe once its
+// configuration checks out, then waits for the go pipe to close before
+// restoring the store, so it starts from everything its predecessor stored.
+// The inherited sockets follow.
+const (
+	handoffGoFD        = 3
+	handoffReadyFD     = 4
+	handoffListenersFD = 5
+)
+
+// handoff is what this process inherited from the one it replaced
+var handoff = struct {
+	listeners map[string]net.Listener
+	snapshot  string
+}{listeners: make(map[string]net.Listener)}
+
+// successor is a process started to take over the listening sockets
+type successor struct {
+	cmd      *exec.Cmd
+	start    *os.File
+	snapshot string
+}
+
+// inheritListeners takes over the sockets a predecessor handed down, if
+// this process was started by a restart
+func inheritListeners() error {
+	addrs := os.Getenv(handoffListenersEnv)
+	if addrs == "" {
+		return nil
+	}
+	handoff.snapshot = os.Getenv(handoffSnapshotEnv)
+
+	for i, addr := range strings.Split(addrs, ",") {
+		file := os.NewFile(uintptr(handoffListenersFD+i), addr)
+		ln, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("inheriting %s: %w", addr, err)
+		}
+		handoff.listeners[addr] = ln
+	}
+	return nil
+}
+
+// awaitPredecessor tells the process being replaced that this one is ready
+// to take over and waits until it has drained its connections and saved the
+// store. It returns at once when there is no predecessor.
+func awaitPredecessor() {
+	if os.Getenv(handoffListenersEnv) == "" {
+		return
+	}
+
+	ready := os.NewFile(handoffReadyFD, "handoff-ready")
+	ready.WriteString("ready")
+	ready.Close()
+
+	started := time.Now()
+	start := os.NewFile(handoffGoFD, "handoff-go")
+	io.Copy(io.Discard, start)
+	start.Close()
+	log.Printf("took over %d listening sockets after %s", len(handoff.listeners), time.Since(started).Round(time.Millisecond))
+}
+
+// takeInherited returns the inherited socket for an address, if any
+func takeInherited(addr string) net.Listener {
+	ln, ok := handoff.listeners[addr]
+	if ok {
+		delete(handoff.listeners, addr)
+	}
+	return ln
+}
+
+// closeInherited closes inherited sockets no listener took, e.g. a port
+// dropped from the configuration
+func closeInherited() {
+	for addr, ln := range handoff.listeners {
+		log.Printf("closing inherited %s, no longer configured", addr)
+		ln.Close()
+		delete(handoff.listeners, addr)
+	}
+}
+
+// listenerAddr names a socket for the handoff: "tcp:<port>" or
+// "unix:<path>"
+func listenerAddr(addr net.Addr) string {
+	if addr.Network() == "unix" {
+		return "unix:" + addr.String()
+	}
+	_, port, _ := net.SplitHostPort(addr.String())
+	return "tcp:" + port
+}
+
+// sockets returns the TCP and Unix listeners behind opened listeners
+func sockets(opened []net.Listener) []net.Listener {
+	var all []net.Listener
+	for _, ln := range opened {
+		if m, ok := ln.(*multiListener); ok {
+			all = append(all, m.listeners...)
+		} else {
+			all = append(all, ln)
+		}
+	}
+	return all
+}
+
+// startSuccessor runs this executable again with the listening sockets and
+// waits up to SHUTDOWN_TIMEOUT for it to report ready. Until then nothing
+// changes here, so a successor that fails to start leaves this process
+// serving.
+func startSuccessor(opened []net.Listener) (*successor, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	startRead, startWrite, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	readyRead, readyWrite, err := os.Pipe()
+	if err != nil {
+		startRead.Close()
+		startWrite.Close()
+		return nil, err
+	}
+	files := []*os.File{startRead, readyWrite}
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+
+	var addrs []string
+	for _, ln := range sockets(opened) {
+		filer, ok := ln.(interface{ File() (*os.File, error) })
+		if !ok {
+			startWrite.Close()
+			readyRead.Close()
+			return nil, fmt.Errorf("cannot hand over %s", ln.Addr())
+		}
+		file, err := filer.File()
+		if err != nil {
+			startWrite.Close()
+			readyRead.Close()
+			return nil, err
+		}
+		files = append(files, file)
+		addrs = append(addrs, listenerAddr(ln.Addr()))
+	}
+
+	next := &successor{start: startWrite}
+	env := []string{handoffListenersEnv + "=" + strings.Join(addrs, ",")}
+	if config.SnapshotPath == "" && config.WALPath == "" {
+		next.snapshot = filepath.Join(os.TempDir(), fmt.Sprintf("strings-handoff-%d.json", os.Getpid()))
+		env = append(env, handoffSnapshotEnv+"="+next.snapshot)
+	}
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, handoffListenersEnv+"=") && !strings.HasPrefix(kv, handoffSnapshotEnv+"=") {
+			env = append(env, kv)
+		}
+	}
+
+	next.cmd = exec.Command(executable, os.Args[1:]...)
+	next.cmd.Stdin, next.cmd.Stdout, next.cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	next.cmd.Env = env
+	next.cmd.ExtraFiles = files
+	if err := next.cmd.Start(); err != nil {
+		startWrite.Close()
+		readyRead.Close()
+		return nil, err
+	}
+	log.Printf("started successor process %d", next.cmd.Process.Pid)
+
+	// Closing our copies first means a successor that exits early ends the
+	// read below instead of leaving it waiting on the write end held here
+	for _, file := range files {
+		file.Close()
+	}
+	files = nil
+
+	readyRead.SetReadDeadline(time.Now().Add(config.ShutdownTimeout))
+	status, err := io.ReadAll(readyRead)
+	readyRead.Close()
+	if string(status) != "ready" {
+		startWrite.Close()
+		if err != nil {
+			next.cmd.Process.Kill()
+		}
+		waitErr := next.cmd.Wait()
+		if err != nil {
+			return nil, fmt.Errorf("successor not ready within SHUTDOWN_TIMEOUT: %w", err)
+		}
+		return nil, fmt.Errorf("successor exited before taking over: %v", waitErr)
+	}
+	return next, nil
+}
+
+// shutdown stops every listener, letting requests in progress finish
+// within SHUTDOWN_TIMEOUT, then saves the store for the next process: a
+// final snapshot to SNAPSHOT_PATH, or to a handoff file when the store is
+// not kept on disk and a successor takes over, and pending backend writes.
+// The WAL is closed last so the successor replays anything written after
+// the snapshot. A successor is then let go.
+func shutdown(listeners []listener, opened []net.Listener, next *successor) error {
+	// Sockets handed over must outlive this process, so their paths stay
+	for _, ln := range sockets(opened) {
+		if unix, ok := ln.(*net.UnixListener); ok {
+			unix.SetUnlinkOnClose(next == nil)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, l := range listeners {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.app.ShutdownWithTimeout(config.ShutdownTimeout); err != nil {
+				log.Printf("stopping %s listener: %v", l.name, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var failure error
+	snapshot := config.SnapshotPath
+	if next != nil && next.snapshot != "" {
+		snapshot = next.snapshot
+	}
+	if snapshot != "" {
+		written, err := writeSnapshot(snapshot)
+		if err != nil {
+			failure = fmt.Errorf("writing final snapshot to %s: %w", snapshot, err)
+		} else {
+			log.Printf("wrote %d strings to %s", written, snapshot)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	if failed := flushPersistence(ctx); failed > 0 {
+		log.Printf("%d backend writes were not persisted", failed)
+	}
+	cancel()
+
+	if err := closeWAL(); err != nil && failure == nil {
+		failure = fmt.Errorf("closing WAL: %w", err)
+	}
+
+	if next != nil {
+		next.start.Close()
+		log.Printf("handed over to process %d", next.cmd.Process.Pid)
+	}
+	return failure
+}
+
+// restartSignals are the signals serveListeners acts on: SIGHUP restarts
+// into a new process, the others stop the service
+var restartSignals = []os.Signal{syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT}
@@ -0,0 +1,112 @@
+package main
+
+import "github.com/gofiber/fiber/v2"
+
+// PropertySchema describes a property produced by the analyzer set
+type PropertySchema struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	Filterable bool     `json:"filterable"`
+	Filters    []string `json:"filters,omitempty"`
+	Sortable   bool     `json:"sortable"`
+	Analyzer   string   `json:"analyzer"`
+	Version    int      `json:"version"`
+	Optional   bool     `json:"optional"`
+	Enabled    bool     `json:"enabled"`
+	BinaryOnly bool     `json:"binary_only,omitempty"`
+}
+
+// PropertySchemaResponse represents the response for GET /schema/properties
+type PropertySchemaResponse struct {
+	Properties []PropertySchema `json:"properties"`
+	Count      int              `json:"count"`
+}
+
+// getPropertySchema handles GET /schema/properties
+func getPropertySchema(c *fiber.Ctx) error {
+	var properties []PropertySchema
+	profile := defaultProfile.Load()
+
+	for _, a := range analyzers {
+		for _, prop := range a.Properties {
+			properties = append(properties, PropertySchema{
+				Name:       prop.Name,
+				Type:       prop.Type,
+				Filterable: len(prop.Filters) > 0,
+				Filters:    prop.Filters,
+				Analyzer:   a.Name,
+				Version:    a.Version,
+				Optional:   a.Optional,
+				Enabled:    profile.enabled[a.Name],
+				BinaryOnly: a.BinaryOnly,
+			})
+		}
+	}
+
+	for _, def := range loadDerivedProperties() {
+		properties = append(properties, PropertySchema{
+			Name:       "derived." + def.Name,
+			Type:       "number",
+			Filterable: true,
+			Filters:    []string{"min_" + def.Name, "max_" + def.Name},
+			Analyzer:   "derived",
+			Version:    1,
+			Enabled:    profile.enabled["derived"],
+		})
+	}
+
+	return c.JSON(PropertySchemaResponse{
+		Properties: properties,
+		Count:      len(properties),
+	})
+}
+
+// FilterSchema describes a query parameter accepted by the list endpoints
+type FilterSchema struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Operator    string `json:"operator"`
+	Description string `json:"description"`
+}
+
+// PhrasingSchema describes a phrase the natural language parser understands
+type PhrasingSchema struct {
+	Phrasing string   `json:"phrasing"`
+	Example  string   `json:"example"`
+	Filters  []string `json:"filters"`
+}
+
+// FilterSchemaResponse represents the response for GET /schema/filters
+type FilterSchemaResponse struct {
+	Filters                 []FilterSchema   `json:"filters"`
+	NaturalLanguage         []PhrasingSchema `json:"natural_language"`
+	NaturalLanguageEndpoint string           `json:"natural_language_endpoint"`
+}
+
+// getFilterSchema handles GET /schema/filters
+func getFilterSchema(c *fiber.Ctx) error {
+	response := FilterSchemaResponse{
+		NaturalLanguageEndpoint: "/strings/filter-by-natural-language?query=",
+	}
+
+	for _, spec := range allFilterSpecs() {
+		response.Filters = append(response.Filters, FilterSchema{
+			Name:        spec.Name,
+			Type:        spec.Type,
+			Operator:    spec.Operator,
+			Description: spec.Description,
+		})
+	}
+
+	for _, rules := range [][]nlRule{nlRules, loadCustomNLRules()} {
+		for _, rule := range rules {
+			response.NaturalLanguage = append(response.NaturalLanguage, PhrasingSchema{
+				Phrasing: rule.Phrasing,
+				Example:  rule.Example,
+				Filters:  rule.Filters,
+			})
+		}
+	}
+
+	return c.JSON(response)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"unicode"
+)
+
+// rtlScripts are the scripts written right to left
+var rtlScripts = map[string]bool{
+	"Adlam":     true,
+	"Arabic":    true,
+	"Hebrew":    true,
+	"Mandaic":   true,
+	"Nko":       true,
+	"Samaritan": true,
+	"Syriac":    true,
+	"Thaana":    true,
+}
+
+// scriptSets are the combinations of scripts normally written together, as
+// in Japanese or Korean, which Unicode TS #39 ("highly restrictive") does
+// not treat as mixed
+var scriptSets = []map[string]bool{
+	{"Latin": true, "Han": true, "Hiragana": true, "Katakana": true},
+	{"Latin": true, "Han": true, "Bopomofo": true},
+	{"Latin": true, "Han": true, "Hangul": true},
+}
+
+// analyzeScripts lists the Unicode scripts of a value's letters, whether
+// they are mixed and whether the value reads right to left
+func analyzeScripts(_ context.Context, value string, p *StringProperties, _ *analysisProfile) {
+	p.Scripts = letterScripts(value)
+	p.MixedScript = isMixedScript(p.Scripts)
+	p.IsRTL = isRTL(value)
+}
+
+// isMixedScript reports whether scripts combine more than one script
+// outside the sets normally written together, such as Latin letters mixed
+// with look-alike Cyrillic ones
+func isMixedScript(scripts []string) bool {
+	if len(scripts) < 2 {
+		return false
+	}
+	for _, set := range scriptSets {
+		within := true
+		for _, script := range scripts {
+			within = within && set[script]
+		}
+		if within {
+			return false
+		}
+	}
+	return true
+}
+
+// letterScripts returns the Unicode scripts a value's letters are written
+// in, most letters first and ties by name. Digits, punctuation and marks
+// shared between scripts are not counted.
+func letterScripts(value string) []string {
+	counts := make(map[string]int)
+	for _, r := range value {
+		if script := letterScript(r); script != "" {
+			counts[script]++
+		}
+	}
+
+	scripts := make([]string, 0, len(counts))
+	for name := range counts {
+		scripts = append(scripts, name)
+	}
+	sort.Slice(scripts, func(i, j int) bool {
+		if counts[scripts[i]] != counts[scripts[j]] {
+			return counts[scripts[i]] > counts[scripts[j]]
+		}
+		return scripts[i] < scripts[j]
+	})
+	return scripts
+}
+
+// letterScript returns the script of a letter, or "" for other runes
+func letterScript(r rune) string {
+	if !unicode.IsLetter(r) {
+		return ""
+	}
+	if r < 0x80 {
+		return "Latin"
+	}
+	for name, table := range unicode.Scripts {
+		if name != "Common" && name != "Inherited" && unicode.Is(table, r) {
+			return name
+		}
+	}
+	return ""
+}
+
+// isRTL reports whether a value's first letter, which sets the direction
+// of the text under the Unicode bidirectional algorithm, is in a
+// right-to-left script
+func isRTL(value string) bool {
+	for _, r := range value {
+		if script := letterScript(r); script != "" {
+			return rtlScripts[script]
+		}
+	}
+	return false
+}
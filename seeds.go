@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// seedActor is the actor recorded on events for seeded strings
+const seedActor = "system:seed"
+
+// errPinned is returned for writes to a string loaded from SEED_STRINGS
+var errPinned = fiber.NewError(fiber.StatusForbidden, "String is pinned by the seed file and cannot be changed or deleted")
+
+// loadSeedStrings stores the strings listed in the SEED_STRINGS file, a
+// JSON array of POST /strings bodies, analyzed with the current analyzers
+// and pinned: clients cannot change or delete them and they are never
+// evicted. Strings pinned by an earlier run that are no longer listed are
+// unpinned. It returns how many strings were seeded.
+func loadSeedStrings(path string) (int, error) {
+	if path == "" {
+		return 0, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var seeds []CreateStringRequest
+	if err := json.Unmarshal(raw, &seeds); err != nil {
+		return 0, err
+	}
+
+	opts := createOptions{
+		duplicatePolicy: duplicatePolicyOff,
+		onConflict:      onConflictReplace,
+		actor:           seedActor,
+		pinned:          true,
+	}
+	seeded := make(map[string]bool, len(seeds))
+	for i, req := range seeds {
+		if req.TTLSeconds != 0 || req.EncryptionKeyID != "" {
+			return 0, fmt.Errorf("seed %d: ttl_seconds and encryption_key_id are not allowed", i)
+		}
+		result, err := createValue(context.Background(), req, opts)
+		if err != nil {
+			return 0, fmt.Errorf("seed %d: %v", i, err)
+		}
+		seeded[result.data.Value] = true
+	}
+
+	lockAllShards()
+	defer unlockAllShards()
+	for _, data := range allRecordsLocked() {
+		if data.Pinned && !seeded[data.Value] {
+			unpinned := *data
+			unpinned.Pinned = false
+			shardFor(data.Value).putLocked(&unpinned)
+		}
+	}
+
+	return len(seeded), nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+)
+
+// Sentiment labels
+const (
+	sentimentPositive = "positive"
+	sentimentNegative = "negative"
+	sentimentNeutral  = "neutral"
+)
+
+const (
+	// sentimentThreshold is how far from 0 a score must be to not be neutral
+	sentimentThreshold = 0.25
+	// negationReach is how many words before a sentiment word a negation
+	// flips it, as in "not very good"
+	negationReach = 3
+)
+
+// Sentiment is the tone of a value: a score from -1 (negative) to 1
+// (positive), its label, how confident the provider is from 0 to 1, and
+// which provider scored it
+type Sentiment struct {
+	Label      string  `json:"label"`
+	Score      float64 `json:"score"`
+	Confidence float64 `json:"confidence"`
+	Provider   string  `json:"provider"`
+}
+
+// SentimentProvider scores the sentiment of values
+type SentimentProvider interface {
+	Name() string
+	Score(ctx context.Context, value string, profile *analysisProfile) (*Sentiment, error)
+}
+
+// sentimentProvider scores values for the sentiment analyzer; set at
+// startup from SENTIMENT_PROVIDER
+var sentimentProvider SentimentProvider = lexiconSentiment{}
+
+// newSentimentProvider returns the provider named by SENTIMENT_PROVIDER
+func newSentimentProvider() (SentimentProvider, error) {
+	switch config.SentimentProvider {
+	case "lexicon":
+		return lexiconSentiment{}, nil
+	case "http":
+		if config.SentimentURL == "" {
+			return nil, fmt.Errorf("SENTIMENT_PROVIDER=http needs SENTIMENT_URL")
+		}
+		return httpSentiment{url: config.SentimentURL, client: &http.Client{}}, nil
+	}
+	return nil, fmt.Errorf("unknown SENTIMENT_PROVIDER %q", config.SentimentProvider)
+}
+
+// analyzeSentiment scores a value with the configured provider, falling
+// back to the lexicon when it fails or takes longer than SENTIMENT_TIMEOUT.
+// The provider's call ends with ctx, so it stops when the request does.
+func analyzeSentiment(ctx context.Context, value string, p *StringProperties, profile *analysisProfile) {
+	ctx, cancel := context.WithTimeout(ctx, config.SentimentTimeout)
+	defer cancel()
+
+	sentiment, err := sentimentProvider.Score(ctx, value, profile)
+	if err != nil {
+		log.Printf("%s sentiment provider failed, using the lexicon: %v", sentimentProvider.Name(), err)
+		sentiment, _ = lexiconSentiment{}.Score(ctx, value, profile)
+	}
+	p.Sentiment = sentiment
+}
+
+// sentimentLabel labels a score from -1 to 1
+func sentimentLabel(score float64) string {
+	switch {
+	case score >= sentimentThreshold:
+		return sentimentPositive
+	case score <= -sentimentThreshold:
+		return sentimentNegative
+	}
+	return sentimentNeutral
+}
+
+// lexiconSentiment scores values with the positive and negative words of
+// the detected language pack. Each match counts for its side, or for the
+// other side when a negation comes shortly before it; the score is the
+// balance between the sides. Confidence is the share of matches agreeing
+// with the label, scaled down when fewer than minLanguageEvidence matched.
+type lexiconSentiment struct{}
+
+func (lexiconSentiment) Name() string { return "lexicon" }
+
+func (lexiconSentiment) Score(_ context.Context, value string, profile *analysisProfile) (*Sentiment, error) {
+	words := languageWords(value, profile.tokenizer)
+	sentiment := &Sentiment{Label: sentimentNeutral, Provider: "lexicon"}
+	pack := detectLanguagePack(words)
+	if pack == nil {
+		return sentiment, nil
+	}
+
+	positive, negative, lastNegation := 0, 0, -negationReach-1
+	for i, word := range words {
+		if pack.negations[word] {
+			lastNegation = i
+			continue
+		}
+		polarity, ok := pack.polarity[word]
+		if !ok {
+			polarity = pack.polarity[pack.stem(word)]
+		}
+		if polarity != 0 && i-lastNegation <= negationReach {
+			polarity = -polarity
+		}
+		switch polarity {
+		case 1:
+			positive++
+		case -1:
+			negative++
+		}
+	}
+
+	matched := positive + negative
+	if matched == 0 {
+		return sentiment, nil
+	}
+	score := float64(positive-negative) / float64(matched)
+	sentiment.Score = math.Round(score*100) / 100
+	sentiment.Label = sentimentLabel(score)
+
+	// The share of matches on the labelled side, or balanced ones for neutral
+	agreeing := (1 + math.Abs(score)) / 2
+	if sentiment.Label == sentimentNeutral {
+		agreeing = 1 - math.Abs(score)
+	}
+	confidence := agreeing * math.Min(1, float64(matched)/minLanguageEvidence)
+	sentiment.Confidence = math.Round(confidence*100) / 100
+	return sentiment, nil
+}
+
+// httpSentiment scores values with an external service: the value is
+// POSTed as {"text": ...} to its URL, which answers with the label, a
+// score from -1 to 1 and a confidence from 0 to 1
+type httpSentiment struct {
+	url    string
+	client *http.Client
+}
+
+func (httpSentiment) Name() string { return "http" }
+
+func (h httpSentiment) Score(ctx context.Context, value string, _ *analysisProfile) (*Sentiment, error) {
+	body, err := json.Marshal(map[string]string{"text": value})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("answered %s", resp.Status)
+	}
+
+	var sentiment Sentiment
+	if err := json.NewDecoder(resp.Body).Decode(&sentiment); err != nil {
+		return nil, err
+	}
+	switch sentiment.Label {
+	case sentimentPositive, sentimentNegative, sentimentNeutral:
+	default:
+		return nil, fmt.Errorf("unknown label %q", sentiment.Label)
+	}
+	if math.Abs(sentiment.Score) > 1 || sentiment.Confidence < 0 || sentiment.Confidence > 1 {
+		return nil, fmt.Errorf("score or confidence out of range")
+	}
+	sentiment.Provider = "http"
+	return &sentiment, nil
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/gofiber/fiber/v2/middleware/skip"
+)
+
+// publicOnly wraps middleware meant for public traffic only (demo limits,
+// abuse bans, injected faults) so that admin routes sharing the public app
+// when ADMIN_PORT is unset skip it
+func publicOnly(handler fiber.Handler) fiber.Handler {
+	if config.AdminPort != "" {
+		return handler
+	}
+	return skip.New(handler, func(c *fiber.Ctx) bool {
+		return c.Path() == "/admin" || strings.HasPrefix(c.Path(), "/admin/")
+	})
+}
+
+// listener is where the service answers, a TCP port, a Unix socket or
+// both, and the app serving it
+type listener struct {
+	name   string
+	port   string
+	socket string
+	app    *fiber.App
+}
+
+// newListeners builds the public API on PORT and UNIX_SOCKET, plus the
+// admin API on ADMIN_PORT and metrics on METRICS_PORT when they are set,
+// each with its own middleware, so operators can firewall them separately.
+// Without them the admin routes and /metrics are served with the public
+// API.
+func newListeners() ([]listener, error) {
+	publicPort := config.Port
+	if config.UnixSocketOnly {
+		if config.UnixSocket == "" {
+			return nil, fmt.Errorf("UNIX_SOCKET_ONLY needs UNIX_SOCKET")
+		}
+		publicPort = ""
+	}
+
+	ports := make(map[string]string)
+	for _, p := range []struct{ name, port string }{
+		{"PORT", publicPort},
+		{"ADMIN_PORT", config.AdminPort},
+		{"METRICS_PORT", config.MetricsPort},
+	} {
+		if p.port == "" {
+			continue
+		}
+		if other, taken := ports[p.port]; taken {
+			return nil, fmt.Errorf("%s and %s are both %s", other, p.name, p.port)
+		}
+		ports[p.port] = p.name
+	}
+
+	public := fiber.New(fiber.Config{
+		ErrorHandler: customErrorHandler,
+	})
+	public.Use(logger.New())
+	public.Use(countRequests("public"))
+	if config.RecordRequests != "" {
+		public.Use(recordRequests("public"))
+	}
+	public.Use(recover.New())
+	if config.DemoMode {
+		public.Use(publicOnly(demoBanner))
+		public.Use(publicOnly(demoWriteLimiter()))
+	}
+	if config.AbuseDetection {
+		public.Use(publicOnly(abuseGuard))
+	}
+	if config.FaultInjection {
+		public.Use(publicOnly(injectFaults))
+	}
+	public.Use(requestTimeout(config.RequestTimeout))
+	public.Use(responseSchema)
+	public.Use(evictionHeader)
+	registerHealthChecks(public)
+	registerRoutes(public)
+	listeners := []listener{{name: "public", port: publicPort, socket: config.UnixSocket, app: public}}
+
+	// Without ADMIN_PORT the admin routes share the public app, skipping
+	// its public-only middleware
+	admin := public
+	if config.AdminPort != "" {
+		admin = fiber.New(fiber.Config{
+			ErrorHandler:          customErrorHandler,
+			DisableStartupMessage: true,
+		})
+		admin.Use(logger.New())
+		admin.Use(countRequests("admin"))
+		if config.RecordRequests != "" {
+			admin.Use(recordRequests("admin"))
+		}
+		admin.Use(recover.New())
+		admin.Use(requestTimeout(config.RequestTimeout))
+		admin.Use(responseSchema)
+		admin.Use(evictionHeader)
+		registerHealthChecks(admin)
+		listeners = append(listeners, listener{name: "admin", port: config.AdminPort, app: admin})
+	}
+	registerAdminRoutes(admin.Group("/admin", adminAuth))
+
+	if config.MetricsPort == "" {
+		public.Get("/metrics", getMetrics)
+		return listeners, nil
+	}
+	metrics := fiber.New(fiber.Config{
+		ErrorHandler:          customErrorHandler,
+		DisableStartupMessage: true,
+	})
+	metrics.Use(recover.New())
+	registerHealthChecks(metrics)
+	metrics.Get("/metrics", getMetrics)
+	return append(listeners, listener{name: "metrics", port: config.MetricsPort, app: metrics}), nil
+}
+
+// registerHealthChecks adds the health checks every listener answers
+func registerHealthChecks(app *fiber.App) {
+	app.Get("/healthz", healthz)
+	app.Get("/readyz", readyz)
+}
+
+// serveListeners serves every listener until one of them fails or the
+// process is signalled. SIGTERM and SIGINT shut down gracefully; SIGHUP
+// hands the listening sockets to a new process started from the same
+// executable, so an upgraded binary takes over without refusing a
+// connection.
+func serveListeners(listeners []listener) error {
+	opened := make([]net.Listener, len(listeners))
+	for i, l := range listeners {
+		ln, err := l.open()
+		if err != nil {
+			return fmt.Errorf("%s listener: %w", l.name, err)
+		}
+		opened[i] = ln
+	}
+	closeInherited()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, restartSignals...)
+
+	errs := make(chan error, len(listeners))
+	for i, l := range listeners {
+		go func() {
+			if l.socket != "" {
+				log.Printf("serving %s routes on unix:%s", l.name, l.socket)
+			}
+			if l.name != "public" {
+				log.Printf("serving %s routes on :%s", l.name, l.port)
+			}
+			errs <- fmt.Errorf("%s listener: %w", l.name, l.app.Listener(opened[i]))
+		}()
+	}
+
+	for {
+		select {
+		case err := <-errs:
+			return err
+		case sig := <-signals:
+			var next *successor
+			if sig == syscall.SIGHUP {
+				var err error
+				if next, err = startSuccessor(opened); err != nil {
+					log.Printf("restart failed, still serving: %v", err)
+					continue
+				}
+			}
+			log.Printf("%s received, shutting down", sig)
+			return shutdown(listeners, opened, next)
+		}
+	}
+}
+
+// open starts listening on the listener's TCP port, Unix socket or both,
+// taking over sockets inherited from a predecessor first
+func (l listener) open() (net.Listener, error) {
+	var lns []net.Listener
+	if l.port != "" {
+		ln := takeInherited("tcp:" + l.port)
+		if ln == nil {
+			var err error
+			if ln, err = net.Listen(l.app.Config().Network, ":"+l.port); err != nil {
+				return nil, err
+			}
+		}
+		lns = append(lns, ln)
+	}
+	if l.socket != "" {
+		ln := takeInherited("unix:" + l.socket)
+		if ln == nil {
+			var err error
+			if ln, err = listenUnix(l.socket); err != nil {
+				for _, open := range lns {
+					open.Close()
+				}
+				return nil, err
+			}
+		}
+		lns = append(lns, ln)
+	}
+
+	if len(lns) == 1 {
+		return lns[0], nil
+	}
+	return newMultiListener(lns), nil
+}
+
+// listenUnix listens on a Unix socket with the UNIX_SOCKET_MODE
+// permissions, replacing a socket left behind by an earlier run. A socket
+// another process still answers on is left alone.
+func listenUnix(path string) (net.Listener, error) {
+	mode, err := strconv.ParseUint(config.UnixSocketMode, 8, 32)
+	if err != nil || mode > 0o777 {
+		return nil, fmt.Errorf("UNIX_SOCKET_MODE must be octal permissions such as 0660")
+	}
+
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, os.FileMode(mode)); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// multiListener accepts connections from several listeners, so one app can
+// serve a TCP port and a Unix socket without being started twice.
+// Connections already accepted when it is closed are still handed out, so
+// a graceful shutdown serves them instead of dropping them.
+type multiListener struct {
+	listeners []net.Listener
+	accepted  chan acceptResult
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+func newMultiListener(listeners []net.Listener) *multiListener {
+	m := &multiListener{
+		listeners: listeners,
+		accepted:  make(chan acceptResult),
+		done:      make(chan struct{}),
+	}
+
+	var wg sync.WaitGroup
+	for _, ln := range listeners {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					select {
+					case <-m.done:
+					default:
+						m.accepted <- acceptResult{err: err}
+					}
+					return
+				}
+				m.accepted <- acceptResult{conn: conn}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(m.accepted)
+	}()
+	return m
+}
+
+func (m *multiListener) Accept() (net.Conn, error) {
+	result, ok := <-m.accepted
+	if !ok {
+		return nil, net.ErrClosed
+	}
+	return result.conn, result.err
+}
+
+func (m *multiListener) Close() error {
+	var err error
+	m.closeOnce.Do(func() {
+		close(m.done)
+		for _, ln := range m.listeners {
+			if closeErr := ln.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+	})
+	return err
+}
+
+// Addr returns the address of the first listener, the TCP port if any
+func (m *multiListener) Addr() net.Addr {
+	return m.listeners[0].Addr()
+}
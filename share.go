@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ShareRequest represents the optional request body for POST /strings/:id/share
+type ShareRequest struct {
+	TTLSeconds int `json:"ttl_seconds"`
+}
+
+// ShareResponse represents the response for POST /strings/:id/share
+type ShareResponse struct {
+	Token     string     `json:"token"`
+	URL       string     `json:"url"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// shareKey signs share tokens. Without SHARE_SECRET a random key is used,
+// so links stop working on restart.
+var shareKey = newShareKey(config.ShareSecret)
+
+func newShareKey(secret string) []byte {
+	if secret != "" {
+		return []byte(secret)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		log.Fatalf("generating share key: %v", err)
+	}
+	return key
+}
+
+// shareString handles POST /strings/:id/share, returning a signed link that
+// grants read access to this one string, optionally expiring after
+// ttl_seconds. Links are not stored; rotating SHARE_SECRET revokes them all.
+func shareString(c *fiber.Ctx) error {
+	var req ShareRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+	}
+	if req.TTLSeconds < 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "'ttl_seconds' must not be negative")
+	}
+
+	data, err := findByID(c, c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	response := ShareResponse{}
+	var expires int64
+	if req.TTLSeconds > 0 {
+		expiresAt := time.Now().UTC().Add(time.Duration(req.TTLSeconds) * time.Second).Truncate(time.Second)
+		response.ExpiresAt = &expiresAt
+		expires = expiresAt.Unix()
+	}
+	response.Token = signShareToken(data.ID, expires)
+	response.URL = c.BaseURL() + "/shared/" + response.Token
+
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+// getSharedString handles GET /shared/:token
+func getSharedString(c *fiber.Ctx) error {
+	id, expires, ok := verifyShareToken(c.Params("token"))
+	if !ok {
+		return fiber.NewError(fiber.StatusForbidden, "Invalid share link")
+	}
+	if expires != 0 && time.Now().Unix() >= expires {
+		return fiber.NewError(fiber.StatusGone, "Share link has expired")
+	}
+
+	data, err := findByID(c, id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(data)
+}
+
+// signShareToken encodes a record ID and expiry (Unix seconds, 0 for none)
+// followed by their HMAC, both base64url encoded
+func signShareToken(id string, expires int64) string {
+	payload := []byte(id + ":" + strconv.FormatInt(expires, 10))
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(shareMAC(payload))
+}
+
+// verifyShareToken checks a token's signature and returns what it grants
+func verifyShareToken(token string) (id string, expires int64, ok bool) {
+	encodedPayload, encodedMAC, found := strings.Cut(token, ".")
+	if !found {
+		return "", 0, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return "", 0, false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil || !hmac.Equal(mac, shareMAC(payload)) {
+		return "", 0, false
+	}
+
+	id, rawExpires, found := strings.Cut(string(payload), ":")
+	if !found {
+		return "", 0, false
+	}
+	expires, err = strconv.ParseInt(rawExpires, 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return id, expires, true
+}
+
+func shareMAC(payload []byte) []byte {
+	mac := hmac.New(sha256.New, shareKey)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxSimilarStrings is how many similar strings a create reports
+const maxSimilarStrings = 3
+
+// SimilarString is an existing string resembling a newly created one, with
+// their bigram overlap from 0 to 1
+type SimilarString struct {
+	ID         string  `json:"id"`
+	Value      string  `json:"value"`
+	Similarity float64 `json:"similarity"`
+}
+
+// bigrams returns the set of character pairs of a case-folded value, padded
+// so single characters and word boundaries count too
+func bigrams(s string) map[string]bool {
+	runes := []rune(" " + strings.ToLower(s) + " ")
+	set := make(map[string]bool, len(runes))
+	for i := 0; i+1 < len(runes); i++ {
+		set[string(runes[i:i+2])] = true
+	}
+	return set
+}
+
+// bigramSimilarity is the Dice coefficient of two bigram sets
+func bigramSimilarity(a, b map[string]bool) float64 {
+	if len(a)+len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for pair := range a {
+		if b[pair] {
+			shared++
+		}
+	}
+	return 2 * float64(shared) / float64(len(a)+len(b))
+}
+
+// findSimilar returns up to maxSimilarStrings stored strings other than
+// data sharing the most bigrams with it, most similar first. Encrypted
+// values are never compared. Every shard is read in turn, so the caller
+// must not hold a shard lock.
+func findSimilar(data *StringData) []SimilarString {
+	if data.Encoding == encodingEncrypted {
+		return nil
+	}
+	target := bigrams(data.Value)
+	now := time.Now()
+
+	var similar []SimilarString
+	for _, shard := range shards {
+		shard.RLock()
+		for value, existing := range shard.records {
+			if value == data.Value || existing.Encoding == encodingEncrypted || existing.expired(now) {
+				continue
+			}
+			score := bigramSimilarity(target, bigrams(value))
+			if score == 0 || (len(similar) == maxSimilarStrings && score <= similar[maxSimilarStrings-1].Similarity) {
+				continue
+			}
+			similar = append(similar, SimilarString{ID: existing.ID, Value: displayValue(value), Similarity: score})
+			sort.SliceStable(similar, func(i, j int) bool { return similar[i].Similarity > similar[j].Similarity })
+			if len(similar) > maxSimilarStrings {
+				similar = similar[:maxSimilarStrings]
+			}
+		}
+		shard.RUnlock()
+	}
+
+	for i := range similar {
+		similar[i].Similarity = math.Round(similar[i].Similarity*1000) / 1000
+	}
+	return similar
+}
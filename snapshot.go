@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// snapshotVersion is bumped whenever the snapshot layout changes
+const snapshotVersion = 1
+
+// Snapshot is the on-disk form of the in-memory store
+type Snapshot struct {
+	Version     int                  `json:"version"`
+	TakenAt     time.Time            `json:"taken_at"`
+	WALSequence uint64               `json:"wal_sequence"`
+	Strings     []*StringData        `json:"strings"`
+	Collections []CollectionSnapshot `json:"collections,omitempty"`
+	// DerivedProperties are the admin-defined property definitions
+	DerivedProperties []DerivedProperty `json:"derived_properties,omitempty"`
+}
+
+// snapshotMu serializes snapshot writes so two never race on the temp file
+var snapshotMu sync.Mutex
+
+// writeSnapshot serializes every stored string to path. The snapshot is
+// written to a temp file in the same directory, synced and renamed over the
+// old one so a crash mid-write never leaves a truncated snapshot behind.
+// WAL entries the snapshot covers are then compacted away.
+func writeSnapshot(path string) (int, error) {
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+
+	// Shards are copied one at a time after the sequence is read, so writes
+	// racing the copy may be both in the snapshot and replayed from the WAL;
+	// replaying a put or delete twice is harmless
+	sequence := walSequence()
+	snapshot := Snapshot{
+		Version:           snapshotVersion,
+		TakenAt:           time.Now().UTC(),
+		WALSequence:       sequence,
+		Strings:           allRecords(),
+		Collections:       snapshotCollections(),
+		DerivedProperties: loadDerivedProperties(),
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := json.NewEncoder(tmp).Encode(snapshot); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, err
+	}
+
+	if err := compactWAL(snapshot.WALSequence); err != nil {
+		log.Printf("compacting WAL: %v", err)
+	}
+
+	return len(snapshot.Strings), nil
+}
+
+// restoreSnapshot loads the snapshot at path into memory, skipping records
+// that expired while the service was down, and returns the number restored
+// and the last WAL sequence the snapshot covers. A missing file is not an error.
+func restoreSnapshot(path string) (int, uint64, error) {
+	snapshot, err := readSnapshot(path)
+	if err != nil || snapshot == nil {
+		return 0, 0, err
+	}
+
+	now := time.Now()
+	restored := 0
+
+	for _, data := range snapshot.Strings {
+		if data.expired(now) {
+			continue
+		}
+		shard := shardFor(data.Value)
+		shard.Lock()
+		shard.cacheLocked(data)
+		shard.Unlock()
+		restored++
+	}
+	restoreCollections(snapshot.Collections, now)
+	restoreDerivedProperties(snapshot.DerivedProperties)
+
+	return restored, snapshot.WALSequence, nil
+}
+
+// readSnapshot decodes the snapshot at path, or returns nil if there is none
+func readSnapshot(path string) (*Snapshot, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var snapshot Snapshot
+	if err := json.NewDecoder(file).Decode(&snapshot); err != nil {
+		return nil, err
+	}
+	if snapshot.Version != snapshotVersion {
+		return nil, errors.New("unsupported snapshot version")
+	}
+	return &snapshot, nil
+}
+
+// runSnapshots writes a snapshot every interval until ctx is done
+func runSnapshots(ctx context.Context, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := writeSnapshot(path); err != nil {
+				log.Printf("writing snapshot to %s: %v", path, err)
+			}
+		}
+	}
+}
+
+// takeSnapshot handles POST /admin/snapshot
+func takeSnapshot(c *fiber.Ctx) error {
+	if config.SnapshotPath == "" {
+		return fiber.NewError(fiber.StatusConflict, "Snapshots are disabled; set SNAPSHOT_PATH")
+	}
+
+	written, err := writeSnapshot(config.SnapshotPath)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"path":    config.SnapshotPath,
+		"strings": written,
+	})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// restoreString handles POST /strings/:id/restore, bringing back the
+// soft-deleted string with that ID. It keeps its created_at and gets a new
+// updated_at.
+func restoreString(c *fiber.Ctx) error {
+	trashed := findDeletedByID(c.Params("id"))
+	if trashed == nil {
+		return fiber.NewError(fiber.StatusNotFound, "No deleted string with this ID")
+	}
+
+	shard := shardFor(trashed.Value)
+	shard.Lock()
+	current, deleted := shard.deleted[trashed.Value]
+	if !deleted {
+		shard.Unlock()
+		return fiber.NewError(fiber.StatusNotFound, "No deleted string with this ID")
+	}
+
+	restored := *current
+	restored.DeletedAt = nil
+	restored.UpdatedAt = time.Now().UTC()
+	shard.putLocked(&restored)
+	shard.Unlock()
+
+	publishEvent(Event{
+		Type:   eventStringRestored,
+		ID:     restored.ID,
+		Value:  restored.Value,
+		Actor:  requestActor(c),
+		before: current,
+		after:  &restored,
+	})
+
+	return c.JSON(&restored)
+}
+
+// findDeletedByID returns the soft-deleted string with a record ID, as
+// given or lowercased, or nil
+func findDeletedByID(id string) *StringData {
+	for _, candidate := range []string{id, strings.ToLower(id)} {
+		for _, shard := range shards {
+			shard.RLock()
+			if value, ok := shard.deletedIDs[candidate]; ok {
+				data := shard.deleted[value]
+				shard.RUnlock()
+				return data
+			}
+			shard.RUnlock()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import "strings"
+
+// cardinalityStats tracks value distributions used to estimate filter selectivity
+type cardinalityStats struct {
+	total       int
+	palindromes int
+	wordCounts  map[int]int
+	lengths     map[int]int
+	characters  map[string]int
+	tags        map[string]int
+}
+
+func newCardinalityStats() *cardinalityStats {
+	return &cardinalityStats{
+		wordCounts: make(map[int]int),
+		lengths:    make(map[int]int),
+		characters: make(map[string]int),
+		tags:       make(map[string]int),
+	}
+}
+
+// add records a newly stored string
+func (s *cardinalityStats) add(data *StringData) {
+	s.update(data, 1)
+}
+
+// remove forgets a deleted string
+func (s *cardinalityStats) remove(data *StringData) {
+	s.update(data, -1)
+}
+
+func (s *cardinalityStats) update(data *StringData, delta int) {
+	s.total += delta
+	if data.Properties.IsPalindrome {
+		s.palindromes += delta
+	}
+
+	adjust(s.wordCounts, data.Properties.WordCount, delta)
+	adjust(s.lengths, data.Properties.Length, delta)
+
+	seen := make(map[string]bool)
+	for _, char := range strings.ToLower(searchableCharacters(data)) {
+		key := string(char)
+		if !seen[key] {
+			seen[key] = true
+			adjust(s.characters, key, delta)
+		}
+	}
+
+	for _, tag := range data.Tags {
+		adjust(s.tags, tag, delta)
+	}
+}
+
+// mergedStats sums the statistics of every shard, reading one shard at a time
+func mergedStats() *cardinalityStats {
+	merged := newCardinalityStats()
+	for _, shard := range shards {
+		shard.RLock()
+		merged.total += shard.stats.total
+		merged.palindromes += shard.stats.palindromes
+		for k, n := range shard.stats.wordCounts {
+			merged.wordCounts[k] += n
+		}
+		for k, n := range shard.stats.lengths {
+			merged.lengths[k] += n
+		}
+		for k, n := range shard.stats.characters {
+			merged.characters[k] += n
+		}
+		for k, n := range shard.stats.tags {
+			merged.tags[k] += n
+		}
+		shard.RUnlock()
+	}
+	return merged
+}
+
+// countLengths sums the number of strings whose length satisfies keep
+func (s *cardinalityStats) countLengths(keep func(length int) bool) int {
+	count := 0
+	for length, n := range s.lengths {
+		if keep(length) {
+			count += n
+		}
+	}
+	return count
+}
+
+// adjust applies delta to a counter, dropping it once it reaches zero
+func adjust[K comparable](counts map[K]int, key K, delta int) {
+	counts[key] += delta
+	if counts[key] <= 0 {
+		delete(counts, key)
+	}
+}
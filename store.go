@@ -0,0 +1,292 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// storeShardCount is how many independently locked shards the store is
+// split into. Values are assigned to shards by hash.
+const storeShardCount = 64
+
+// storeShard holds part of the stored strings together with the indexes
+// over them, so writers to different shards never contend and a scan only
+// holds up writers to the shard it is reading. Code needing several shards
+// at once must lock them in index order, and must not wait on a shard lock
+// while holding another one otherwise.
+type storeShard struct {
+	sync.RWMutex
+	records    map[string]*StringData
+	stats      *cardinalityStats
+	equivalent valueIndex
+	anagrams   valueIndex
+	hashes     []hashEntry
+	values     []string
+	filters    filterIndexes
+	ids        map[string]string
+	aliases    map[string]string
+	usage      map[string]*accessEntry
+	// deleted holds soft-deleted strings, kept out of records and the
+	// indexes until they are restored or purged
+	deleted    map[string]*StringData
+	deletedIDs map[string]string
+}
+
+// shards is the in-memory store
+var shards = newStoreShards()
+
+// storeCount and storeBytes total the strings and value bytes held across
+// all shards. storeGeneration is bumped on every change to any shard, so
+// listings can tell whether anything changed.
+var (
+	storeCount      atomic.Int64
+	storeBytes      atomic.Int64
+	storeGeneration atomic.Uint64
+)
+
+func newStoreShards() []*storeShard {
+	shards := make([]*storeShard, storeShardCount)
+	for i := range shards {
+		shards[i] = &storeShard{
+			records:    make(map[string]*StringData),
+			stats:      newCardinalityStats(),
+			equivalent: make(valueIndex),
+			anagrams:   make(valueIndex),
+			filters:    newFilterIndexes(),
+			ids:        make(map[string]string),
+			aliases:    make(map[string]string),
+			usage:      make(map[string]*accessEntry),
+			deleted:    make(map[string]*StringData),
+			deletedIDs: make(map[string]string),
+		}
+	}
+	return shards
+}
+
+// shardFor returns the shard a value is stored in
+func shardFor(value string) *storeShard {
+	return shards[shardIndex(value)]
+}
+
+// shardIndex returns the position in shards of the shard a value is stored in
+func shardIndex(value string) uint64 {
+	return xxhash.Sum64String(value) % storeShardCount
+}
+
+// lockValues write-locks the shards holding two values, in index order, and
+// returns a function releasing them
+func lockValues(a, b string) func() {
+	first, second := shardIndex(a), shardIndex(b)
+	if first > second {
+		first, second = second, first
+	}
+
+	shards[first].Lock()
+	if second == first {
+		return shards[first].Unlock
+	}
+	shards[second].Lock()
+	return func() {
+		shards[second].Unlock()
+		shards[first].Unlock()
+	}
+}
+
+// lockAllShards write-locks every shard, for admin operations that must see
+// and change the whole store at once
+func lockAllShards() {
+	for _, shard := range shards {
+		shard.Lock()
+	}
+}
+
+// unlockAllShards releases the locks taken by lockAllShards
+func unlockAllShards() {
+	for _, shard := range shards {
+		shard.Unlock()
+	}
+}
+
+// allRecords returns every stored string, expired and soft-deleted ones
+// included, reading one shard at a time. Records are replaced rather than mutated, so copying
+// the pointers is enough.
+func allRecords() []*StringData {
+	records := make([]*StringData, 0, storeCount.Load())
+	for _, shard := range shards {
+		shard.RLock()
+		for _, data := range shard.records {
+			records = append(records, data)
+		}
+		for _, data := range shard.deleted {
+			records = append(records, data)
+		}
+		shard.RUnlock()
+	}
+	return records
+}
+
+// allRecordsLocked is allRecords for callers already holding every shard
+// lock through lockAllShards
+func allRecordsLocked() []*StringData {
+	records := make([]*StringData, 0, storeCount.Load())
+	for _, shard := range shards {
+		for _, data := range shard.records {
+			records = append(records, data)
+		}
+		for _, data := range shard.deleted {
+			records = append(records, data)
+		}
+	}
+	return records
+}
+
+// lookup returns the stored record for a value, counting the read as a use
+// for eviction
+func lookup(value string) (*StringData, bool) {
+	shard := shardFor(value)
+
+	shard.RLock()
+	defer shard.RUnlock()
+
+	data, exists := shard.records[value]
+	shard.touchLocked(value)
+	return data, exists
+}
+
+// lookupIDs resolves record IDs to their stored records, reading each shard
+// once. IDs that are not stored are left out. Every read counts as a use for
+// eviction.
+func lookupIDs(ids []string) map[string]*StringData {
+	found := make(map[string]*StringData, len(ids))
+	if len(ids) == 0 {
+		return found
+	}
+
+	for _, shard := range shards {
+		shard.RLock()
+		for _, id := range ids {
+			if value, ok := shard.ids[id]; ok {
+				found[id] = shard.records[value]
+				shard.touchLocked(value)
+			}
+		}
+		shard.RUnlock()
+	}
+	return found
+}
+
+// expired reports whether a record's TTL has run out. Expired records are
+// treated as absent until they are removed.
+func (data *StringData) expired(now time.Time) bool {
+	return data.ExpiresAt != nil && !now.Before(*data.ExpiresAt)
+}
+
+// modifiedAt returns when a record was last written, falling back to its
+// creation time for records stored before updates were tracked
+func (data *StringData) modifiedAt() time.Time {
+	if data.UpdatedAt.IsZero() {
+		return data.CreatedAt
+	}
+	return data.UpdatedAt
+}
+
+// putLocked stores a string, updates derived statistics, logs it to the
+// WAL and queues the write for the backend. Caller must hold the shard lock.
+func (s *storeShard) putLocked(data *StringData) {
+	s.cacheLocked(data)
+	appendWAL(data.Value, data)
+	queuePersist(data.Value, data)
+}
+
+// removeLocked deletes a string for good, soft-deleted or not, updates
+// derived statistics, logs it to the WAL and queues the delete for the
+// backend. Caller must hold the shard lock.
+func (s *storeShard) removeLocked(value string) {
+	_, exists := s.records[value]
+	if _, deleted := s.deleted[value]; exists || deleted {
+		s.uncacheLocked(value)
+		appendWAL(value, nil)
+		queuePersist(value, nil)
+	}
+}
+
+// cacheLocked stores a string in memory only, for records that came from
+// the backend, evicting others if the store is over its cap. Soft-deleted
+// records go to the shard's deleted strings instead. Caller must hold the
+// shard lock.
+func (s *storeShard) cacheLocked(data *StringData) {
+	storeGeneration.Add(1)
+	if data.DeletedAt != nil {
+		s.uncacheLocked(data.Value)
+		s.deleted[data.Value] = data
+		s.deletedIDs[data.ID] = data.Value
+		return
+	}
+	if trashed, deleted := s.deleted[data.Value]; deleted {
+		delete(s.deleted, data.Value)
+		delete(s.deletedIDs, trashed.ID)
+	}
+	// Encrypted strings saved before their plaintext hash and character
+	// frequencies were dropped lose them on load
+	if data.Encoding == encodingEncrypted {
+		redactPlaintextProperties(&data.Properties)
+	}
+
+	if existing, exists := s.records[data.Value]; exists {
+		s.unindexLocked(existing)
+	} else {
+		storeCount.Add(1)
+	}
+	s.records[data.Value] = data
+	s.stats.add(data)
+	s.indexDuplicatesLocked(data)
+	s.indexHashLocked(data)
+	s.indexValueLocked(data.Value)
+	s.indexFiltersLocked(data)
+	s.ids[data.ID] = data.Value
+	s.indexAliasesLocked(data)
+	s.trackLocked(data)
+	s.enforceLimitsLocked(data.Value)
+}
+
+// uncacheLocked drops a string, soft-deleted or not, from memory only.
+// Caller must hold the shard lock.
+func (s *storeShard) uncacheLocked(value string) {
+	storeGeneration.Add(1)
+	if trashed, deleted := s.deleted[value]; deleted {
+		delete(s.deleted, value)
+		delete(s.deletedIDs, trashed.ID)
+	}
+	if existing, exists := s.records[value]; exists {
+		s.unindexLocked(existing)
+		s.untrackLocked(value)
+		delete(s.records, value)
+		storeCount.Add(-1)
+	}
+}
+
+// unindexLocked removes a record from the shard's indexes. Caller must hold
+// the shard lock.
+func (s *storeShard) unindexLocked(data *StringData) {
+	s.stats.remove(data)
+	s.unindexDuplicatesLocked(data)
+	s.unindexHashLocked(data)
+	s.unindexValueLocked(data.Value)
+	s.unindexFiltersLocked(data)
+	delete(s.ids, data.ID)
+	for _, alias := range data.Aliases {
+		delete(s.aliases, alias)
+	}
+}
+
+// liveRecordLocked returns the stored record for a value unless it is
+// missing or expired. Caller must hold the shard lock.
+func (s *storeShard) liveRecordLocked(value string) *StringData {
+	if data := s.records[value]; data != nil && !data.expired(time.Now()) {
+		return data
+	}
+	return nil
+}
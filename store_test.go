@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+	"testing"
+)
+
+// benchWriters is how many goroutines per CPU the parallel benchmarks run,
+// enough for well over 100 concurrent writers
+const benchWriters = 128
+
+// benchWords make up the values the benchmarks store
+var benchWords = []string{"level", "apple", "stone", "radar", "quick", "brown", "fox", "noon", "jumps", "over"}
+
+func TestMain(m *testing.M) {
+	if err := loadLanguagePacks(""); err != nil {
+		log.Fatalf("loading language packs: %v", err)
+	}
+	profile, err := newAnalysisProfile(defaultAnalysisConfig())
+	if err != nil {
+		log.Fatalf("invalid analysis configuration: %v", err)
+	}
+	defaultProfile.Store(profile)
+
+	os.Exit(m.Run())
+}
+
+// resetStore empties the in-memory store
+func resetStore(tb testing.TB) {
+	tb.Helper()
+	shards = newStoreShards()
+	storeCount.Store(0)
+	storeBytes.Store(0)
+}
+
+// benchValue returns the i-th distinct value the benchmarks store
+func benchValue(i int) string {
+	return fmt.Sprintf("%s %s %d", benchWords[i%len(benchWords)], benchWords[i/len(benchWords)%len(benchWords)], i)
+}
+
+// storeValue creates a value the way POST /strings does
+func storeValue(value string) error {
+	_, err := createValue(context.Background(), CreateStringRequest{Value: value}, createOptions{
+		duplicatePolicy: duplicatePolicyOff,
+		onConflict:      onConflictError,
+	})
+	if err != nil {
+		return fmt.Errorf("creating %q: %w", value, err)
+	}
+	return nil
+}
+
+// fillStore stores n benchmark values, starting from an empty store
+func fillStore(tb testing.TB, n int) {
+	tb.Helper()
+	resetStore(tb)
+	for i := 0; i < n; i++ {
+		if err := storeValue(benchValue(i)); err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkCreateParallel creates distinct values from every writer
+func BenchmarkCreateParallel(b *testing.B) {
+	fillStore(b, 20000)
+	var next atomic.Int64
+	next.Store(20000)
+
+	b.SetParallelism(benchWriters)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := storeValue(benchValue(int(next.Add(1)))); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkReadWriteParallel mixes lookups with one create in ten
+func BenchmarkReadWriteParallel(b *testing.B) {
+	const stored = 20000
+	fillStore(b, stored)
+	var next, ops atomic.Int64
+	next.Store(stored)
+
+	b.SetParallelism(benchWriters)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		ctx := context.Background()
+		for pb.Next() {
+			n := ops.Add(1)
+			if n%10 == 0 {
+				if err := storeValue(benchValue(int(next.Add(1)))); err != nil {
+					b.Error(err)
+					return
+				}
+				continue
+			}
+			if data, err := findString(ctx, benchValue(int(n%stored))); err != nil || data == nil {
+				b.Errorf("looking up stored value %d: %v", n%stored, err)
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkScanWhileWritingParallel creates values while one operation in
+// ten lists palindromes, scans holding one shard lock at a time
+func BenchmarkScanWhileWritingParallel(b *testing.B) {
+	fillStore(b, 20000)
+	var next, ops atomic.Int64
+	next.Store(20000)
+	plan := planFilters(map[string]interface{}{"is_palindrome": true})
+
+	b.SetParallelism(benchWriters)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		ctx := context.Background()
+		for pb.Next() {
+			if ops.Add(1)%10 != 0 {
+				if err := storeValue(benchValue(int(next.Add(1)))); err != nil {
+					b.Error(err)
+					return
+				}
+				continue
+			}
+			if _, _, err := plan.collect(ctx, 0, nil); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"unicode"
+)
+
+// isSentenceEnd reports whether r ends a sentence: a period, question or
+// exclamation mark, an ellipsis, or their full-width forms
+func isSentenceEnd(r rune) bool {
+	return strings.ContainsRune(".?!…。？！", r)
+}
+
+// analyzeStructure counts the sentences and lines of a value
+func analyzeStructure(_ context.Context, value string, p *StringProperties, _ *analysisProfile) {
+	p.SentenceCount = countSentences(value)
+	p.LineCount = countLines(value)
+}
+
+// countSentences counts runs of text containing a letter or digit that end
+// at sentence punctuation or at the end of the value. Punctuation directly
+// followed by a letter or digit, as in 3.14 or example.com, does not end a
+// sentence, and repeated marks ("?!", "...") end just one.
+func countSentences(value string) int {
+	runes := []rune(value)
+	count, inSentence := 0, false
+	for i, r := range runes {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			inSentence = true
+		case isSentenceEnd(r) && inSentence:
+			if i+1 < len(runes) && (unicode.IsLetter(runes[i+1]) || unicode.IsDigit(runes[i+1])) {
+				continue
+			}
+			count++
+			inSentence = false
+		}
+	}
+	if inSentence {
+		count++
+	}
+	return count
+}
+
+// countLines counts the lines of a value, split at \n, \r\n or \r. A
+// trailing line break does not start another line and "" has none.
+func countLines(value string) int {
+	if value == "" {
+		return 0
+	}
+	value = strings.ReplaceAll(value, "\r\n", "\n")
+	lines := strings.Count(value, "\n") + strings.Count(value, "\r") + 1
+	if strings.HasSuffix(value, "\n") || strings.HasSuffix(value, "\r") {
+		lines--
+	}
+	return lines
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Limits on the tags of one string
+const (
+	maxTags      = 32
+	maxTagLength = 64
+)
+
+// PatchStringRequest represents the request body for PATCH /strings/:id.
+// Fields left out are unchanged.
+type PatchStringRequest struct {
+	// Tags replaces the string's tags
+	Tags *[]string `json:"tags"`
+	// Metadata is merged into the string's metadata: keys set to null are
+	// removed and null clears it (RFC 7386)
+	Metadata json.RawMessage `json:"metadata"`
+}
+
+// patchString handles PATCH /strings/:id, editing the tags and metadata of
+// the string with that ID. The value and its analysis are unchanged.
+func patchString(c *fiber.Ctx) error {
+	var req PatchStringRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	var tags []string
+	if req.Tags != nil {
+		var err error
+		if tags, err = normalizeTags(*req.Tags); err != nil {
+			return err
+		}
+	}
+
+	var patch map[string]interface{}
+	clearMetadata := string(req.Metadata) == "null"
+	if len(req.Metadata) > 0 && !clearMetadata {
+		if err := json.Unmarshal(req.Metadata, &patch); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "'metadata' must be an object")
+		}
+	}
+
+	found, err := findByID(c, c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	shard := shardFor(found.Value)
+	shard.Lock()
+	current := shard.liveRecordLocked(found.Value)
+	if current == nil {
+		shard.Unlock()
+		return fiber.NewError(fiber.StatusNotFound, "String does not exist in the system")
+	}
+	if current.Pinned {
+		shard.Unlock()
+		return errPinned
+	}
+	if err := checkIfMatch(c, current); err != nil {
+		shard.Unlock()
+		return err
+	}
+
+	updated := *current
+	if req.Tags != nil {
+		updated.Tags = tags
+	}
+	switch {
+	case clearMetadata:
+		updated.Metadata = nil
+	case patch != nil:
+		updated.Metadata = mergeMetadata(current.Metadata, patch)
+	}
+	updated.UpdatedAt = time.Now().UTC()
+	shard.putLocked(&updated)
+	shard.Unlock()
+
+	publishEvent(Event{
+		Type:   eventStringUpdated,
+		ID:     updated.ID,
+		Value:  updated.Value,
+		Actor:  requestActor(c),
+		before: current,
+		after:  &updated,
+	})
+
+	return sendRecord(c, &updated)
+}
+
+// normalizeTags trims and lowercases tags, dropping repeats, and checks
+// them against the limits
+func normalizeTags(tags []string) ([]string, error) {
+	if len(tags) > maxTags {
+		return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("A string can have at most %d tags", maxTags))
+	}
+
+	var normalized []string
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || len(tag) > maxTagLength {
+			return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Tags must be 1 to %d characters", maxTagLength))
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized, nil
+}
+
+// mergeMetadata applies a JSON merge patch to metadata without changing it,
+// recursing into nested objects
+func mergeMetadata(metadata, patch map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(metadata)+len(patch))
+	for key, val := range metadata {
+		merged[key] = val
+	}
+
+	for key, val := range patch {
+		switch val := val.(type) {
+		case nil:
+			delete(merged, key)
+		case map[string]interface{}:
+			existing, _ := merged[key].(map[string]interface{})
+			merged[key] = mergeMetadata(existing, val)
+		default:
+			merged[key] = val
+		}
+	}
+
+	if len(merged) == 0 {
+		return nil
+	}
+	return merged
+}
+
+// hasTag reports whether a string carries a tag
+func (data *StringData) hasTag(tag string) bool {
+	for _, t := range data.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/rivo/uniseg"
+)
+
+// Tokenizer splits a value into words. The tokenizer chosen by the analysis
+// config is used by word_count and every word-based filter so they always agree.
+type Tokenizer interface {
+	Name() string
+	Tokenize(s string) []string
+}
+
+// whitespaceTokenizer splits on runs of Unicode whitespace
+type whitespaceTokenizer struct{}
+
+func (whitespaceTokenizer) Name() string { return "whitespace" }
+
+func (whitespaceTokenizer) Tokenize(s string) []string {
+	return strings.Fields(s)
+}
+
+// unicodeTokenizer follows the Unicode word boundary rules (UAX #29),
+// keeping only segments that contain a letter or digit
+type unicodeTokenizer struct{}
+
+func (unicodeTokenizer) Name() string { return "unicode" }
+
+func (unicodeTokenizer) Tokenize(s string) []string {
+	var words []string
+	state := -1
+	for len(s) > 0 {
+		var word string
+		word, s, state = uniseg.FirstWordInString(s, state)
+		if strings.IndexFunc(word, isWordRune) >= 0 {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// regexTokenizer splits on matches of a delimiter pattern
+type regexTokenizer struct {
+	delimiter *regexp.Regexp
+}
+
+func (t regexTokenizer) Name() string { return "regex:" + t.delimiter.String() }
+
+func (t regexTokenizer) Tokenize(s string) []string {
+	var words []string
+	for _, word := range t.delimiter.Split(s, -1) {
+		if word = strings.TrimSpace(word); word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// tokenizers caches tokenizers by name so regex patterns compile once
+var (
+	tokenizers   = make(map[string]Tokenizer)
+	tokenizersMu sync.Mutex
+)
+
+// tokenizerByName returns the cached tokenizer for a name, building it on
+// first use. Records analyzed before tokenizers were recorded use whitespace.
+func tokenizerByName(name string) (Tokenizer, error) {
+	if name == "" {
+		name = "whitespace"
+	}
+
+	tokenizersMu.Lock()
+	defer tokenizersMu.Unlock()
+
+	if tokenizer, ok := tokenizers[name]; ok {
+		return tokenizer, nil
+	}
+
+	tokenizer, err := newTokenizer(name)
+	if err != nil {
+		return nil, err
+	}
+	tokenizers[name] = tokenizer
+	return tokenizer, nil
+}
+
+// newTokenizer builds a tokenizer from its name: whitespace, unicode or
+// regex:<delimiter pattern>
+func newTokenizer(spec string) (Tokenizer, error) {
+	switch {
+	case spec == "whitespace":
+		return whitespaceTokenizer{}, nil
+	case spec == "unicode":
+		return unicodeTokenizer{}, nil
+	case strings.HasPrefix(spec, "regex:"):
+		delimiter, err := regexp.Compile(strings.TrimPrefix(spec, "regex:"))
+		if err != nil {
+			return nil, err
+		}
+		return regexTokenizer{delimiter: delimiter}, nil
+	default:
+		return nil, fmt.Errorf("unknown tokenizer %q", spec)
+	}
+}
+
+// isWordRune reports whether a rune can be part of a word
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
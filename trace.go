@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// QueryTrace explains how a listing was evaluated, returned with ?debug=true
+// to help tune slow queries
+type QueryTrace struct {
+	// IndexesUsed names the indexes consulted; cardinality_stats orders the
+	// filters, and the index of the most selective filter that has one
+	// supplies the candidates instead of a full scan
+	IndexesUsed       []string      `json:"indexes_used"`
+	Access            string        `json:"access"`
+	ShardsScanned     int           `json:"shards_scanned"`
+	CandidatesScanned int           `json:"candidates_scanned"`
+	ExpiredSkipped    int           `json:"expired_skipped"`
+	Matched           int           `json:"matched"`
+	Filters           []FilterTrace `json:"filters"`
+	Timing            TraceTiming   `json:"timing"`
+	// lockWait accumulates the time spent acquiring shard locks
+	lockWait time.Duration
+}
+
+// FilterTrace counts the records a filter was evaluated against and how many
+// passed it. Filters run in plan order, so a record failing one is never
+// evaluated against the rest.
+type FilterTrace struct {
+	Filter    string `json:"filter"`
+	Evaluated int    `json:"evaluated"`
+	Matched   int    `json:"matched"`
+}
+
+// TraceTiming breaks the time spent on a listing down in microseconds.
+// Encoding the response is not included.
+type TraceTiming struct {
+	PlanningMicros int64 `json:"planning_us"`
+	LockWaitMicros int64 `json:"lock_wait_us"`
+	ScanMicros     int64 `json:"scan_us"`
+	TotalMicros    int64 `json:"total_us"`
+}
+
+// queryOptions are the settings of a listing besides its filters
+type queryOptions struct {
+	// limit and offset select the page returned; a limit of zero or less
+	// returns every match after offset
+	limit  int
+	offset int
+	// after starts the page after a cursor instead of at offset
+	after *listCursor
+	// order sorts the matches before the page is taken
+	order []sortKey
+	// sample returns a random sample of this many matches instead of a page
+	sample int
+	// debug traces the evaluation
+	debug bool
+	// includeDeleted lists soft-deleted strings too
+	includeDeleted bool
+}
+
+// queryResult is the page of a listing selected by queryOptions
+type queryResult struct {
+	data  []StringData
+	total int
+	// truncated is set when matches remain after the page
+	truncated bool
+}
+
+// runQuery plans filters and collects the page (or sample) of matching
+// strings selected by opts, in opts.order and then creation order, together
+// with the total number of matches. A trace of the evaluation is returned
+// when opts.debug is set.
+func runQuery(ctx context.Context, filters map[string]interface{}, opts queryOptions) (queryPlan, queryResult, *QueryTrace, error) {
+	start := time.Now()
+	plan := planFilters(filters)
+	plan.includeDeleted = opts.includeDeleted
+
+	var trace *QueryTrace
+	if opts.debug {
+		trace = &QueryTrace{
+			IndexesUsed: []string{},
+			Access:      "full_scan",
+			Filters:     make([]FilterTrace, len(plan.steps)),
+		}
+		if len(plan.steps) > 0 {
+			trace.IndexesUsed = append(trace.IndexesUsed, "cardinality_stats")
+		}
+		if plan.access != "" {
+			trace.IndexesUsed = append(trace.IndexesUsed, plan.access)
+			trace.Access = "index_scan"
+			if plan.access == indexValue {
+				trace.Access = "value_range_scan"
+			}
+		}
+		for i, step := range plan.steps {
+			trace.Filters[i].Filter = step.Filter
+		}
+		trace.Timing.PlanningMicros = time.Since(start).Microseconds()
+	}
+
+	scanStart := time.Now()
+	matches, total, err := plan.collect(ctx, opts.sample, trace)
+	if err != nil {
+		return plan, queryResult{}, trace, err
+	}
+	sortRecords(matches, opts.order)
+
+	var result queryResult
+	if opts.sample > 0 {
+		result = pageRecords(matches, 0, 0)
+		result.total = total
+	} else {
+		offset := opts.offset
+		if opts.after != nil {
+			offset = sort.Search(len(matches), func(i int) bool { return opts.after.precedes(matches[i]) })
+		}
+		result = pageRecords(matches, opts.limit, offset)
+	}
+
+	if trace != nil {
+		trace.Matched = total
+		trace.Timing.LockWaitMicros = trace.lockWait.Microseconds()
+		trace.Timing.ScanMicros = (time.Since(scanStart) - trace.lockWait).Microseconds()
+		trace.Timing.TotalMicros = time.Since(start).Microseconds()
+	}
+
+	return plan, result, trace, nil
+}
+
+// matchesTraced is matches, counting each filter's evaluations on trace
+func (p queryPlan) matchesTraced(data *StringData, trace *QueryTrace) bool {
+	for i, spec := range p.specs {
+		trace.Filters[i].Evaluated++
+		if !spec.match(data, p.steps[i].Value) {
+			return false
+		}
+		trace.Filters[i].Matched++
+	}
+	return true
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TransformRequest represents the request body for POST /transform
+type TransformRequest struct {
+	Value     string `json:"value"`
+	Operation string `json:"operation"`
+	Shift     int    `json:"shift"`
+}
+
+// TransformResponse represents the result of a transform
+type TransformResponse struct {
+	Operation string `json:"operation"`
+	Input     string `json:"input"`
+	Output    string `json:"output"`
+}
+
+// transforms maps operation names to their implementations
+var transforms = map[string]func(req TransformRequest) (string, error){
+	"morse": func(req TransformRequest) (string, error) { return toMorse(req.Value), nil },
+	"nato":  func(req TransformRequest) (string, error) { return toNATO(req.Value), nil },
+	"rot13": func(req TransformRequest) (string, error) { return rot13(req.Value), nil },
+	"caesar": func(req TransformRequest) (string, error) {
+		if req.Shift == 0 {
+			return "", fiber.NewError(fiber.StatusBadRequest, "caesar requires a non-zero 'shift'")
+		}
+		return caesarShift(req.Value, req.Shift), nil
+	},
+}
+
+// transformString handles POST /transform
+func transformString(c *fiber.Ctx) error {
+	var req TransformRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	if req.Value == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Missing 'value' field")
+	}
+
+	transform, ok := transforms[req.Operation]
+	if !ok {
+		return fiber.NewError(fiber.StatusBadRequest, "Unsupported operation '"+req.Operation+"'")
+	}
+
+	output, err := transform(req)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(TransformResponse{
+		Operation: req.Operation,
+		Input:     req.Value,
+		Output:    output,
+	})
+}
+
+var morseCode = map[rune]string{
+	'a': ".-", 'b': "-...", 'c': "-.-.", 'd': "-..", 'e': ".", 'f': "..-.", 'g': "--.", 'h': "....",
+	'i': "..", 'j': ".---", 'k': "-.-", 'l': ".-..", 'm': "--", 'n': "-.", 'o': "---", 'p': ".--.",
+	'q': "--.-", 'r': ".-.", 's': "...", 't': "-", 'u': "..-", 'v': "...-", 'w': ".--", 'x': "-..-",
+	'y': "-.--", 'z': "--..",
+	'0': "-----", '1': ".----", '2': "..---", '3': "...--", '4': "....-", '5': ".....", '6': "-....",
+	'7': "--...", '8': "---..", '9': "----.",
+	'.': ".-.-.-", ',': "--..--", '?': "..--..", '\'': ".----.", '!': "-.-.--", '/': "-..-.",
+	'(': "-.--.", ')': "-.--.-", '&': ".-...", ':': "---...", ';': "-.-.-.", '=': "-...-",
+	'+': ".-.-.", '-': "-....-", '_': "..--.-", '"': ".-..-.", '$': "...-..-", '@': ".--.-.",
+}
+
+var natoAlphabet = map[rune]string{
+	'a': "Alfa", 'b': "Bravo", 'c': "Charlie", 'd': "Delta", 'e': "Echo", 'f': "Foxtrot", 'g': "Golf",
+	'h': "Hotel", 'i': "India", 'j': "Juliett", 'k': "Kilo", 'l': "Lima", 'm': "Mike", 'n': "November",
+	'o': "Oscar", 'p': "Papa", 'q': "Quebec", 'r': "Romeo", 's': "Sierra", 't': "Tango", 'u': "Uniform",
+	'v': "Victor", 'w': "Whiskey", 'x': "X-ray", 'y': "Yankee", 'z': "Zulu",
+	'0': "Zero", '1': "One", '2': "Two", '3': "Three", '4': "Four", '5': "Five", '6': "Six",
+	'7': "Seven", '8': "Eight", '9': "Nine",
+}
+
+// toMorse renders a string in Morse code: letters separated by spaces and
+// words by " / ". Characters without a Morse code are kept as-is.
+func toMorse(s string) string {
+	return spellOut(s, morseCode, " / ")
+}
+
+// toNATO spells a string with the NATO phonetic alphabet, words separated
+// by " / ". Characters without a code word are kept as-is.
+func toNATO(s string) string {
+	return spellOut(s, natoAlphabet, " / ")
+}
+
+// spellOut replaces each character of every word with its code from table
+func spellOut(s string, table map[rune]string, wordSeparator string) string {
+	words := strings.Fields(s)
+	spelled := make([]string, 0, len(words))
+
+	for _, word := range words {
+		codes := make([]string, 0, len(word))
+		for _, char := range word {
+			if code, ok := table[unicode.ToLower(char)]; ok {
+				codes = append(codes, code)
+			} else {
+				codes = append(codes, string(char))
+			}
+		}
+		spelled = append(spelled, strings.Join(codes, " "))
+	}
+
+	return strings.Join(spelled, wordSeparator)
+}
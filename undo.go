@@ -0,0 +1,109 @@
+package main
+
+import "github.com/gofiber/fiber/v2"
+
+// UndoResponse represents the response for POST /admin/undo-last
+type UndoResponse struct {
+	Undone Event       `json:"undone"`
+	Data   *StringData `json:"data,omitempty"`
+}
+
+// undoLast handles POST /admin/undo-last?actor=, reversing the most recent
+// mutation by an actor (as reported on /events) that has not been undone.
+// Only mutations still in the event log can be reversed, and a mutation
+// is refused when the string has changed since.
+func undoLast(c *fiber.Ctx) error {
+	actor := c.Query("actor")
+	if actor == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Missing 'actor' parameter")
+	}
+
+	eventLog.Lock()
+	var target *Event
+	for i := len(eventLog.events) - 1; i >= 0; i-- {
+		event := eventLog.events[i]
+		if event.Actor == actor && event.Undoes == 0 && !eventLog.undone[event.Sequence] {
+			target = &event
+			break
+		}
+	}
+	eventLog.Unlock()
+
+	if target == nil {
+		return fiber.NewError(fiber.StatusNotFound, "No mutation by this actor left to undo")
+	}
+
+	// An update may have moved the string to a new value, so undoing it
+	// restores the previous value in its own shard
+	restoreValue := target.Value
+	if target.before != nil {
+		restoreValue = target.before.Value
+	}
+
+	unlock := lockValues(target.Value, restoreValue)
+	shard := shardFor(target.Value)
+	current, exists := shard.records[target.Value]
+	if !exists {
+		current = shard.deleted[target.Value]
+	}
+	if current != target.after {
+		unlock()
+		return fiber.NewError(fiber.StatusConflict, "String has changed since this mutation; undo refused")
+	}
+	if restoreValue != target.Value && shardFor(restoreValue).liveRecordLocked(restoreValue) != nil {
+		unlock()
+		return fiber.NewError(fiber.StatusConflict, "Previous value has been stored again since this mutation; undo refused")
+	}
+	if target.before != nil {
+		if restoreValue != target.Value {
+			shard.removeLocked(target.Value)
+		}
+		shardFor(restoreValue).putLocked(target.before)
+	} else {
+		shard.removeLocked(target.Value)
+	}
+	unlock()
+
+	eventLog.Lock()
+	if eventLog.undone == nil {
+		eventLog.undone = make(map[int64]bool)
+	}
+	eventLog.undone[target.Sequence] = true
+	eventLog.Unlock()
+
+	// Publish the reversal itself so feed consumers stay in sync
+	reversal := Event{
+		ID:     target.ID,
+		Value:  target.Value,
+		Actor:  requestActor(c),
+		Undoes: target.Sequence,
+		before: target.after,
+		after:  target.before,
+	}
+	switch {
+	case target.before == nil:
+		reversal.Type = eventStringDeleted
+	case target.after == nil && target.before.DeletedAt != nil:
+		// Undoing a purge of a soft-deleted string leaves it deleted
+		reversal.Type = eventStringDeleted
+	case target.after == nil:
+		reversal.Type = eventStringCreated
+	case target.Type == eventStringDeleted:
+		reversal.Type = eventStringRestored
+	case target.Type == eventStringRestored:
+		reversal.Type = eventStringDeleted
+	case target.Type == eventStringUpdated:
+		reversal.Type = eventStringUpdated
+		reversal.ID, reversal.Value, reversal.PreviousValue = target.before.ID, target.before.Value, target.Value
+		reversal.Changes = propertyDiff(target.after.Properties, target.before.Properties)
+	default:
+		reversal.Type = eventPropertiesChanged
+		reversal.Changes = propertyDiff(target.after.Properties, target.before.Properties)
+	}
+	publishEvent(reversal)
+
+	return c.JSON(UndoResponse{
+		Undone: *target,
+		Data:   target.before,
+	})
+}
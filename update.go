@@ -0,0 +1,90 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// updateString handles PUT /strings/:id, replacing the value of the string
+// with that ID. The body is the same as for POST /strings. The new value is
+// analyzed afresh and gets its own ID, but keeps the original created_at;
+// updated_at records the change.
+func updateString(c *fiber.Ctx) error {
+	var req CreateStringRequest
+	if err := parseCreateBody(c, &req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	existing, err := findByID(c, c.Params("id"))
+	if err != nil {
+		return err
+	}
+	if req.ID != "" && req.ID != existing.ID {
+		return fiber.NewError(fiber.StatusBadRequest, "'id' cannot be changed")
+	}
+	req.ID = ""
+
+	// Analyze the new value without storing it; another record already
+	// holding it is a conflict
+	opts := createOptions{
+		duplicatePolicy: duplicatePolicyOff,
+		onConflict:      onConflictError,
+		actor:           requestActor(c),
+		validateOnly:    true,
+	}
+	if req.Value == existing.Value {
+		opts.onConflict = onConflictReplace
+	}
+	result, err := createValue(c.UserContext(), req, opts)
+	if e, ok := err.(*createError); ok {
+		return c.Status(e.status).JSON(e.body)
+	}
+	if err != nil {
+		return err
+	}
+	updated := result.data
+
+	unlock := lockValues(existing.Value, updated.Value)
+	current := shardFor(existing.Value).liveRecordLocked(existing.Value)
+	if current == nil {
+		unlock()
+		return fiber.NewError(fiber.StatusNotFound, "String does not exist in the system")
+	}
+	if current.Pinned {
+		unlock()
+		return errPinned
+	}
+	if err := checkIfMatch(c, current); err != nil {
+		unlock()
+		return err
+	}
+	if updated.Value != current.Value && shardFor(updated.Value).liveRecordLocked(updated.Value) != nil {
+		unlock()
+		return errStringExists
+	}
+
+	updated.CreatedAt, updated.Aliases = current.CreatedAt, current.Aliases
+	if current.ClientSuppliedID {
+		updated.ID, updated.ClientSuppliedID = current.ID, true
+	}
+	updated.UpdatedAt = time.Now().UTC()
+	if updated.Value != current.Value {
+		shardFor(current.Value).removeLocked(current.Value)
+	}
+	shardFor(updated.Value).putLocked(updated)
+	unlock()
+
+	publishEvent(Event{
+		Type:          eventStringUpdated,
+		ID:            updated.ID,
+		Value:         updated.Value,
+		PreviousValue: current.Value,
+		Actor:         opts.actor,
+		Changes:       propertyDiff(current.Properties, updated.Properties),
+		before:        current,
+		after:         updated,
+	})
+
+	return sendRecord(c, updated)
+}
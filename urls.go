@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"net/mail"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// URLComponents holds the parts of a value detected as a URL
+type URLComponents struct {
+	Scheme string `json:"scheme"`
+	Host   string `json:"host"`
+	Port   string `json:"port,omitempty"`
+	Path   string `json:"path"`
+	Query  string `json:"query,omitempty"`
+	Domain string `json:"domain"`
+	TLD    string `json:"tld"`
+}
+
+// EmailComponents holds the parts of a value detected as an email address
+type EmailComponents struct {
+	LocalPart string `json:"local_part"`
+	Domain    string `json:"domain"`
+	TLD       string `json:"tld"`
+}
+
+// parseURLComponents returns the components of value if it is an absolute URL
+func parseURLComponents(value string) *URLComponents {
+	value = strings.TrimSpace(value)
+	if strings.ContainsAny(value, " \t\n") {
+		return nil
+	}
+
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Hostname() == "" {
+		return nil
+	}
+
+	host := strings.ToLower(u.Hostname())
+	domain, tld := splitDomain(host)
+
+	return &URLComponents{
+		Scheme: strings.ToLower(u.Scheme),
+		Host:   host,
+		Port:   u.Port(),
+		Path:   u.EscapedPath(),
+		Query:  u.RawQuery,
+		Domain: domain,
+		TLD:    tld,
+	}
+}
+
+// parseEmailComponents returns the components of value if it is a bare email address
+func parseEmailComponents(value string) *EmailComponents {
+	value = strings.TrimSpace(value)
+
+	addr, err := mail.ParseAddress(value)
+	if err != nil || addr.Address != value {
+		return nil
+	}
+
+	at := strings.LastIndex(addr.Address, "@")
+	host := strings.ToLower(addr.Address[at+1:])
+	if !strings.Contains(host, ".") {
+		return nil
+	}
+	_, tld := splitDomain(host)
+
+	return &EmailComponents{
+		LocalPart: addr.Address[:at],
+		Domain:    host,
+		TLD:       tld,
+	}
+}
+
+// splitDomain returns the registrable domain and public suffix of a host
+func splitDomain(host string) (string, string) {
+	tld, _ := publicsuffix.PublicSuffix(host)
+
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		domain = host
+	}
+
+	return domain, tld
+}
+
+// analyzeAddress fills URL or email components when the value is one
+func analyzeAddress(_ context.Context, value string, properties *StringProperties, _ *analysisProfile) {
+	if email := parseEmailComponents(value); email != nil {
+		properties.Email = email
+		return
+	}
+	properties.URL = parseURLComponents(value)
+}
+
+// addressHost returns the host of a URL value or the domain of an email value
+func addressHost(data *StringData) string {
+	switch {
+	case data.Properties.URL != nil:
+		return data.Properties.URL.Host
+	case data.Properties.Email != nil:
+		return data.Properties.Email.Domain
+	default:
+		return ""
+	}
+}
+
+// addressTLD returns the public suffix of a URL or email value
+func addressTLD(data *StringData) string {
+	switch {
+	case data.Properties.URL != nil:
+		return data.Properties.URL.TLD
+	case data.Properties.Email != nil:
+		return data.Properties.Email.TLD
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// StringUsage reports how often clients have re-submitted a stored string,
+// shown with ?include_usage=true. Counts are kept in memory and start over
+// when the string is removed.
+type StringUsage struct {
+	SubmissionCount uint64     `json:"submission_count"`
+	LastSubmittedAt *time.Time `json:"last_submitted_at,omitempty"`
+}
+
+// recordResubmission counts a create of a value that is already stored and
+// was not replaced
+func recordResubmission(value string) {
+	shard := shardFor(value)
+	shard.RLock()
+	if entry, exists := shard.usage[value]; exists {
+		entry.submissions.Add(1)
+		entry.lastSubmitted.Store(time.Now().UnixNano())
+	}
+	shard.RUnlock()
+}
+
+// includeUsage reports whether a request asked for usage with
+// ?include_usage=true
+func includeUsage(c *fiber.Ctx) bool {
+	return c.QueryBool("include_usage")
+}
+
+// attachUsage sets the usage of a record copy from the store
+func attachUsage(data *StringData) {
+	usage := &StringUsage{}
+
+	shard := shardFor(data.Value)
+	shard.RLock()
+	if entry, exists := shard.usage[data.Value]; exists {
+		usage.SubmissionCount = entry.submissions.Load()
+		if last := entry.lastSubmitted.Load(); last != 0 {
+			at := time.Unix(0, last).UTC()
+			usage.LastSubmittedAt = &at
+		}
+	}
+	shard.RUnlock()
+
+	data.Usage = usage
+}
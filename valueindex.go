@@ -0,0 +1,77 @@
+package main
+
+import "sort"
+
+// valueRange is a lexicographic (byte order) range of values from the
+// value_gte and value_lt filters. to is only set when bounded.
+type valueRange struct {
+	from    string
+	to      string
+	bounded bool
+}
+
+// indexValueLocked inserts a value into the shard's value index, which is
+// kept sorted so range filters are a binary search. Caller must hold the
+// shard lock.
+func (s *storeShard) indexValueLocked(value string) {
+	i := sort.SearchStrings(s.values, value)
+	if i < len(s.values) && s.values[i] == value {
+		return
+	}
+
+	s.values = append(s.values, "")
+	copy(s.values[i+1:], s.values[i:])
+	s.values[i] = value
+}
+
+// unindexValueLocked removes a value from the shard's value index. Caller
+// must hold the shard lock.
+func (s *storeShard) unindexValueLocked(value string) {
+	i := sort.SearchStrings(s.values, value)
+	if i < len(s.values) && s.values[i] == value {
+		s.values = append(s.values[:i], s.values[i+1:]...)
+	}
+}
+
+// slice returns the values of a sorted index within the range
+func (r *valueRange) slice(values []string) []string {
+	lo, hi := sort.SearchStrings(values, r.from), len(values)
+	if r.bounded {
+		hi = sort.SearchStrings(values, r.to)
+	}
+	if lo >= hi {
+		return nil
+	}
+	return values[lo:hi]
+}
+
+// countValueRange counts the stored values within a range, reading one
+// shard at a time
+func countValueRange(r valueRange) int {
+	count := 0
+	for _, shard := range shards {
+		shard.RLock()
+		count += len(r.slice(shard.values))
+		shard.RUnlock()
+	}
+	return count
+}
+
+// valueRangeFilter builds value_gte or value_lt, estimated from the value
+// index
+func valueRangeFilter(name, operator, description string, bound func(val string) valueRange, match func(value, val string) bool) filterSpec {
+	return filterSpec{
+		Name:        name,
+		Type:        "string",
+		Operator:    operator,
+		Description: description,
+		parse:       parseText,
+		match: func(data *StringData, val interface{}) bool {
+			return match(data.Value, val.(string))
+		},
+		estimate: func(stats *cardinalityStats, val interface{}) int {
+			return countValueRange(bound(val.(string)))
+		},
+		index: indexValue,
+	}
+}
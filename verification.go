@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Verification job states
+const (
+	verificationRunning   = "running"
+	verificationCompleted = "completed"
+	verificationFailed    = "failed"
+)
+
+const (
+	// maxReportedMismatches caps the mismatches a verification report lists;
+	// the count covers every one
+	maxReportedMismatches = 1000
+	// maxVerificationJobs is how many reports are kept, oldest dropped first
+	maxVerificationJobs = 20
+)
+
+// PropertyMismatch is a stored string whose properties differ from those
+// computed again from its value
+type PropertyMismatch struct {
+	ID      string                    `json:"id"`
+	Value   string                    `json:"value"`
+	Changes map[string]PropertyChange `json:"changes"`
+}
+
+// VerificationJob checks stored properties against the current analyzers,
+// for all strings or a random sample of them, without changing anything.
+// Encrypted strings cannot be analyzed and are skipped.
+type VerificationJob struct {
+	ID          string             `json:"id"`
+	Status      string             `json:"status"`
+	Sample      int                `json:"sample,omitempty"`
+	Total       int                `json:"total"`
+	Checked     int                `json:"checked"`
+	Skipped     int                `json:"skipped"`
+	Mismatched  int                `json:"mismatched"`
+	Mismatches  []PropertyMismatch `json:"mismatches"`
+	Truncated   bool               `json:"truncated,omitempty"`
+	CreatedAt   time.Time          `json:"created_at"`
+	CompletedAt *time.Time         `json:"completed_at,omitempty"`
+	Error       string             `json:"error,omitempty"`
+}
+
+// verificationJobs holds the most recent verification reports in the order
+// they were started
+var verificationJobs = struct {
+	sync.Mutex
+	jobs  map[string]*VerificationJob
+	order []string
+}{jobs: make(map[string]*VerificationJob)}
+
+// startVerification handles POST /admin/verify, starting a job that
+// analyzes every live string again (or ?sample= of them, picked at random)
+// and reports those whose stored properties differ, e.g. after a bad
+// migration or restore. The response is 202 with the job to poll.
+func startVerification(c *fiber.Ctx) error {
+	sample := 0
+	if raw := c.Query("sample"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			return fiber.NewError(fiber.StatusBadRequest, "sample must be a positive integer")
+		}
+		sample = n
+	}
+
+	id, err := newExportID()
+	if err != nil {
+		return err
+	}
+
+	job := &VerificationJob{
+		ID:         id,
+		Status:     verificationRunning,
+		Sample:     sample,
+		Mismatches: []PropertyMismatch{},
+		CreatedAt:  time.Now().UTC(),
+	}
+
+	verificationJobs.Lock()
+	verificationJobs.jobs[id] = job
+	verificationJobs.order = append(verificationJobs.order, id)
+	if len(verificationJobs.order) > maxVerificationJobs {
+		delete(verificationJobs.jobs, verificationJobs.order[0])
+		verificationJobs.order = verificationJobs.order[1:]
+	}
+	verificationJobs.Unlock()
+
+	go runVerification(job)
+
+	c.Location("/admin/verify/" + id)
+	return c.Status(fiber.StatusAccepted).JSON(verificationStatus(job))
+}
+
+// getVerification handles GET /admin/verify/:id, the job's report so far
+func getVerification(c *fiber.Ctx) error {
+	verificationJobs.Lock()
+	job, ok := verificationJobs.jobs[c.Params("id")]
+	verificationJobs.Unlock()
+	if !ok {
+		return fiber.NewError(fiber.StatusNotFound, "Verification job does not exist")
+	}
+
+	return c.JSON(verificationStatus(job))
+}
+
+// verificationStatus copies a job for a response while holding the jobs lock
+func verificationStatus(job *VerificationJob) VerificationJob {
+	verificationJobs.Lock()
+	defer verificationJobs.Unlock()
+
+	status := *job
+	status.Mismatches = make([]PropertyMismatch, len(job.Mismatches))
+	copy(status.Mismatches, job.Mismatches)
+	return status
+}
+
+// runVerification analyzes the job's records with the current analysis
+// config and records every difference from the stored properties
+func runVerification(job *VerificationJob) {
+	records := verificationRecords(job.Sample)
+	profile := defaultProfile.Load()
+
+	verificationJobs.Lock()
+	job.Total = len(records)
+	verificationJobs.Unlock()
+
+	var failure error
+	for _, data := range records {
+		if data.Encoding == encodingEncrypted {
+			verificationJobs.Lock()
+			job.Skipped++
+			verificationJobs.Unlock()
+			continue
+		}
+
+		properties, err := analyzeString(context.Background(), rawValue(data), data.Encoding, profile)
+		if err != nil {
+			failure = err
+			break
+		}
+		changes := propertyDiff(data.Properties, properties)
+
+		verificationJobs.Lock()
+		job.Checked++
+		if len(changes) > 0 {
+			job.Mismatched++
+			if len(job.Mismatches) < maxReportedMismatches {
+				job.Mismatches = append(job.Mismatches, PropertyMismatch{ID: data.ID, Value: displayValue(data.Value), Changes: changes})
+			} else {
+				job.Truncated = true
+			}
+		}
+		verificationJobs.Unlock()
+	}
+
+	now := time.Now().UTC()
+
+	verificationJobs.Lock()
+	defer verificationJobs.Unlock()
+
+	job.CompletedAt = &now
+	if failure != nil {
+		log.Printf("verification %s failed: %v", job.ID, failure)
+		job.Status, job.Error = verificationFailed, failure.Error()
+		return
+	}
+	job.Status = verificationCompleted
+	log.Printf("verification %s checked %d strings, %d mismatched", job.ID, job.Checked, job.Mismatched)
+}
+
+// verificationRecords returns the live records to verify: all of them, or
+// a random sample of that many when sample is positive
+func verificationRecords(sample int) []*StringData {
+	now := time.Now()
+
+	var records []*StringData
+	for _, shard := range shards {
+		shard.RLock()
+		for _, data := range shard.records {
+			if !data.expired(now) {
+				records = append(records, data)
+			}
+		}
+		shard.RUnlock()
+	}
+
+	if sample > 0 && sample < len(records) {
+		rand.Shuffle(len(records), func(i, j int) { records[i], records[j] = records[j], records[i] })
+		records = records[:sample]
+	}
+	return records
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WAL operations
+const (
+	walPut              = "put"
+	walDelete           = "delete"
+	walCreateCollection = "create_collection"
+	walDropCollection   = "drop_collection"
+	walPutDerived       = "put_derived"
+	walDeleteDerived    = "delete_derived"
+)
+
+// walEntry is one line of the write-ahead log. Entries for strings in a
+// collection name it.
+type walEntry struct {
+	Sequence   uint64      `json:"seq"`
+	Op         string      `json:"op"`
+	Collection string      `json:"collection,omitempty"`
+	Value      string      `json:"value,omitempty"`
+	Record     *StringData `json:"record,omitempty"`
+	At         *time.Time  `json:"at,omitempty"`
+	// Analysis is a created collection's own analysis config
+	Analysis *AnalysisConfig `json:"analysis,omitempty"`
+	// Derived is a derived property definition put or, by name, deleted
+	Derived *DerivedProperty `json:"derived,omitempty"`
+}
+
+// upgradeValue names a put's value as it is stored now: entries logged
+// before binary values had binaryKeyPrefix name them by bare base64
+func (e *walEntry) upgradeValue() {
+	if e.Record != nil {
+		e.Value = e.Record.Value
+	}
+}
+
+// legacyBinaryValue returns the stored value a delete logged before binary
+// values had binaryKeyPrefix removes: the binary record with that base64
+// when no text record has the value. has reports whether a value is stored.
+func legacyBinaryValue(value string, has func(string) bool) string {
+	if strings.HasPrefix(value, binaryKeyPrefix) || has(value) || !has(binaryKey(value)) {
+		return value
+	}
+	return binaryKey(value)
+}
+
+// wal appends every create, replace and delete to WAL_PATH so the store can
+// be rebuilt after a crash by replaying it on top of the last snapshot.
+// Entries are written straight to the file, so they survive a process
+// crash; the OS decides when they reach the disk.
+var wal struct {
+	sync.Mutex
+	path     string
+	file     *os.File
+	sequence uint64
+}
+
+// openWAL opens the log at path for appending, continuing after sequence
+func openWAL(path string, sequence uint64) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+
+	wal.Lock()
+	wal.path, wal.file, wal.sequence = path, file, sequence
+	wal.Unlock()
+
+	return nil
+}
+
+// appendWAL records a put (record set) or delete (record nil). Caller must
+// hold the value's shard lock so entries for a value are logged in the
+// order they are applied.
+func appendWAL(value string, record *StringData) {
+	entry := walEntry{Op: walPut, Value: value, Record: record}
+	if record == nil {
+		entry.Op = walDelete
+	}
+	writeWAL(entry)
+}
+
+// writeWAL appends an entry under the next sequence
+func writeWAL(entry walEntry) {
+	wal.Lock()
+	defer wal.Unlock()
+
+	if wal.file == nil {
+		return
+	}
+	entry.Sequence = wal.sequence + 1
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("encoding WAL entry for %q: %v", entry.Value, err)
+		return
+	}
+	if _, err := wal.file.Write(append(line, '\n')); err != nil {
+		log.Printf("appending WAL entry for %q: %v", entry.Value, err)
+		return
+	}
+	wal.sequence = entry.Sequence
+}
+
+// closeWAL stops logging and closes the file, so a successor process can
+// take it over
+func closeWAL() error {
+	wal.Lock()
+	defer wal.Unlock()
+
+	if wal.file == nil {
+		return nil
+	}
+	err := wal.file.Close()
+	wal.file = nil
+	return err
+}
+
+// walSequence returns the sequence of the last logged entry
+func walSequence() uint64 {
+	wal.Lock()
+	defer wal.Unlock()
+	return wal.sequence
+}
+
+// replayWAL applies every entry after sequence to memory and returns the
+// number applied and the last sequence seen. A missing log is not an error;
+// a torn final line from a crash mid-write is ignored.
+func replayWAL(path string, after uint64) (int, uint64, error) {
+	applied, last := 0, after
+
+	err := readWAL(path, func(entry walEntry) {
+		if entry.Sequence > last {
+			last = entry.Sequence
+		}
+		if entry.Sequence <= after {
+			return
+		}
+
+		if entry.Collection != "" {
+			replayCollectionEntry(entry)
+			applied++
+			return
+		}
+		if entry.Derived != nil {
+			replayDerivedEntry(entry)
+			applied++
+			return
+		}
+
+		if entry.Op == walPut && entry.Record != nil {
+			shard := shardFor(entry.Value)
+			shard.Lock()
+			shard.cacheLocked(entry.Record)
+			shard.Unlock()
+		} else {
+			uncacheReplayed(entry.Value)
+		}
+		applied++
+	})
+
+	return applied, last, err
+}
+
+// uncacheReplayed applies a logged delete of value
+func uncacheReplayed(value string) {
+	value = legacyBinaryValue(value, func(value string) bool {
+		shard := shardFor(value)
+		shard.RLock()
+		defer shard.RUnlock()
+		_, stored := shard.records[value]
+		_, trashed := shard.deleted[value]
+		return stored || trashed
+	})
+
+	shard := shardFor(value)
+	shard.Lock()
+	shard.uncacheLocked(value)
+	shard.Unlock()
+}
+
+// readWAL calls visit for every entry of the log at path in order. A
+// missing log is not an error; reading stops at the first corrupt line,
+// such as one torn by a crash mid-write.
+func readWAL(path string, visit func(entry walEntry)) error {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var last uint64
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var entry walEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			log.Printf("stopping WAL read at a corrupt entry after sequence %d: %v", last, err)
+			break
+		}
+		last = entry.Sequence
+		entry.upgradeValue()
+		visit(entry)
+	}
+
+	return scanner.Err()
+}
+
+// compactWAL drops the entries up to sequence, which a snapshot now covers
+func compactWAL(upto uint64) error {
+	_, err := rewriteWAL(func(entry walEntry) bool { return entry.Sequence <= upto })
+	return err
+}
+
+// rewriteWAL drops the entries matching drop by rewriting the log through a
+// temp file, and returns how many it dropped
+func rewriteWAL(drop func(walEntry) bool) (int, error) {
+	wal.Lock()
+	defer wal.Unlock()
+
+	if wal.file == nil {
+		return 0, nil
+	}
+
+	current, err := os.Open(wal.path)
+	if err != nil {
+		return 0, err
+	}
+	defer current.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(wal.path), filepath.Base(wal.path)+".tmp-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	dropped := 0
+	kept := bufio.NewWriter(tmp)
+	scanner := bufio.NewScanner(current)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var entry walEntry
+		err := json.Unmarshal(scanner.Bytes(), &entry)
+		entry.upgradeValue()
+		if err != nil || drop(entry) {
+			dropped++
+			continue
+		}
+		kept.Write(scanner.Bytes())
+		kept.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := kept.Flush(); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+
+	if err := os.Rename(tmp.Name(), wal.path); err != nil {
+		return 0, err
+	}
+
+	// Reopen so appends go to the compacted file rather than the unlinked one
+	file, err := os.OpenFile(wal.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	wal.file.Close()
+	wal.file = file
+
+	return dropped, nil
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Backend is implemented by database-backed stores. The in-memory map acts
+// as a cache in front of it: hot records are preloaded at startup, cold
+// reads fall through to the backend and writes are queued through to it.
+type Backend interface {
+	// HotRecords returns up to n of the most frequently accessed records
+	HotRecords(ctx context.Context, n int) ([]*StringData, error)
+	// Load fetches a single record, returning nil if it does not exist
+	Load(ctx context.Context, value string) (*StringData, error)
+	// Save creates or replaces a record
+	Save(ctx context.Context, data *StringData) error
+	// Delete removes a record, succeeding if it does not exist
+	Delete(ctx context.Context, value string) error
+}
+
+// Watcher is implemented by backends shared between instances. Watch calls
+// changed with the value of every record another instance saved or
+// deleted until ctx is done.
+type Watcher interface {
+	Watch(ctx context.Context, changed func(value string)) error
+}
+
+// AllLoader is implemented by embedded backends, which are loaded whole at
+// startup: listings only scan memory, so records left in the backend would
+// be missing from them
+type AllLoader interface {
+	// AllRecords returns every unexpired record
+	AllRecords(ctx context.Context) ([]*StringData, error)
+}
+
+// HashLoader is implemented by backends that index records by SHA-256
+type HashLoader interface {
+	// LoadByHash fetches the record with the given hash, returning nil if none exists
+	LoadByHash(ctx context.Context, hash string) (*StringData, error)
+}
+
+var (
+	// backend is nil when the service runs purely in memory
+	backend Backend
+	ready   atomic.Bool
+)
+
+// warmUp preloads the hottest records from the backend into memory, or all
+// of them from an embedded backend, and marks the service ready once done
+func warmUp(ctx context.Context, limit int) {
+	defer ready.Store(true)
+
+	if backend == nil {
+		return
+	}
+
+	var records []*StringData
+	var err error
+	if all, ok := backend.(AllLoader); ok {
+		records, err = all.AllRecords(ctx)
+	} else if limit > 0 {
+		records, err = backend.HotRecords(ctx, limit)
+	} else {
+		return
+	}
+	if err != nil {
+		log.Printf("warm-up failed, serving cold reads from backend: %v", err)
+		return
+	}
+
+	for _, data := range records {
+		shard := shardFor(data.Value)
+		shard.Lock()
+		if _, exists := shard.records[data.Value]; !exists {
+			shard.cacheLocked(data)
+		}
+		shard.Unlock()
+	}
+
+	log.Printf("warm-up complete: %d records preloaded", len(records))
+}
+
+// loadCold looks a value up in the backend after a cache miss and caches
+// the result. Soft-deleted strings are cached but reported as missing.
+func loadCold(ctx context.Context, value string) (*StringData, error) {
+	if backend == nil {
+		return nil, nil
+	}
+
+	data, err := backend.Load(ctx, value)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	shard := shardFor(value)
+	shard.Lock()
+	if existing, exists := shard.records[value]; exists {
+		data = existing
+	} else {
+		shard.cacheLocked(data)
+	}
+	shard.Unlock()
+
+	if data.DeletedAt != nil {
+		return nil, nil
+	}
+	return data, nil
+}
+
+// ensureCached loads a value from the backend unless memory already holds
+// it, deleted or not, so checks made under the shard lock also see records
+// only the backend has
+func ensureCached(ctx context.Context, value string) error {
+	if backend == nil {
+		return nil
+	}
+
+	shard := shardFor(value)
+	shard.RLock()
+	_, cached := shard.records[value]
+	_, trashed := shard.deleted[value]
+	shard.RUnlock()
+	if cached || trashed {
+		return nil
+	}
+
+	_, err := loadCold(ctx, value)
+	return err
+}
+
+// loadColdByHash looks a full SHA-256 up in the backend's hash index after
+// a cache miss and caches the result
+func loadColdByHash(ctx context.Context, hash string) (*StringData, error) {
+	hashLoader, ok := backend.(HashLoader)
+	if !ok {
+		return nil, nil
+	}
+
+	data, err := hashLoader.LoadByHash(ctx, hash)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	shard := shardFor(data.Value)
+	shard.Lock()
+	if existing, exists := shard.records[data.Value]; exists {
+		data = existing
+	} else {
+		shard.cacheLocked(data)
+	}
+	shard.Unlock()
+
+	// Backends may still index encrypted strings saved before their
+	// plaintext hash was dropped
+	if data.DeletedAt != nil || data.Encoding == encodingEncrypted {
+		return nil, nil
+	}
+	return data, nil
+}
+
+// refreshCached reloads a value another instance changed, dropping it from
+// memory if it no longer exists in the backend
+func refreshCached(ctx context.Context, value string) {
+	data, err := backend.Load(ctx, value)
+	if err != nil {
+		log.Printf("refreshing %q from backend: %v", value, err)
+		return
+	}
+
+	shard := shardFor(value)
+	shard.Lock()
+	if data == nil {
+		shard.uncacheLocked(value)
+	} else {
+		shard.cacheLocked(data)
+	}
+	shard.Unlock()
+}
+
+// healthz handles GET /healthz
+func healthz(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+// readyz handles GET /readyz, reporting 503 until warm-up has completed
+func readyz(c *fiber.Ctx) error {
+	if !ready.Load() {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"status": "warming_up",
+		})
+	}
+
+	return c.JSON(fiber.Map{"status": "ready"})
+}
+
+// startBackend connects the configured STORAGE_BACKEND and starts writing
+// through to it. The memory backend keeps everything in process.
+func startBackend(ctx context.Context) error {
+	switch config.StorageBackend {
+	case "memory":
+		return nil
+	case "redis":
+		redisStore, err := newRedisBackend(ctx, config.RedisURL)
+		if err != nil {
+			return err
+		}
+		backend = redisStore
+	case "bolt":
+		boltStore, err := newBoltBackend(config.BoltPath)
+		if err != nil {
+			return err
+		}
+		backend = boltStore
+	default:
+		return fmt.Errorf("unknown STORAGE_BACKEND %q", config.StorageBackend)
+	}
+
+	go runPersistence(ctx)
+
+	if watcher, ok := backend.(Watcher); ok {
+		go func() {
+			err := watcher.Watch(ctx, func(value string) { refreshCached(ctx, value) })
+			if err != nil && ctx.Err() == nil {
+				log.Printf("watching backend for changes stopped: %v", err)
+			}
+		}()
+	}
+
+	return nil
+}
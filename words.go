@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// analyzeWords counts a value's words with the profile's tokenizer and
+// finds its longest and shortest word and the average word length in
+// runes. Lengths ignore punctuation around a word; ties go to the word
+// that comes first.
+func analyzeWords(_ context.Context, value string, p *StringProperties, profile *analysisProfile) {
+	p.Tokenizer = profile.tokenizer.Name()
+	p.WordCount = countWords(value, profile.tokenizer)
+
+	longest, shortest, total, words := 0, 0, 0, 0
+	for _, token := range profile.tokenizer.Tokenize(value) {
+		word := strings.TrimFunc(token, func(r rune) bool { return !isWordRune(r) })
+		if word == "" {
+			continue
+		}
+		length := utf8.RuneCountInString(word)
+		if words == 0 || length > longest {
+			p.LongestWord, longest = word, length
+		}
+		if words == 0 || length < shortest {
+			p.ShortestWord, shortest = word, length
+		}
+		total += length
+		words++
+	}
+
+	p.LongestWordLength, p.ShortestWordLength = longest, shortest
+	if words > 0 {
+		p.AverageWordLength = math.Round(float64(total)/float64(words)*100) / 100
+	}
+}